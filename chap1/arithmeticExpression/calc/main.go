@@ -0,0 +1,36 @@
+// Package main 基于calculator包的交互式计算器：多位数、小数、变量、函数、精确模式、后缀式输入与求值过程的跟踪；
+// v1、v2是最初的教学实现，只支持一位整数与单个字母的变量
+package main
+
+import (
+	"arithmeticExpression/calculator"
+	"flag"
+	"log"
+	"os"
+)
+
+var (
+	exact  = flag.Bool("exact", false, "evaluate with exact rational arithmetic")
+	digits = flag.Int("digits", 0, "print results as decimals with this many digits after the point")
+	rpn    = flag.Bool("rpn", false, "read expressions in postfix (reverse Polish) notation, e.g. 3 4 + 2 *")
+	forms  = flag.Bool("forms", false, "also print the infix, postfix and prefix forms and the expression tree")
+	trace  = flag.Bool("trace", false, "also print every step of the two-stack evaluation as a table")
+)
+
+func main() {
+	flag.Parse()
+	scanExpression()
+}
+
+// scanExpression 逐行读入表达式并求值，可以用"x = 3*4"给变量赋值，变量在整个会话中保留
+func scanExpression() {
+	worksheet := calculator.NewWorksheet(os.Stdout, "Please enter the expression：")
+	worksheet.SetExact(*exact)
+	worksheet.SetDigits(*digits)
+	worksheet.SetPostfix(*rpn)
+	worksheet.SetForms(*forms)
+	worksheet.SetTrace(*trace)
+	if err := worksheet.Run(os.Stdin); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,533 @@
+// Package calculator 用双栈（运算符栈与数栈）算法对算术表达式求值
+//
+// 每次Eval都使用自己的栈，包中没有可变的全局状态，同一个Evaluator可以被多个goroutine同时使用。
+package calculator
+
+import (
+	"math/big"
+	"sort"
+)
+
+// priorityMap 运算符的优先级，只读；(与函数调用在栈中的优先级最低
+var priorityMap = map[byte]int{
+	'(':        0,
+	'+':        1,
+	'-':        1,
+	'*':        2,
+	'/':        2,
+	'%':        2,
+	unaryMinus: 3,
+	unaryPlus:  3,
+	'^':        4,
+}
+
+// rightAssociative 右结合的运算符，2^3^2 = 2^(3^2)
+var rightAssociative = map[byte]bool{
+	'^': true,
+}
+
+// Env 变量及其值，不是并发安全的，同一个Env不能同时用于多次求值
+type Env map[string]Value
+
+// Names 按名字排序返回所有变量
+func (env Env) Names() []string {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Evaluator 表达式求值器，exact为true时用有理数精确计算
+type Evaluator struct {
+	exact bool
+}
+
+// NewEvaluator 创建一个用float64计算的求值器
+func NewEvaluator() *Evaluator {
+	return &Evaluator{}
+}
+
+// NewExactEvaluator 创建一个精确模式的求值器：数都是任意精度的有理数，1/3+1/3的结果就是2/3，
+// 整数不会溢出；结果不是有理数的运算（如sqrt(2)、pi、2^0.5）报告inexact错误
+func NewExactEvaluator() *Evaluator {
+	return &Evaluator{exact: true}
+}
+
+// Exact 判断求值器是否为精确模式
+func (e *Evaluator) Exact() bool {
+	return e.exact
+}
+
+// Eval 对表达式求值，出错时返回*Error
+func (e *Evaluator) Eval(expression string) (Value, error) {
+	return e.EvalIn(expression, nil)
+}
+
+// EvalIn 在env中对表达式求值，表达式可以使用env中的变量；
+// 形如"名字 = 表达式"时将值赋给变量，env为nil时赋值不被保存
+func (e *Evaluator) EvalIn(expression string, env Env) (Value, error) {
+	res, err := e.Evaluate(expression, env, Options{})
+	if err != nil {
+		return Value{}, err
+	}
+	return res.Value, nil
+}
+
+// Options 求值的选项
+type Options struct {
+	Postfix bool // 表达式是后缀式（逆波兰式），如"3 4 + 2 *"
+	Tree    bool // 生成表达式树
+	Trace   bool // 记录求值的每一步
+}
+
+// Result 求值的结果，Target为被赋值的变量，不是赋值时为空串；
+// Tree只在Options.Tree为true时生成，Steps只在Options.Trace为true时记录
+type Result struct {
+	Value  Value
+	Target string
+	Tree   *Node
+	Steps  []Step
+}
+
+// Evaluate 按opts在env中对表达式求值，EvalIn是它的简化形式
+func (e *Evaluator) Evaluate(expression string, env Env, opts Options) (*Result, error) {
+	tokenizer := tokenize
+	if opts.Postfix {
+		tokenizer = tokenizePostfix
+	}
+	tokens, err := tokenizer(expression)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, newError(errorEmptyExpression, 0, "")
+	}
+	target, tokens, err := assignment(tokens)
+	if err != nil {
+		return nil, err
+	}
+	ev := newEvaluation(env, e.exact)
+	ev.tree = opts.Tree
+	ev.trace = opts.Trace
+	ev.postfix = opts.Postfix
+	run := ev.run
+	if opts.Postfix {
+		run = ev.runPostfix
+	}
+	res, err := run(tokens)
+	if err != nil {
+		return nil, err
+	}
+	if target != "" && env != nil {
+		env[target] = res.v
+	}
+	return &Result{Value: res.v, Target: target, Tree: res.node, Steps: ev.steps}, nil
+}
+
+// Target 表达式是赋值时返回被赋值的变量，否则返回空串
+func Target(expression string) string {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return ""
+	}
+	target, _, err := assignment(tokens)
+	if err != nil {
+		return ""
+	}
+	return target
+}
+
+// assignment 分离赋值的左部，=只能出现在开头的变量名之后，=右边为空时报告缺少运算数
+func assignment(tokens []token) (string, []token, error) {
+	target := ""
+	if len(tokens) >= 2 && tokens[0].kind == tokenIdentifier && tokens[1].kind == tokenAssign {
+		target = tokens[0].text
+		if _, ok := constants[target]; ok {
+			return "", nil, newError(errorInvalidAssignment, tokens[0].pos, "("+target+" is a constant)")
+		}
+		if len(tokens) == 2 {
+			return "", nil, newError(errorOperateNumberLack, tokens[1].pos, "")
+		}
+		tokens = tokens[2:]
+	}
+	for _, t := range tokens {
+		if t.kind == tokenAssign {
+			return "", nil, newError(errorInvalidAssignment, t.pos, "")
+		}
+	}
+	return target, tokens, nil
+}
+
+// operand 数栈中的运算数，pos为它在表达式中的位置，用于报告多余的数；
+// node为它对应的子表达式树，不生成表达式树时为nil
+type operand struct {
+	v    Value
+	pos  int
+	node *Node
+}
+
+// evaluation 一次求值的状态，运算符栈中保存单词以便报告出错的位置；
+// 函数调用在运算符栈中的单词兼作(，argStack记录每层调用的参数个数与调用开始时数栈的深度
+type evaluation struct {
+	opStack  *stack[token]
+	numStack *stack[operand]
+	argStack *stack[callFrame]
+	env      Env
+	exact    bool
+	tree     bool
+	postfix  bool
+	trace    bool
+	reading  token  // 当前读入的单词
+	steps    []Step // trace为true时记录的每一步
+}
+
+// callFrame 一层函数调用：argc为已经读到的参数个数，base为调用开始时数栈中运算数的个数，
+// arg为当前参数开始时数栈中运算数的个数；调用只能使用base之上的运算数，参数中的运算只能使用arg之上的
+type callFrame struct {
+	argc int
+	base int
+	arg  int
+}
+
+func newEvaluation(env Env, exact bool) *evaluation {
+	return &evaluation{
+		opStack:  newStack[token](),
+		numStack: newStack[operand](),
+		argStack: newStack[callFrame](),
+		env:      env,
+		exact:    exact,
+	}
+}
+
+// isOperand 数与变量都是运算数
+func isOperand(t token) bool {
+	return t.kind == tokenNumber || t.kind == tokenIdentifier
+}
+
+// isOpen 判断运算符栈中的单词是否为(或函数调用
+func isOpen(t token) bool {
+	return t.kind == tokenLeftParenthesis || t.kind == tokenFunction
+}
+
+func (ev *evaluation) run(tokens []token) (operand, error) {
+	for i, t := range tokens {
+		ev.read(t)
+		switch t.kind {
+		case tokenNumber, tokenIdentifier:
+			//运算数紧跟在运算数或)之后时，它就是多余的数
+			if i > 0 && (isOperand(tokens[i-1]) || tokens[i-1].kind == tokenRightParenthesis) {
+				return operand{}, newError(errorRedundantNumber, t.pos, "")
+			}
+			if err := ev.pushOperand(t); err != nil {
+				return operand{}, err
+			}
+		case tokenOperator:
+			if err := ev.opService(t); err != nil {
+				return operand{}, err
+			}
+		case tokenRightParenthesis:
+			//括号中没有运算数，如"()"，或者最后一个参数为空，如"max(1,)"
+			if i > 0 && (tokens[i-1].kind == tokenLeftParenthesis || tokens[i-1].kind == tokenComma) {
+				return operand{}, newError(errorOperateNumberLack, t.pos, "")
+			}
+			//函数名之后紧跟)时没有参数
+			empty := i > 0 && tokens[i-1].kind == tokenFunction
+			if err := ev.closeParenthesis(t, empty); err != nil {
+				return operand{}, err
+			}
+		case tokenComma:
+			//参数为空，如"max(,1)"、"max(1,,2)"
+			if i > 0 && (tokens[i-1].kind == tokenFunction || tokens[i-1].kind == tokenLeftParenthesis || tokens[i-1].kind == tokenComma) {
+				return operand{}, newError(errorOperateNumberLack, t.pos, "")
+			}
+			if err := ev.comma(t); err != nil {
+				return operand{}, err
+			}
+		case tokenLeftParenthesis:
+			ev.opStack.push(t)
+			ev.record(ActionPushOperator, "")
+		case tokenFunction:
+			if _, ok := functions[t.text]; !ok {
+				return operand{}, newError(errorUnknownFunction, t.pos, t.text)
+			}
+			ev.opStack.push(t)
+			ev.argStack.push(callFrame{argc: 1, base: ev.numStack.index + 1, arg: ev.numStack.index + 1})
+			ev.record(ActionPushOperator, "")
+		}
+	}
+	ev.read(token{pos: -1})
+	for ev.opStack.index != -1 {
+		t, _ := ev.opStack.pop()
+		if isOpen(t) {
+			return operand{}, newError(errorMatchLeftParenthesis, t.pos, "")
+		}
+		if err := ev.apply(t); err != nil {
+			return operand{}, err
+		}
+	}
+	return ev.result(tokens[len(tokens)-1])
+}
+
+// result 数栈中剩下的唯一运算数就是结果；数栈为空时报告在最后一个单词处缺少运算数
+func (ev *evaluation) result(last token) (operand, error) {
+	switch {
+	case ev.numStack.index < 0:
+		return operand{}, newError(errorOperateNumberLack, last.pos, "")
+	case ev.numStack.index > 0:
+		return operand{}, newError(errorRedundantNumber, ev.numStack.data[1].pos, "")
+	}
+	return ev.numStack.data[0], nil
+}
+
+// pushOperand 将数或变量的值压入数栈
+func (ev *evaluation) pushOperand(t token) error {
+	v, err := ev.operand(t)
+	if err != nil {
+		return err
+	}
+	kind := NodeNumber
+	if t.kind == tokenIdentifier {
+		kind = NodeVariable
+	}
+	ev.numStack.push(operand{v, t.pos, ev.node(kind, t.text, t.pos, v)})
+	ev.record(ActionPushOperand, "")
+	return nil
+}
+
+// node 生成表达式树的结点，不生成表达式树时返回nil
+func (ev *evaluation) node(kind, text string, pos int, v Value, children ...operand) *Node {
+	if !ev.tree {
+		return nil
+	}
+	n := &Node{Kind: kind, Text: text, Value: v, Position: pos}
+	for _, child := range children {
+		n.Children = append(n.Children, child.node)
+	}
+	return n
+}
+
+// operand 取数或变量的值，精确模式下的数由它的文本直接转换为有理数，没有舍入误差
+func (ev *evaluation) operand(t token) (Value, error) {
+	if t.kind == tokenIdentifier {
+		return ev.variable(t)
+	}
+	if ev.exact {
+		r, _ := new(big.Rat).SetString(t.text)
+		return ratValue(r), nil
+	}
+	return floatValue(t.value), nil
+}
+
+// variable 取变量的值，常数优先于变量；变量的值转换为当前模式的值，常数在精确模式下不能使用
+func (ev *evaluation) variable(t token) (Value, error) {
+	if v, ok := constants[t.text]; ok {
+		if ev.exact {
+			return Value{}, newError(errorInexact, t.pos, "("+t.text+" is irrational)")
+		}
+		return floatValue(v), nil
+	}
+	value, ok := ev.env[t.text]
+	if !ok {
+		return Value{}, newError(errorUndefinedVariable, t.pos, t.text)
+	}
+	return convert(value, ev.exact), nil
+}
+
+// isUnary 判断运算符是否为一元运算符
+func isUnary(op byte) bool {
+	return op == unaryMinus || op == unaryPlus
+}
+
+// available 数栈中当前可以使用的运算数个数，在函数调用的参数中不包括当前参数之前压入的运算数
+func (ev *evaluation) available() int {
+	n := ev.numStack.index + 1
+	if ev.argStack.index >= 0 {
+		n -= ev.argStack.poll().arg
+	}
+	return n
+}
+
+// apply 从数栈中弹出运算数，计算后将结果压回数栈，结果的位置为运算符的位置
+func (ev *evaluation) apply(t token) error {
+	if ev.available() < 1 {
+		return newError(errorOperateNumberLack, t.pos, "")
+	}
+	n2, _ := ev.numStack.pop()
+	if isUnary(t.op) {
+		res := calUnary(n2.v, t.op)
+		ev.numStack.push(operand{res, t.pos, ev.node(NodeUnary, unaryText(t.op), t.pos, res, n2)})
+		ev.record(ActionApply, stackText(t))
+		return nil
+	}
+	if ev.available() < 1 {
+		return newError(errorOperateNumberLack, t.pos, "")
+	}
+	n1, _ := ev.numStack.pop()
+	res, err := ev.cal(n1.v, n2.v, t.op)
+	if err != nil {
+		return newError(err, t.pos, "")
+	}
+	ev.numStack.push(operand{res, n1.pos, ev.node(NodeOperator, t.text, t.pos, res, n1, n2)})
+	ev.record(ActionApply, stackText(t))
+	return nil
+}
+
+// call 从数栈中弹出argc个参数调用函数，参数只能取自数栈中base之上的运算数，结果的位置为函数名的位置
+func (ev *evaluation) call(t token, argc, base int) error {
+	f := functions[t.text]
+	if msg := f.arity(argc); msg != "" {
+		return newError(errorArity, t.pos, t.text+": "+msg)
+	}
+	if ev.numStack.index+1-base < argc {
+		return newError(errorOperateNumberLack, t.pos, "")
+	}
+	operands := make([]operand, argc)
+	args := make([]Value, argc)
+	for i := argc - 1; i >= 0; i-- {
+		operands[i], _ = ev.numStack.pop()
+		args[i] = operands[i].v
+	}
+	res, err := ev.callFunction(f, args)
+	if err != nil {
+		return newError(err, t.pos, "in "+t.text)
+	}
+	ev.numStack.push(operand{res, t.pos, ev.node(NodeFunction, t.text, t.pos, res, operands...)})
+	ev.record(ActionCall, t.text)
+	return nil
+}
+
+// callFunction 按当前模式调用函数，精确模式下没有精确实现的函数报告inexact错误
+func (ev *evaluation) callFunction(f function, args []Value) (Value, error) {
+	if ev.exact {
+		if f.exact == nil {
+			return Value{}, errorInexact
+		}
+		rats := make([]*big.Rat, len(args))
+		for i, arg := range args {
+			rats[i] = arg.r
+		}
+		res, err := f.exact(rats)
+		return ratValue(res), err
+	}
+	floats := make([]float64, len(args))
+	for i, arg := range args {
+		floats[i] = arg.f
+	}
+	res, err := f.call(floats)
+	if err == nil {
+		err = finite(res)
+	}
+	return floatValue(res), err
+}
+
+// popUntilOpen 计算栈中的运算符直到遇到(或函数调用，后者留在栈中
+func (ev *evaluation) popUntilOpen() (token, bool, error) {
+	for ev.opStack.index != -1 {
+		c := ev.opStack.poll()
+		if isOpen(c) {
+			return c, true, nil
+		}
+		ev.opStack.pop()
+		if err := ev.apply(c); err != nil {
+			return c, false, err
+		}
+	}
+	return token{}, false, nil
+}
+
+// closeParenthesis 处理)：计算到匹配的(为止，匹配的是函数调用时调用该函数
+func (ev *evaluation) closeParenthesis(t token, empty bool) error {
+	open, ok, err := ev.popUntilOpen()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return newError(errorMatchLeftParenthesis, t.pos, "")
+	}
+	ev.opStack.pop()
+	ev.record(ActionMatchParenthesis, stackText(open))
+	if open.kind != tokenFunction {
+		return nil
+	}
+	frame, _ := ev.argStack.pop()
+	if empty {
+		frame.argc = 0
+	}
+	return ev.call(open, frame.argc, frame.base)
+}
+
+// comma 处理参数之间的逗号：计算完当前参数，参数个数加一
+func (ev *evaluation) comma(t token) error {
+	open, ok, err := ev.popUntilOpen()
+	if err != nil {
+		return err
+	}
+	if !ok || open.kind != tokenFunction {
+		return newError(errorMisplacedComma, t.pos, "")
+	}
+	frame, _ := ev.argStack.pop()
+	frame.argc++
+	frame.arg = ev.numStack.index + 1
+	ev.argStack.push(frame)
+	ev.record(ActionNextArgument, "")
+	return nil
+}
+
+func (ev *evaluation) opService(t token) error {
+	//一元运算符没有左运算数，不能弹出栈中的运算符
+	if isUnary(t.op) {
+		ev.opStack.push(t)
+		ev.record(ActionPushOperator, "")
+		return nil
+	}
+	for !ev.comparePriority(t.op) {
+		c, _ := ev.opStack.pop()
+		if err := ev.apply(c); err != nil {
+			return err
+		}
+	}
+	ev.opStack.push(t)
+	ev.record(ActionPushOperator, "")
+	return nil
+}
+
+// comparePriority op可以直接入栈时返回true：栈为空，栈顶为(或函数调用，
+// op的优先级高于栈顶的运算符，或者op是右结合的且与栈顶的运算符优先级相同
+func (ev *evaluation) comparePriority(op byte) bool {
+	if ev.opStack.index == -1 {
+		return true
+	}
+	top := ev.opStack.poll()
+	if isOpen(top) {
+		return true
+	}
+	if rightAssociative[op] {
+		return priorityMap[op] >= priorityMap[top.op]
+	}
+	return priorityMap[op] > priorityMap[top.op]
+}
+
+// cal 按当前模式计算二元运算
+func (ev *evaluation) cal(n1, n2 Value, op byte) (Value, error) {
+	return calValue(n1, n2, op, ev.exact)
+}
+
+// unaryText 一元运算符在中缀式中的写法
+func unaryText(op byte) string {
+	if op == unaryMinus {
+		return "-"
+	}
+	return "+"
+}
+
+func calUnary(n Value, op byte) Value {
+	if op != unaryMinus {
+		return n
+	}
+	if n.r != nil {
+		return ratValue(new(big.Rat).Neg(n.r))
+	}
+	return floatValue(-n.f)
+}
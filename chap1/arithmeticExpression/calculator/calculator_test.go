@@ -0,0 +1,403 @@
+package calculator
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+var evalTests = []struct {
+	expression string
+	want       float64
+	err        error
+}{
+	{"12+3", 15, nil},
+	{"1-2*3+4", -1, nil},
+	{"8-2-1", 5, nil},
+	{" 1.5 * 2 ", 3, nil},
+	{".5+1", 1.5, nil},
+	{"-3+5", 2, nil},
+	{"2*-3", -6, nil},
+	{"-(2+3)*2", -10, nil},
+	{"1-(-2)", 3, nil},
+	{"--2", 2, nil},
+	{"+4", 4, nil},
+	{"7/2", 3.5, nil},
+	{"(1+2)*(3+4)", 21, nil},
+	{"2^3^2", 512, nil},
+	{"-2^2", -4, nil},
+	{"2^-1", 0.5, nil},
+	{"7 % 3 * 2", 2, nil},
+	{"-7 % 3", -1, nil},
+	{"max(1, 2+3, -4)", 5, nil},
+	{"min(4, max(2, 3)) * 2", 6, nil},
+	{"sqrt(16) + abs(-2)", 6, nil},
+	{"pow(2, 10)", 1024, nil},
+	{"log(e)", 1, nil},
+	{"log(8, 2)", 3, nil},
+	{"sin(0) + cos(0)", 1, nil},
+	{"cos(pi)", -1, nil},
+	{"max (3)", 3, nil},
+	{"(1+2", 0, errorMatchLeftParenthesis},
+	{"max(1, 2", 0, errorMatchLeftParenthesis},
+	{"sqrt(1, 2)", 0, errorArity},
+	{"max()", 0, errorArity},
+	{"foo(1)", 0, errorUnknownFunction},
+	{"1, 2", 0, errorMisplacedComma},
+	{"sqrt(-1)", 0, errorDomain},
+	{"log(0)", 0, errorDomain},
+	{"(-8)^0.5", 0, errorDomain},
+	{"10^400", 0, errorOverflow},
+	{"5 % 0", 0, errorDivisionByZero},
+	{"1+2)", 0, errorMatchLeftParenthesis},
+	{"1/0", 0, errorDivisionByZero},
+	{"2 3", 0, errorRedundantNumber},
+	{"1+", 0, errorOperateNumberLack},
+	{"1.", 0, errorInvalidNumber},
+	{"1.2.3", 0, errorInvalidNumber},
+	{"3#", 0, errorUnknownCharacter},
+	{"3a", 0, errorRedundantNumber},
+	{"x", 0, errorUndefinedVariable},
+}
+
+func TestEval(t *testing.T) {
+	e := NewEvaluator()
+	for _, test := range evalTests {
+		v, err := e.Eval(test.expression)
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("Eval(%q) error = %v, want %v", test.expression, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Eval(%q) error = %v", test.expression, err)
+			continue
+		}
+		if v.Float() != test.want {
+			t.Errorf("Eval(%q) = %v, want %v", test.expression, v, test.want)
+		}
+	}
+}
+
+func TestEvalIn(t *testing.T) {
+	env := Env{}
+	e := NewEvaluator()
+	steps := []struct {
+		expression string
+		want       float64
+		err        error
+	}{
+		{"x = 3*4", 12, nil},
+		{"x + 1", 13, nil},
+		{"y = -x / 8", -1.5, nil},
+		{"x = x * y", -18, nil},
+		{"rate_2 = (x+y)*2", -39, nil},
+		{"z + 1", 0, errorUndefinedVariable},
+		{"x =", 0, errorOperateNumberLack},
+		{"3 = x", 0, errorInvalidAssignment},
+		{"x = y = 1", 0, errorInvalidAssignment},
+	}
+	for _, step := range steps {
+		v, err := e.EvalIn(step.expression, env)
+		if step.err != nil {
+			if !errors.Is(err, step.err) {
+				t.Errorf("EvalIn(%q) error = %v, want %v", step.expression, err, step.err)
+			}
+			continue
+		}
+		if err != nil || v.Float() != step.want {
+			t.Errorf("EvalIn(%q) = %v, %v, want %v", step.expression, v, err, step.want)
+		}
+	}
+	if names := env.Names(); fmt.Sprint(names) != "[rate_2 x y]" {
+		t.Errorf("Names() = %v", names)
+	}
+	if target := Target(" total = x + 1"); target != "total" {
+		t.Errorf("Target() = %q, want total", target)
+	}
+}
+
+func TestEvalErrorPosition(t *testing.T) {
+	tests := []struct {
+		expression string
+		code       string
+		position   int
+	}{
+		{"(1+2", CodeUnmatchedParenthesis, 0},
+		{"1+2)", CodeUnmatchedParenthesis, 3},
+		{"4/(2-2)", CodeDivisionByZero, 1},
+		{"1 + 2 3", CodeRedundantNumber, 6},
+		{"1 * ", CodeOperandMissing, 2},
+		{"()", CodeOperandMissing, 1},
+		{"( )", CodeOperandMissing, 2},
+		{"(())", CodeOperandMissing, 2},
+		{"1 + ()", CodeOperandMissing, 5},
+		{"12+1.", CodeInvalidNumber, 3},
+		{"2 $ 3", CodeUnknownCharacter, 2},
+		{"  ", CodeEmptyExpression, 0},
+		{"1 + abc", CodeUndefinedVariable, 4},
+		{"a = 1 = 2", CodeInvalidAssignment, 6},
+		{"1 + pow(2)", CodeArity, 4},
+		{"2 * sqrt(3 - 4)", CodeDomain, 4},
+		{"max(1) + bar(2)", CodeUnknownFunction, 9},
+		{"pi = 3", CodeInvalidAssignment, 0},
+		{"5 max(,3)", CodeOperandMissing, 6},
+		{"1+max(2,)", CodeOperandMissing, 8},
+		{"5*max(,3)", CodeOperandMissing, 6},
+		{"max(1,,2)", CodeOperandMissing, 6},
+		{"1+max(*2, 3)", CodeOperandMissing, 6},
+		{"1+max(2, *3)", CodeOperandMissing, 9},
+	}
+	e := NewEvaluator()
+	for _, test := range tests {
+		_, err := e.Eval(test.expression)
+		var evalErr *Error
+		if !errors.As(err, &evalErr) {
+			t.Errorf("Eval(%q) error = %v, want *Error", test.expression, err)
+			continue
+		}
+		if evalErr.Code != test.code || evalErr.Position != test.position {
+			t.Errorf("Eval(%q) error = %s at %d, want %s at %d", test.expression, evalErr.Code, evalErr.Position, test.code, test.position)
+		}
+	}
+}
+
+func TestEvalExact(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       string
+		err        error
+	}{
+		{"1/3 + 1/3", "2/3", nil},
+		{"0.1 + 0.2", "3/10", nil},
+		{"2^100", "1267650600228229401496703205376", nil},
+		{"99999999999999999999 + 1", "100000000000000000000", nil},
+		{"(2/3)^-2", "9/4", nil},
+		{"-7 % 3", "-1", nil},
+		{"7.5 % 2", "3/2", nil},
+		{"max(1/3, 0.3) - min(1/2, 2/3)", "-1/6", nil},
+		{"sqrt(9/4) + abs(-1/4)", "7/4", nil},
+		{"pow(10, 30) / 10^29", "10", nil},
+		{"sqrt(2)", "", errorInexact},
+		{"2^0.5", "", errorInexact},
+		{"pi * 2", "", errorInexact},
+		{"sin(0)", "", errorInexact},
+		{"2^1000000", "", errorOverflow},
+		{"(9^99999)^99999", "", errorOverflow},
+		{"pow(1/3^99999, 99999)", "", errorOverflow},
+		{"0^-1", "", errorDomain},
+		{"1/(1/3 - 1/3)", "", errorDivisionByZero},
+	}
+	e := NewExactEvaluator()
+	for _, test := range tests {
+		v, err := e.Eval(test.expression)
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("Eval(%q) error = %v, want %v", test.expression, err, test.err)
+			}
+			continue
+		}
+		if err != nil || !v.IsExact() || v.String() != test.want {
+			t.Errorf("Eval(%q) = %v, %v, want %s", test.expression, v, err, test.want)
+		}
+	}
+	v, _ := e.Eval("2/3")
+	if d := v.Decimal(5); d != "0.66667" {
+		t.Errorf("Decimal(5) = %s, want 0.66667", d)
+	}
+	if b, _ := v.MarshalJSON(); string(b) != `"2/3"` {
+		t.Errorf("MarshalJSON() = %s", b)
+	}
+}
+
+func TestEvalMixedModes(t *testing.T) {
+	env := Env{}
+	if _, err := NewEvaluator().EvalIn("x = 0.1", env); err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewExactEvaluator().EvalIn("y = x * 3", env)
+	if err != nil || v.String() != "3/10" {
+		t.Errorf("EvalIn(y = x * 3) = %v, %v, want 3/10", v, err)
+	}
+	v, err = NewEvaluator().EvalIn("y + 1", env)
+	if err != nil || v.IsExact() || v.Float() != 1.3 {
+		t.Errorf("EvalIn(y + 1) = %v, %v, want 1.3", v, err)
+	}
+}
+
+// TestEvalConcurrent 多个goroutine共用一个Evaluator，用go test -race检查数据竞争
+func TestEvalConcurrent(t *testing.T) {
+	e := NewEvaluator()
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				expression := fmt.Sprintf("(%d+%d)*2-%d", g, i, g)
+				v, err := e.Eval(expression)
+				if err != nil {
+					t.Errorf("Eval(%q) error = %v", expression, err)
+					return
+				}
+				if want := float64(g + 2*i); v.Float() != want {
+					t.Errorf("Eval(%q) = %v, want %v", expression, v, want)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+const benchExpression = "((12+3.5)*4-7/2)*-(3+4*5)-100/(2+3)"
+
+func BenchmarkEval(b *testing.B) {
+	e := NewEvaluator()
+	for i := 0; i < b.N; i++ {
+		if _, err := e.Eval(benchExpression); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEvalParallel(b *testing.B) {
+	e := NewEvaluator()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := e.Eval(benchExpression); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func TestEvaluateTree(t *testing.T) {
+	tests := []struct {
+		expression, infix, postfix, prefix string
+	}{
+		{"(1+2)*3", "(1 + 2) * 3", "1 2 + 3 *", "* + 1 2 3"},
+		{"8-2-1", "8 - 2 - 1", "8 2 - 1 -", "- - 8 2 1"},
+		{"8-(2-1)", "8 - (2 - 1)", "8 2 1 - -", "- 8 - 2 1"},
+		{"2^3^2", "2 ^ 3 ^ 2", "2 3 2 ^ ^", "^ 2 ^ 3 2"},
+		{"(2^3)^2", "(2 ^ 3) ^ 2", "2 3 ^ 2 ^", "^ ^ 2 3 2"},
+		{"-2^2", "-2 ^ 2", "2 2 ^ neg", "neg ^ 2 2"},
+		{"(-2)^2", "(-2) ^ 2", "2 neg 2 ^", "^ neg 2 2"},
+		{"-(1+.5)", "-(1 + .5)", "1 .5 + neg", "neg + 1 .5"},
+		{"max(1, 2*3, sqrt(4))", "max(1, 2 * 3, sqrt(4))", "1 2 3 * 4 sqrt max:3", "max:3 1 * 2 3 sqrt 4"},
+		{"y = pow(2, x) % 3", "pow(2, x) % 3", "2 x pow 3 %", "% pow 2 x 3"},
+	}
+	e := NewEvaluator()
+	for _, test := range tests {
+		env := Env{"x": floatValue(4)}
+		res, err := e.Evaluate(test.expression, env, Options{Tree: true})
+		if err != nil {
+			t.Errorf("Evaluate(%q) error = %v", test.expression, err)
+			continue
+		}
+		tree := res.Tree
+		if infix := tree.Infix(); infix != test.infix {
+			t.Errorf("Evaluate(%q) infix = %q, want %q", test.expression, infix, test.infix)
+		}
+		if postfix := tree.Postfix(); postfix != test.postfix {
+			t.Errorf("Evaluate(%q) postfix = %q, want %q", test.expression, postfix, test.postfix)
+		}
+		if prefix := tree.Prefix(); prefix != test.prefix {
+			t.Errorf("Evaluate(%q) prefix = %q, want %q", test.expression, prefix, test.prefix)
+		}
+		//后缀式与中缀式重新求值得到相同的值
+		again, err := e.Evaluate(tree.Postfix(), env, Options{Postfix: true})
+		if err != nil || again.Value != res.Value {
+			t.Errorf("Evaluate(%q, Postfix) = %v, %v, want %v", tree.Postfix(), again, err, res.Value)
+		}
+		again, err = e.Evaluate(tree.Infix(), env, Options{})
+		if err != nil || again.Value != res.Value {
+			t.Errorf("Evaluate(%q) = %v, %v, want %v", tree.Infix(), again, err, res.Value)
+		}
+	}
+}
+
+func TestEvaluatePostfix(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       float64
+		code       string
+		position   int
+	}{
+		{"3 4 + 2 *", 14, "", 0},
+		{"  5 1 2 + 4 * + 3 -  ", 14, "", 0},
+		{"2 neg 3 ^", -8, "", 0},
+		{"1 2 3 max:3 9 sqrt -", 0, "", 0},
+		{"x = 2 10 pow", 1024, "", 0},
+		{"1 +", 0, CodeOperandMissing, 2},
+		{"1 2", 0, CodeRedundantNumber, 2},
+		{"1 0 /", 0, CodeDivisionByZero, 4},
+		{"1 2 max", 0, CodeArity, 4},
+		{"1 2 max:1", 0, CodeRedundantNumber, 4},
+		{"1 sqrt:2", 0, CodeArity, 2},
+		{"1 2 foo:2", 0, CodeUnknownFunction, 4},
+		{"1 ( 2", 0, CodeInvalidPostfix, 2},
+		{"1 2+", 0, CodeInvalidPostfix, 2},
+		{"1 2.3.4 +", 0, CodeInvalidNumber, 2},
+		{"1 y +", 0, CodeUndefinedVariable, 2},
+		{"1 2 = 3", 0, CodeInvalidAssignment, 4},
+		{" ", 0, CodeEmptyExpression, 0},
+	}
+	e := NewEvaluator()
+	for _, test := range tests {
+		res, err := e.Evaluate(test.expression, Env{}, Options{Postfix: true})
+		if test.code == "" {
+			if err != nil || res.Value.Float() != test.want {
+				t.Errorf("Evaluate(%q) = %v, %v, want %v", test.expression, res, err, test.want)
+			}
+			continue
+		}
+		var evalErr *Error
+		if !errors.As(err, &evalErr) {
+			t.Errorf("Evaluate(%q) error = %v, want *Error", test.expression, err)
+			continue
+		}
+		if evalErr.Code != test.code || evalErr.Position != test.position {
+			t.Errorf("Evaluate(%q) error = %s at %d, want %s at %d", test.expression, evalErr.Code, evalErr.Position, test.code, test.position)
+		}
+	}
+}
+
+func TestEvaluateTrace(t *testing.T) {
+	res, err := NewEvaluator().Evaluate("(1+2)*-3", nil, Options{Trace: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"( push_operator  [(] []",
+		"1 push_operand  [(] [1]",
+		"+ push_operator  [( +] [1]",
+		"2 push_operand  [( +] [1 2]",
+		") pop_and_apply + [(] [3]",
+		") match_parenthesis ( [] [3]",
+		"* push_operator  [*] [3]",
+		"- push_operator  [* neg] [3]",
+		"3 push_operand  [* neg] [3 3]",
+		" pop_and_apply neg [*] [3 -3]",
+		" pop_and_apply * [] [-9]",
+	}
+	if len(res.Steps) != len(want) {
+		t.Fatalf("len(Steps) = %d, want %d", len(res.Steps), len(want))
+	}
+	for i, step := range res.Steps {
+		got := fmt.Sprintf("%s %s %s %v %v", step.Token, step.Action, step.Operator, step.OpStack, step.NumStack)
+		if got != want[i] {
+			t.Errorf("Steps[%d] = %q, want %q", i, got, want[i])
+		}
+	}
+	if last := res.Steps[len(res.Steps)-1]; last.Position != -1 {
+		t.Errorf("Position = %d after the last token, want -1", last.Position)
+	}
+	res, err = NewEvaluator().Evaluate("1+2", nil, Options{})
+	if err != nil || res.Steps != nil {
+		t.Errorf("Steps = %v, want nil without Options.Trace", res.Steps)
+	}
+}
@@ -0,0 +1,89 @@
+package calculator
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	errorOperateNumberLack    = errors.New("cannot pop number from number stack")
+	errorRedundantNumber      = errors.New("redundant digital exist in the stack")
+	errorMatchLeftParenthesis = errors.New("cannot match (")
+	errorDivisionByZero       = errors.New("division by zero")
+	errorUnknownCharacter     = errors.New("unknown character")
+	errorInvalidNumber        = errors.New("invalid number")
+	errorEmptyExpression      = errors.New("empty expression")
+	errorUndefinedVariable    = errors.New("undefined variable")
+	errorInvalidAssignment    = errors.New("only a variable can be assigned")
+	errorUnknownFunction      = errors.New("unknown function")
+	errorArity                = errors.New("wrong number of arguments for")
+	errorMisplacedComma       = errors.New("comma outside function call")
+	errorDomain               = errors.New("argument out of domain")
+	errorOverflow             = errors.New("result is too large")
+	errorInexact              = errors.New("result cannot be represented exactly")
+	errorInvalidPostfix       = errors.New("invalid postfix token")
+)
+
+// 错误码，供调用者（如网页）区分错误的种类
+const (
+	CodeOperandMissing       = "operand_missing"
+	CodeRedundantNumber      = "redundant_number"
+	CodeUnmatchedParenthesis = "unmatched_parenthesis"
+	CodeDivisionByZero       = "division_by_zero"
+	CodeUnknownCharacter     = "unknown_character"
+	CodeInvalidNumber        = "invalid_number"
+	CodeEmptyExpression      = "empty_expression"
+	CodeUndefinedVariable    = "undefined_variable"
+	CodeInvalidAssignment    = "invalid_assignment"
+	CodeUnknownFunction      = "unknown_function"
+	CodeArity                = "arity"
+	CodeMisplacedComma       = "misplaced_comma"
+	CodeDomain               = "domain_error"
+	CodeOverflow             = "overflow"
+	CodeInexact              = "inexact"
+	CodeInvalidPostfix       = "invalid_postfix"
+)
+
+var codes = map[error]string{
+	errorOperateNumberLack:    CodeOperandMissing,
+	errorRedundantNumber:      CodeRedundantNumber,
+	errorMatchLeftParenthesis: CodeUnmatchedParenthesis,
+	errorDivisionByZero:       CodeDivisionByZero,
+	errorUnknownCharacter:     CodeUnknownCharacter,
+	errorInvalidNumber:        CodeInvalidNumber,
+	errorEmptyExpression:      CodeEmptyExpression,
+	errorUndefinedVariable:    CodeUndefinedVariable,
+	errorInvalidAssignment:    CodeInvalidAssignment,
+	errorUnknownFunction:      CodeUnknownFunction,
+	errorArity:                CodeArity,
+	errorMisplacedComma:       CodeMisplacedComma,
+	errorDomain:               CodeDomain,
+	errorOverflow:             CodeOverflow,
+	errorInexact:              CodeInexact,
+	errorInvalidPostfix:       CodeInvalidPostfix,
+}
+
+// Error 求值错误，Position为出错处在表达式中的字节偏移，Unwrap得到errorOperateNumberLack等错误
+type Error struct {
+	Err      error
+	Code     string
+	Message  string
+	Position int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Message, e.Position)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// newError 创建一个求值错误，detail不为空时附加在错误信息之后
+func newError(err error, pos int, detail string) *Error {
+	msg := err.Error()
+	if detail != "" {
+		msg += " " + detail
+	}
+	return &Error{Err: err, Code: codes[err], Message: msg, Position: pos}
+}
@@ -0,0 +1,133 @@
+package calculator
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// constants 内置常数，不能被赋值
+var constants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+// function 内置函数，maxArgs为-1表示参数个数不限；exact为精确模式下的实现，nil表示结果不能精确表示
+type function struct {
+	minArgs int
+	maxArgs int
+	call    func(args []float64) (float64, error)
+	exact   func(args []*big.Rat) (*big.Rat, error)
+}
+
+// functions 内置函数，只读
+var functions = map[string]function{
+	"max":  {1, -1, fold(math.Max), foldRat(1)},
+	"min":  {1, -1, fold(math.Min), foldRat(-1)},
+	"abs":  {1, 1, unary(math.Abs), absRat},
+	"sin":  {1, 1, unary(math.Sin), nil},
+	"cos":  {1, 1, unary(math.Cos), nil},
+	"sqrt": {1, 1, sqrt, sqrtRat},
+	"pow":  {2, 2, pow, powRat},
+	"log":  {1, 2, log, nil},
+}
+
+func fold(f func(a, b float64) float64) func(args []float64) (float64, error) {
+	return func(args []float64) (float64, error) {
+		res := args[0]
+		for _, arg := range args[1:] {
+			res = f(res, arg)
+		}
+		return res, nil
+	}
+}
+
+func unary(f func(x float64) float64) func(args []float64) (float64, error) {
+	return func(args []float64) (float64, error) {
+		return f(args[0]), nil
+	}
+}
+
+func sqrt(args []float64) (float64, error) {
+	if args[0] < 0 {
+		return 0, errorDomain
+	}
+	return math.Sqrt(args[0]), nil
+}
+
+func pow(args []float64) (float64, error) {
+	return power(args[0], args[1])
+}
+
+// power 乘方，负数的非整数次方与0的负数次方没有定义
+func power(x, y float64) (float64, error) {
+	if x < 0 && y != math.Trunc(y) || x == 0 && y < 0 {
+		return 0, errorDomain
+	}
+	return math.Pow(x, y), nil
+}
+
+// log 一个参数时为自然对数，两个参数时第二个参数为底
+func log(args []float64) (float64, error) {
+	if args[0] <= 0 {
+		return 0, errorDomain
+	}
+	if len(args) == 1 {
+		return math.Log(args[0]), nil
+	}
+	base := args[1]
+	if base <= 0 || base == 1 {
+		return 0, errorDomain
+	}
+	return math.Log(args[0]) / math.Log(base), nil
+}
+
+// foldRat 选出参数中的最大值（sign为1）或最小值（sign为-1）
+func foldRat(sign int) func(args []*big.Rat) (*big.Rat, error) {
+	return func(args []*big.Rat) (*big.Rat, error) {
+		res := args[0]
+		for _, arg := range args[1:] {
+			if arg.Cmp(res) == sign {
+				res = arg
+			}
+		}
+		return res, nil
+	}
+}
+
+func absRat(args []*big.Rat) (*big.Rat, error) {
+	return new(big.Rat).Abs(args[0]), nil
+}
+
+func powRat(args []*big.Rat) (*big.Rat, error) {
+	return powerRat(args[0], args[1])
+}
+
+// sqrtRat 只有分子与分母都是完全平方数时平方根才是有理数
+func sqrtRat(args []*big.Rat) (*big.Rat, error) {
+	x := args[0]
+	if x.Sign() < 0 {
+		return nil, errorDomain
+	}
+	num := new(big.Int).Sqrt(x.Num())
+	den := new(big.Int).Sqrt(x.Denom())
+	res := new(big.Rat).SetFrac(num, den)
+	if new(big.Rat).Mul(res, res).Cmp(x) != 0 {
+		return nil, errorInexact
+	}
+	return res, nil
+}
+
+// arity 检查参数个数，不符合时返回错误信息
+func (f function) arity(argc int) string {
+	if argc >= f.minArgs && (f.maxArgs < 0 || argc <= f.maxArgs) {
+		return ""
+	}
+	switch {
+	case f.maxArgs < 0:
+		return fmt.Sprintf("expects at least %d, got %d", f.minArgs, argc)
+	case f.minArgs == f.maxArgs:
+		return fmt.Sprintf("expects %d, got %d", f.minArgs, argc)
+	}
+	return fmt.Sprintf("expects %d to %d, got %d", f.minArgs, f.maxArgs, argc)
+}
@@ -0,0 +1,112 @@
+package calculator
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// postfixOperators 后缀式中的运算符，一元的-、+写作neg、pos
+var postfixOperators = map[string]byte{
+	"+":   '+',
+	"-":   '-',
+	"*":   '*',
+	"/":   '/',
+	"%":   '%',
+	"^":   '^',
+	"neg": unaryMinus,
+	"pos": unaryPlus,
+}
+
+// tokenizePostfix 将后缀式按空白切分为单词，如"x = 1 2 + max:3 neg"：
+// 数、变量、运算符、函数，参数个数固定的函数可以省略":参数个数"；
+// 函数调用单词的value为参数个数，开头可以是"名字 ="形式的赋值
+func tokenizePostfix(expression string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(expression) {
+		if isSpace(expression[i]) {
+			i++
+			continue
+		}
+		begin := i
+		for i < len(expression) && !isSpace(expression[i]) {
+			i++
+		}
+		t, err := postfixToken(expression[begin:i], begin)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+// postfixToken 将后缀式中的一个词转换为单词，pos为它在表达式中的字节偏移
+func postfixToken(word string, pos int) (token, error) {
+	if op, ok := postfixOperators[word]; ok {
+		return token{kind: tokenOperator, op: op, text: word, pos: pos}, nil
+	}
+	if word == "=" {
+		return token{kind: tokenAssign, op: '=', text: word, pos: pos}, nil
+	}
+	name, count, hasCount := strings.Cut(word, ":")
+	if f, ok := functions[name]; ok {
+		argc := f.minArgs
+		if hasCount {
+			n, err := strconv.Atoi(count)
+			if err != nil || n < 0 {
+				return token{}, newError(errorInvalidPostfix, pos, fmt.Sprintf("%q", word))
+			}
+			argc = n
+		} else if f.minArgs != f.maxArgs {
+			return token{}, newError(errorArity, pos, name+": write "+name+":N with the number of arguments")
+		}
+		return token{kind: tokenFunction, op: '(', value: float64(argc), text: name, pos: pos}, nil
+	}
+	if hasCount {
+		return token{}, newError(errorUnknownFunction, pos, name)
+	}
+	//数与变量名的写法与中缀式相同
+	tokens, err := tokenize(word)
+	if err != nil {
+		var evalErr *Error
+		if errors.As(err, &evalErr) {
+			evalErr.Position += pos
+		}
+		return token{}, err
+	}
+	if len(tokens) != 1 || !isOperand(tokens[0]) {
+		return token{}, newError(errorInvalidPostfix, pos, fmt.Sprintf("%q", word))
+	}
+	t := tokens[0]
+	t.pos = pos
+	return t, nil
+}
+
+// runPostfix 对后缀式求值：运算数压入数栈，运算符与函数从数栈中弹出运算数，结果压回数栈
+func (ev *evaluation) runPostfix(tokens []token) (operand, error) {
+	for _, t := range tokens {
+		ev.read(t)
+		switch t.kind {
+		case tokenNumber, tokenIdentifier:
+			if err := ev.pushOperand(t); err != nil {
+				return operand{}, err
+			}
+		case tokenOperator:
+			if err := ev.apply(t); err != nil {
+				return operand{}, err
+			}
+		case tokenFunction:
+			if err := ev.call(t, int(t.value), 0); err != nil {
+				return operand{}, err
+			}
+		}
+	}
+	return ev.result(tokens[len(tokens)-1])
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
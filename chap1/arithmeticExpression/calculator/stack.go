@@ -0,0 +1,41 @@
+package calculator
+
+// stack 用切片实现的栈，index为栈顶的下标，空栈为-1
+type stack[T any] struct {
+	index int
+	data  []T
+}
+
+func newStack[T any]() *stack[T] {
+	return &stack[T]{
+		index: -1,
+		data:  []T{},
+	}
+}
+
+func (s *stack[T]) push(v T) {
+	s.index++
+	if len(s.data) < s.index+1 {
+		s.data = append(s.data, v)
+		return
+	}
+	s.data[s.index] = v
+}
+
+func (s *stack[T]) pop() (T, bool) {
+	var zero T
+	if s.index >= 0 {
+		v := s.data[s.index]
+		s.index--
+		return v, true
+	}
+	return zero, false
+}
+
+func (s *stack[T]) poll() T {
+	var zero T
+	if s.index >= 0 {
+		return s.data[s.index]
+	}
+	return zero
+}
@@ -0,0 +1,135 @@
+package calculator
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// 一元运算符在运算符栈中的表示，与二元的+、-区分
+const (
+	unaryMinus = 'm'
+	unaryPlus  = 'p'
+)
+
+const (
+	tokenNumber = iota
+	tokenOperator
+	tokenLeftParenthesis
+	tokenRightParenthesis
+	tokenIdentifier
+	tokenAssign
+	tokenFunction // 函数名及其后的(
+	tokenComma
+)
+
+// token 表达式中的一个单词，pos为它在表达式中的字节偏移
+type token struct {
+	kind  int
+	op    byte
+	value float64
+	text  string
+	pos   int
+}
+
+// tokenize 将表达式切分为单词：整数与小数、变量名、函数名、+ - * / % ^、括号、逗号与=，跳过空白；
+// +、-出现在表达式开头、运算符或(之后时是一元运算符
+func tokenize(expression string) ([]token, error) {
+	var tokens []token
+	buf := []byte(expression)
+	i := 0
+	for i < len(buf) {
+		c := buf[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case isDigit(c) || c == '.':
+			begin := i
+			for i < len(buf) && isDigit(buf[i]) {
+				i++
+			}
+			if i < len(buf) && buf[i] == '.' {
+				i++
+				digits := i
+				for i < len(buf) && isDigit(buf[i]) {
+					i++
+				}
+				if i == digits {
+					return nil, newError(errorInvalidNumber, begin, fmt.Sprintf("%q", buf[begin:i]))
+				}
+			}
+			if i < len(buf) && buf[i] == '.' {
+				return nil, newError(errorInvalidNumber, begin, fmt.Sprintf("%q", buf[begin:i+1]))
+			}
+			v, err := strconv.ParseFloat(string(buf[begin:i]), 64)
+			if err != nil {
+				return nil, newError(errorInvalidNumber, begin, fmt.Sprintf("%q", buf[begin:i]))
+			}
+			tokens = append(tokens, token{kind: tokenNumber, value: v, text: string(buf[begin:i]), pos: begin})
+		case c == '+' || c == '-' || c == '*' || c == '/' || c == '%' || c == '^':
+			op := c
+			if isUnaryPosition(tokens) {
+				switch c {
+				case '+':
+					op = unaryPlus
+				case '-':
+					op = unaryMinus
+				}
+			}
+			tokens = append(tokens, token{kind: tokenOperator, op: op, text: string(c), pos: i})
+			i++
+		case isLetter(c):
+			begin := i
+			for i < len(buf) && (isLetter(buf[i]) || isDigit(buf[i])) {
+				i++
+			}
+			name := string(buf[begin:i])
+			//名字之后（可以隔着空白）是(时为函数调用
+			j := i
+			for j < len(buf) && (buf[j] == ' ' || buf[j] == '\t') {
+				j++
+			}
+			if j < len(buf) && buf[j] == '(' {
+				tokens = append(tokens, token{kind: tokenFunction, op: '(', text: name, pos: begin})
+				i = j + 1
+				break
+			}
+			tokens = append(tokens, token{kind: tokenIdentifier, text: name, pos: begin})
+		case c == ',':
+			tokens = append(tokens, token{kind: tokenComma, op: c, text: ",", pos: i})
+			i++
+		case c == '=':
+			tokens = append(tokens, token{kind: tokenAssign, op: c, text: "=", pos: i})
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLeftParenthesis, op: c, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRightParenthesis, op: c, text: ")", pos: i})
+			i++
+		default:
+			return nil, newError(errorUnknownCharacter, i, fmt.Sprintf("%q", c))
+		}
+	}
+	return tokens, nil
+}
+
+// isUnaryPosition 下一个+、-是否为一元运算符
+func isUnaryPosition(tokens []token) bool {
+	if len(tokens) == 0 {
+		return true
+	}
+	last := tokens[len(tokens)-1]
+	switch last.kind {
+	case tokenOperator, tokenLeftParenthesis, tokenAssign, tokenFunction, tokenComma:
+		return true
+	}
+	return false
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
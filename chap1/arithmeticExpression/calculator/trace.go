@@ -0,0 +1,66 @@
+package calculator
+
+// 求值过程中每一步的动作
+const (
+	ActionPushOperand      = "push_operand"      // 数或变量的值压入数栈
+	ActionPushOperator     = "push_operator"     // 运算符、(或函数调用压入运算符栈
+	ActionApply            = "pop_and_apply"     // 弹出运算符与运算数，结果压回数栈
+	ActionMatchParenthesis = "match_parenthesis" // )与栈中的(或函数调用匹配，弹出后者
+	ActionCall             = "call_function"     // 弹出参数调用函数，结果压回数栈
+	ActionNextArgument     = "next_argument"     // 逗号结束一个参数
+)
+
+// Step 求值的一步，OpStack与NumStack为这一步之后两个栈的内容，栈底在前；
+// Token为读入的单词，读完表达式之后计算栈中剩余的运算符时为空串，Position为-1；
+// Operator为pop_and_apply与call_function计算的运算符或函数，match_parenthesis弹出的(或函数调用
+type Step struct {
+	Token    string   `json:"token"`
+	Position int      `json:"position"`
+	Action   string   `json:"action"`
+	Operator string   `json:"operator,omitempty"`
+	OpStack  []string `json:"opStack"`
+	NumStack []Value  `json:"numStack"`
+}
+
+// read 记录当前读入的单词，t.pos为-1表示表达式已经读完
+func (ev *evaluation) read(t token) {
+	ev.reading = t
+}
+
+// record 生成表达式的求值过程时记录一步
+func (ev *evaluation) record(action, operator string) {
+	if !ev.trace {
+		return
+	}
+	step := Step{Token: ev.readText(), Position: ev.reading.pos, Action: action, Operator: operator}
+	step.OpStack = make([]string, ev.opStack.index+1)
+	for i, t := range ev.opStack.data[:ev.opStack.index+1] {
+		step.OpStack[i] = stackText(t)
+	}
+	step.NumStack = make([]Value, ev.numStack.index+1)
+	for i, n := range ev.numStack.data[:ev.numStack.index+1] {
+		step.NumStack[i] = n.v
+	}
+	ev.steps = append(ev.steps, step)
+}
+
+// readText 当前读入的单词在表达式中的写法，中缀式中的函数调用包括其后的(
+func (ev *evaluation) readText() string {
+	if ev.reading.kind == tokenFunction && !ev.postfix {
+		return ev.reading.text + "("
+	}
+	return ev.reading.text
+}
+
+// stackText 运算符栈中的单词的写法，一元的-、+写作neg、pos以区别于二元运算符
+func stackText(t token) string {
+	switch {
+	case t.kind == tokenFunction:
+		return t.text + "("
+	case t.op == unaryMinus:
+		return "neg"
+	case t.op == unaryPlus:
+		return "pos"
+	}
+	return t.text
+}
@@ -0,0 +1,109 @@
+package calculator
+
+import (
+	"strconv"
+	"strings"
+)
+
+// 表达式树中结点的种类
+const (
+	NodeNumber   = "number"
+	NodeVariable = "variable"
+	NodeOperator = "operator" // 二元运算符
+	NodeUnary    = "unary"    // 一元的+、-
+	NodeFunction = "function"
+)
+
+// Node 表达式树的结点，Value为以它为根的子表达式的值，Position为对应的单词在表达式中的字节偏移
+type Node struct {
+	Kind     string  `json:"kind"`
+	Text     string  `json:"text"`
+	Value    Value   `json:"value"`
+	Position int     `json:"position"`
+	Children []*Node `json:"children,omitempty"`
+}
+
+// word 结点在后缀式与前缀式中的写法：一元的-、+写作neg、pos，参数个数不定的函数写作"名字:参数个数"
+func (n *Node) word() string {
+	switch n.Kind {
+	case NodeUnary:
+		if n.Text == "-" {
+			return "neg"
+		}
+		return "pos"
+	case NodeFunction:
+		if f := functions[n.Text]; f.minArgs != f.maxArgs {
+			return n.Text + ":" + strconv.Itoa(len(n.Children))
+		}
+	}
+	return n.Text
+}
+
+// Postfix 后缀式（逆波兰式），如"1 2 + 3 *"，可以用Options.Postfix重新求值
+func (n *Node) Postfix() string {
+	var words []string
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		for _, child := range n.Children {
+			walk(child)
+		}
+		words = append(words, n.word())
+	}
+	walk(n)
+	return strings.Join(words, " ")
+}
+
+// Prefix 前缀式（波兰式），如"* + 1 2 3"
+func (n *Node) Prefix() string {
+	var words []string
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		words = append(words, n.word())
+		for _, child := range n.Children {
+			walk(child)
+		}
+	}
+	walk(n)
+	return strings.Join(words, " ")
+}
+
+// Infix 中缀式，只在必要处加括号，如"(1 + 2) * 3"
+func (n *Node) Infix() string {
+	switch n.Kind {
+	case NodeOperator:
+		left, right := n.Children[0].Infix(), n.Children[1].Infix()
+		p, lp, rp := n.priority(), n.Children[0].priority(), n.Children[1].priority()
+		op := n.Text[0]
+		if lp < p || lp == p && rightAssociative[op] {
+			left = "(" + left + ")"
+		}
+		if rp < p || rp == p && !rightAssociative[op] {
+			right = "(" + right + ")"
+		}
+		return left + " " + n.Text + " " + right
+	case NodeUnary:
+		operand := n.Children[0].Infix()
+		if n.Children[0].priority() < n.priority() {
+			operand = "(" + operand + ")"
+		}
+		return n.Text + operand
+	case NodeFunction:
+		args := make([]string, len(n.Children))
+		for i, child := range n.Children {
+			args[i] = child.Infix()
+		}
+		return n.Text + "(" + strings.Join(args, ", ") + ")"
+	}
+	return n.Text
+}
+
+// priority 结点作为运算数时的优先级，数、变量与函数调用不需要加括号
+func (n *Node) priority() int {
+	switch n.Kind {
+	case NodeOperator:
+		return priorityMap[n.Text[0]]
+	case NodeUnary:
+		return priorityMap[unaryMinus]
+	}
+	return len(priorityMap)
+}
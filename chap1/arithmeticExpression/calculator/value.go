@@ -0,0 +1,224 @@
+package calculator
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// maxExponent 精确模式下乘方的指数的最大绝对值，避免构造出耗尽内存的大数
+const maxExponent = 100000
+
+// maxBits 精确模式下乘方结果的分子或分母的最大位数，指数不大时底数也可能很大，如(9^99999)^99999
+const maxBits = 1 << 20
+
+// Value 表达式的值，r不为nil时是精确的有理数，否则是float64
+type Value struct {
+	f float64
+	r *big.Rat
+}
+
+func floatValue(f float64) Value {
+	return Value{f: f}
+}
+
+func ratValue(r *big.Rat) Value {
+	return Value{r: r}
+}
+
+// NewFloat 创建一个float64的值，如作为变量放入Env
+func NewFloat(f float64) Value {
+	return floatValue(f)
+}
+
+// IsExact 判断值是否为精确模式下得到的有理数
+func (v Value) IsExact() bool {
+	return v.r != nil
+}
+
+// Float 返回值的float64形式，精确的值取最接近的float64
+func (v Value) Float() float64 {
+	if v.r != nil {
+		f, _ := v.r.Float64()
+		return f
+	}
+	return v.f
+}
+
+// Rat 返回值的有理数形式，float64按最短的十进制形式转换，如0.1转换为1/10
+func (v Value) Rat() *big.Rat {
+	if v.r != nil {
+		return new(big.Rat).Set(v.r)
+	}
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(v.f, 'g', -1, 64))
+	return r
+}
+
+// String 精确的值为整数或最简分数（如2/3），float64整数不带小数点，其它按最短的形式输出
+func (v Value) String() string {
+	if v.r != nil {
+		return v.r.RatString()
+	}
+	return strconv.FormatFloat(v.f, 'g', -1, 64)
+}
+
+// Decimal 转换为小数点后digits位的小数，最后一位四舍五入
+func (v Value) Decimal(digits int) string {
+	if v.r != nil {
+		return v.r.FloatString(digits)
+	}
+	return strconv.FormatFloat(v.f, 'f', digits, 64)
+}
+
+// MarshalJSON float64的值在JSON中是一个数；精确的值可能超出JSON数的精度，是String形式的字符串
+func (v Value) MarshalJSON() ([]byte, error) {
+	if v.r != nil {
+		return json.Marshal(v.r.RatString())
+	}
+	return strconv.AppendFloat(nil, v.f, 'g', -1, 64), nil
+}
+
+// Convert 将值转换为求值器的模式的值，如float64模式下赋值的变量在精确模式下使用
+func (e *Evaluator) Convert(v Value) Value {
+	return convert(v, e.exact)
+}
+
+// Number 按求值器的模式将数的文本（如"12"、"-1"、"0.5"）转换为值，不是数时返回位置为pos的*Error
+func (e *Evaluator) Number(text string, pos int) (Value, error) {
+	if e.exact {
+		r, ok := new(big.Rat).SetString(text)
+		if !ok {
+			return Value{}, newError(errorInvalidNumber, pos, strconv.Quote(text))
+		}
+		return ratValue(r), nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return Value{}, newError(errorInvalidNumber, pos, strconv.Quote(text))
+	}
+	return floatValue(f), nil
+}
+
+// Operate 按求值器的模式计算x op y，op为+ - * / % ^之一，出错时返回位置为pos的*Error；
+// 供用其它方式（如四元式）组织计算的调用者使用
+func (e *Evaluator) Operate(op byte, x, y Value, pos int) (Value, error) {
+	res, err := calValue(convert(x, e.exact), convert(y, e.exact), op, e.exact)
+	if err != nil {
+		return Value{}, newError(err, pos, "")
+	}
+	return res, nil
+}
+
+// convert 将值转换为精确模式或float64模式的值
+func convert(v Value, exact bool) Value {
+	if exact {
+		return ratValue(v.Rat())
+	}
+	return floatValue(v.Float())
+}
+
+// calValue 按模式计算二元运算，运算数已经是该模式的值
+func calValue(n1, n2 Value, op byte, exact bool) (Value, error) {
+	if exact {
+		res, err := calRat(n1.r, n2.r, op)
+		return ratValue(res), err
+	}
+	res, err := calFloat(n1.f, n2.f, op)
+	return floatValue(res), err
+}
+
+// calFloat float64的二元运算
+func calFloat(n1, n2 float64, op byte) (float64, error) {
+	res := 0.0
+	switch op {
+	case '+':
+		res = n1 + n2
+	case '-':
+		res = n1 - n2
+	case '*':
+		res = n1 * n2
+	case '/':
+		if n2 == 0 {
+			return 0, errorDivisionByZero
+		}
+		res = n1 / n2
+	case '%':
+		if n2 == 0 {
+			return 0, errorDivisionByZero
+		}
+		res = math.Mod(n1, n2)
+	case '^':
+		var err error
+		if res, err = power(n1, n2); err != nil {
+			return 0, err
+		}
+	}
+	return res, finite(res)
+}
+
+// calRat 有理数的二元运算，%的结果与被除数同号，^的指数必须是整数
+func calRat(n1, n2 *big.Rat, op byte) (*big.Rat, error) {
+	res := new(big.Rat)
+	switch op {
+	case '+':
+		res.Add(n1, n2)
+	case '-':
+		res.Sub(n1, n2)
+	case '*':
+		res.Mul(n1, n2)
+	case '/':
+		if n2.Sign() == 0 {
+			return nil, errorDivisionByZero
+		}
+		res.Quo(n1, n2)
+	case '%':
+		if n2.Sign() == 0 {
+			return nil, errorDivisionByZero
+		}
+		q := new(big.Int).Quo(new(big.Int).Mul(n1.Num(), n2.Denom()), new(big.Int).Mul(n1.Denom(), n2.Num()))
+		res.Sub(n1, new(big.Rat).Mul(n2, new(big.Rat).SetInt(q)))
+	case '^':
+		return powerRat(n1, n2)
+	}
+	return res, nil
+}
+
+// powerRat 有理数的整数次方
+func powerRat(x, y *big.Rat) (*big.Rat, error) {
+	if !y.IsInt() {
+		return nil, errorInexact
+	}
+	if y.Num().CmpAbs(big.NewInt(maxExponent)) > 0 {
+		return nil, errorOverflow
+	}
+	if x.Sign() == 0 && y.Sign() < 0 {
+		return nil, errorDomain
+	}
+	n := new(big.Int).Abs(y.Num())
+	//结果的位数约为底数的位数乘以指数，先估计再计算
+	bits := x.Num().BitLen()
+	if x.Denom().BitLen() > bits {
+		bits = x.Denom().BitLen()
+	}
+	if int64(bits)*n.Int64() > maxBits {
+		return nil, errorOverflow
+	}
+	num := new(big.Int).Exp(x.Num(), n, nil)
+	den := new(big.Int).Exp(x.Denom(), n, nil)
+	if y.Sign() < 0 {
+		num, den = den, num
+	}
+	return new(big.Rat).SetFrac(num, den), nil
+}
+
+// finite 结果为无穷大时报告溢出，不是数时报告超出定义域
+func finite(v float64) error {
+	switch {
+	case math.IsNaN(v):
+		return errorDomain
+	case math.IsInf(v, 0):
+		return errorOverflow
+	}
+	return nil
+}
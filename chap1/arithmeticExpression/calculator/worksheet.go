@@ -0,0 +1,155 @@
+package calculator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Worksheet 命令行中逐行求值的工作表，变量在整个工作表中保留
+//
+//	x = 3*4      赋值，打印 x = 12
+//	x + 1        求值，打印 13
+//	:vars        列出变量
+//	:clear       清空变量
+type Worksheet struct {
+	evaluator *Evaluator
+	env       Env
+	out       io.Writer
+	prompt    string
+	digits    int
+	opts      Options
+}
+
+// NewWorksheet 创建一个工作表，结果与错误都写到out，每读一行之前打印prompt
+func NewWorksheet(out io.Writer, prompt string) *Worksheet {
+	return &Worksheet{
+		evaluator: NewEvaluator(),
+		env:       Env{},
+		out:       out,
+		prompt:    prompt,
+	}
+}
+
+// SetExact 切换到精确模式或float64模式，已有的变量转换为新模式的值
+func (w *Worksheet) SetExact(exact bool) {
+	if exact {
+		w.evaluator = NewExactEvaluator()
+	} else {
+		w.evaluator = NewEvaluator()
+	}
+}
+
+// SetDigits 大于0时结果以小数形式输出到小数点后digits位，否则精确的值输出为分数
+func (w *Worksheet) SetDigits(digits int) {
+	w.digits = digits
+}
+
+// SetPostfix 为true时每行是后缀式（逆波兰式），如"3 4 + 2 *"
+func (w *Worksheet) SetPostfix(postfix bool) {
+	w.opts.Postfix = postfix
+}
+
+// SetForms 为true时在值之前打印表达式的中缀式、后缀式、前缀式与表达式树
+func (w *Worksheet) SetForms(forms bool) {
+	w.opts.Tree = forms
+}
+
+// SetTrace 为true时在值之前以表格打印求值的每一步
+func (w *Worksheet) SetTrace(trace bool) {
+	w.opts.Trace = trace
+}
+
+// format 按digits输出值
+func (w *Worksheet) format(v Value) string {
+	if w.digits > 0 {
+		return v.Decimal(w.digits)
+	}
+	return v.String()
+}
+
+// Run 逐行读取并求值，直到输入结束
+func (w *Worksheet) Run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		if w.prompt != "" {
+			fmt.Fprintln(w.out, w.prompt)
+		}
+		if !scanner.Scan() {
+			return scanner.Err()
+		}
+		w.Exec(scanner.Text())
+	}
+}
+
+// Exec 对一行求值或执行一条命令
+func (w *Worksheet) Exec(line string) {
+	line = strings.TrimSpace(line)
+	switch line {
+	case "":
+		return
+	case ":vars":
+		for _, name := range w.env.Names() {
+			fmt.Fprintf(w.out, "%s = %s\n", name, w.format(w.env[name]))
+		}
+		return
+	case ":clear":
+		w.env = Env{}
+		return
+	}
+	res, err := w.evaluator.Evaluate(line, w.env, w.opts)
+	if err != nil {
+		fmt.Fprintln(w.out, err)
+		return
+	}
+	if res.Tree != nil {
+		fmt.Fprintf(w.out, "infix:   %s\npostfix: %s\nprefix:  %s\n", res.Tree.Infix(), res.Tree.Postfix(), res.Tree.Prefix())
+		w.printTree(res.Tree, "", "")
+	}
+	if res.Steps != nil {
+		w.printSteps(res.Steps)
+	}
+	if res.Target != "" {
+		fmt.Fprintf(w.out, "%s = %s\n", res.Target, w.format(res.Value))
+		return
+	}
+	fmt.Fprintln(w.out, w.format(res.Value))
+}
+
+// printTree 逐行打印表达式树，数以外的结点后是它的值：
+//
+//	/ = 1
+//	├─ + = 3
+//	│  ├─ 1
+//	│  └─ 2
+//	└─ 3
+func (w *Worksheet) printTree(n *Node, first, rest string) {
+	if n.Kind == NodeNumber {
+		fmt.Fprintf(w.out, "%s%s\n", first, n.Text)
+		return
+	}
+	fmt.Fprintf(w.out, "%s%s = %s\n", first, n.word(), w.format(n.Value))
+	for i, child := range n.Children {
+		if i == len(n.Children)-1 {
+			w.printTree(child, rest+"└─ ", rest+"   ")
+		} else {
+			w.printTree(child, rest+"├─ ", rest+"│  ")
+		}
+	}
+}
+
+// printSteps 以表格打印求值的每一步，栈底在左
+func (w *Worksheet) printSteps(steps []Step) {
+	tw := tabwriter.NewWriter(w.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\ttoken\taction\toperator\topStack\tnumStack")
+	for i, step := range steps {
+		nums := make([]string, len(step.NumStack))
+		for j, v := range step.NumStack {
+			nums[j] = w.format(v)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", i+1, step.Token, step.Action, step.Operator, strings.Join(step.OpStack, " "), strings.Join(nums, " "))
+	}
+	tw.Flush()
+}
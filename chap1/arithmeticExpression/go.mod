@@ -2,11 +2,15 @@ module arithmeticExpression
 
 go 1.19
 
+require (
+	chap4 v0.0.0
+	github.com/gin-gonic/gin v1.9.0
+)
+
 require (
 	github.com/bytedance/sonic v1.8.3 // indirect
 	github.com/chenzhuoyu/base64x v0.0.0-20221115062448-fe3a3abad311 // indirect
 	github.com/gin-contrib/sse v0.1.0 // indirect
-	github.com/gin-gonic/gin v1.9.0 // indirect
 	github.com/go-playground/locales v0.14.1 // indirect
 	github.com/go-playground/universal-translator v0.18.1 // indirect
 	github.com/go-playground/validator/v10 v10.11.2 // indirect
@@ -28,3 +32,6 @@ require (
 	google.golang.org/protobuf v1.29.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+// chap4 第四章的编译器，与本模块在同一个仓库中
+replace chap4 => ../../chap4
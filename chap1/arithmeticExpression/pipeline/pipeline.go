@@ -0,0 +1,158 @@
+// Package pipeline 用第四章的编译器对算术表达式求值：chap4的词法分析器切分单词，Analyzer.E构造语法树，
+// 语义分析生成四元式，再依次执行四元式得到表达式的值
+//
+// 表达式的语言是chap4的算术表达式：整常数、变量、+ - * /、一元的-与括号。
+// 只有分析与生成四元式使用chap4，四元式的运算由calculator.Evaluator完成，是计算器的语义而不是chap4的整数运算：
+// chap4的解释器中1/2为0，这里为0.5（精确模式下为1/2）。
+// 语义分析生成的临时变量名为t1、t2……，因此表达式中不能使用这样命名的变量，否则报告reserved_name错误。
+package pipeline
+
+import (
+	"arithmeticExpression/calculator"
+	"chap4/analyzer"
+	"chap4/compiler"
+	"chap4/lexer"
+	"chap4/semantic"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// CodeReservedName 表达式中使用了与chap4的临时变量同名的变量
+const CodeReservedName = "reserved_name"
+
+// ErrReservedName 变量名与chap4的临时变量t1、t2……冲突
+var ErrReservedName = errors.New("variable name is reserved for chap4 temporaries")
+
+// tempName chap4语义分析生成的临时变量名
+var tempName = regexp.MustCompile(`^t[0-9]+$`)
+
+// Token chap4词法分析得到的单词，Position为它在表达式中的字节偏移
+type Token struct {
+	Class    string `json:"class"`
+	Value    string `json:"value"`
+	Position int    `json:"position"`
+}
+
+// Instruction 一条四元式及其三地址码形式（如"t1 = b + 2"），Value为执行后结果的值
+type Instruction struct {
+	Op     string           `json:"op"`
+	Arg1   string           `json:"arg1"`
+	Arg2   string           `json:"arg2"`
+	Result string           `json:"result"`
+	Text   string           `json:"text"`
+	Value  calculator.Value `json:"value"`
+}
+
+// Result 各阶段的结果：单词序列、语法树（analyzer.JSON的形式）与执行过的四元式；
+// 赋值时编译的是=之后的部分，语法树中单词的位置是相对于这一部分的chap4行列号
+type Result struct {
+	Value  calculator.Value `json:"value"`
+	Target string           `json:"target,omitempty"`
+	Tokens []Token          `json:"tokens"`
+	Tree   json.RawMessage  `json:"tree"`
+	Code   []Instruction    `json:"code"`
+}
+
+// Eval 在env中对表达式求值，形如"名字 = 表达式"时将值赋给变量，env为nil时赋值不被保存；
+// env中的变量都声明为int。编译或执行出错时返回*calculator.Error，Code为chap4的诊断错误码（如E0201）
+// 或计算器的错误码，Position为表达式中的字节偏移
+func Eval(e *calculator.Evaluator, expression string, env calculator.Env) (*Result, error) {
+	target, offset := calculator.Target(expression), 0
+	if target != "" {
+		offset = strings.IndexByte(expression, '=') + 1
+	}
+	source := expression[offset:]
+	vars := env.Names()
+	compiled, diagnostics := compiler.CompileExpr([]byte(source), vars, compiler.Options{})
+	res := &Result{Target: target, Tokens: make([]Token, 0), Code: make([]Instruction, 0)}
+	for _, t := range compiled.Tokens {
+		res.Tokens = append(res.Tokens, Token{Class: lexer.ClassName(t.Class), Value: t.Value, Position: offset + position(source, t.Pos)})
+	}
+	for _, t := range res.Tokens {
+		if t.Class == lexer.ClassName(lexer.Identifier) && tempName.MatchString(t.Value) {
+			return nil, &calculator.Error{Err: ErrReservedName, Code: CodeReservedName, Message: ErrReservedName.Error() + " (" + t.Value + ")", Position: t.Position}
+		}
+	}
+	tree, err := analyzer.JSON(compiled.Tree)
+	if err != nil {
+		return nil, err
+	}
+	res.Tree = tree
+	for _, d := range diagnostics {
+		if d.Severity == compiler.SeverityError {
+			return nil, &calculator.Error{Code: d.Code, Message: string(d.Phase) + ": " + d.Message, Position: offset + position(source, d.Pos)}
+		}
+	}
+	m := &machine{evaluator: e, env: env, temps: make(map[string]calculator.Value)}
+	for _, q := range compiled.IR {
+		v, err := m.exec(q, offset+position(source, q.Span().Start))
+		if err != nil {
+			return nil, err
+		}
+		res.Code = append(res.Code, Instruction{
+			Op:     q.Op(),
+			Arg1:   q.Arg1(),
+			Arg2:   q.Arg2(),
+			Result: q.Result(),
+			Text:   q.Result() + " = " + q.Arg1() + " " + q.Op() + " " + q.Arg2(),
+			Value:  v,
+		})
+	}
+	if res.Value, err = m.load(compiled.Value, offset+position(source, compiled.Tree.Span().Start)); err != nil {
+		return nil, err
+	}
+	if target != "" && env != nil {
+		env[target] = res.Value
+	}
+	return res, nil
+}
+
+// machine 执行四元式，临时变量保存在temps中，其它变量从env中读取
+type machine struct {
+	evaluator *calculator.Evaluator
+	env       calculator.Env
+	temps     map[string]calculator.Value
+}
+
+// exec 执行一条四元式，运算出错时报告在表达式的位置pos，即四元式的运算符
+func (m *machine) exec(q *semantic.Quadruple, pos int) (calculator.Value, error) {
+	x, err := m.load(q.Arg1(), pos)
+	if err != nil {
+		return calculator.Value{}, err
+	}
+	y, err := m.load(q.Arg2(), pos)
+	if err != nil {
+		return calculator.Value{}, err
+	}
+	v, err := m.evaluator.Operate(q.Op()[0], x, y, pos)
+	if err != nil {
+		return calculator.Value{}, err
+	}
+	m.temps[q.Result()] = v
+	return v, nil
+}
+
+// load 取常数、临时变量或变量的值
+func (m *machine) load(arg string, pos int) (calculator.Value, error) {
+	if semantic.IsConst(arg) {
+		return m.evaluator.Number(arg, pos)
+	}
+	if v, ok := m.temps[arg]; ok {
+		return v, nil
+	}
+	return m.evaluator.Convert(m.env[arg]), nil
+}
+
+// position 将chap4的行列位置转换为source中的字节偏移
+func position(source string, pos lexer.Position) int {
+	if !pos.IsValid() {
+		return 0
+	}
+	offset := 0
+	for line := 1; line < pos.Line; line++ {
+		offset += strings.IndexByte(source[offset:], '\n') + 1
+	}
+	return offset + pos.Column - 1
+}
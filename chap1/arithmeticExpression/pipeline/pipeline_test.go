@@ -0,0 +1,113 @@
+package pipeline
+
+import (
+	"arithmeticExpression/calculator"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	env := calculator.Env{}
+	e := calculator.NewEvaluator()
+	if _, err := e.EvalIn("a = 3", env); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		expression string
+		want       string
+		code       []string
+	}{
+		{"a*(b+2)-3", "", nil},
+		{"b = 4", "4", nil},
+		{"a*(b+2)-3", "15", []string{"t1 = b + 2", "t2 = a * t1", "t3 = t2 - 3"}},
+		{"-a + 10", "7", []string{"t1 = a * -1", "t2 = t1 + 10"}},
+		{"7 / 2", "3.5", []string{"t1 = 7 / 2"}},
+		{"c = (a + b) * -2", "-14", []string{"t1 = a + b", "t2 = t1 * -2"}},
+		{"c", "-14", []string{}},
+	}
+	for _, test := range tests {
+		res, err := Eval(e, test.expression, env)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("Eval(%q) = %v, want an error", test.expression, res.Value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Eval(%q) error = %v", test.expression, err)
+			continue
+		}
+		if res.Value.String() != test.want {
+			t.Errorf("Eval(%q) = %v, want %s", test.expression, res.Value, test.want)
+		}
+		if test.code == nil {
+			continue
+		}
+		code := make([]string, len(res.Code))
+		for i, ins := range res.Code {
+			code[i] = ins.Text
+		}
+		if strings.Join(code, "; ") != strings.Join(test.code, "; ") {
+			t.Errorf("Eval(%q) code = %q, want %q", test.expression, code, test.code)
+		}
+	}
+	res, err := Eval(calculator.NewExactEvaluator(), "1/3 + c/3", env)
+	if err != nil || res.Value.String() != "-13/3" {
+		t.Errorf("Eval(1/3 + c/3) = %v, %v, want -13/3", res, err)
+	}
+}
+
+func TestEvalStages(t *testing.T) {
+	res, err := Eval(calculator.NewEvaluator(), "x = (12 + 3) * 2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tokens []string
+	for _, token := range res.Tokens {
+		tokens = append(tokens, fmt.Sprintf("%s@%d", token.Value, token.Position))
+	}
+	if got := strings.Join(tokens, " "); got != "(@4 12@5 +@8 3@10 )@11 *@13 2@15" {
+		t.Errorf("Tokens = %s", got)
+	}
+	if res.Tokens[0].Class != "Separator" || res.Tokens[1].Class != "IntConst" {
+		t.Errorf("Tokens = %+v", res.Tokens[:2])
+	}
+	if !strings.HasPrefix(string(res.Tree), `{"symbol":"<EXPR>"`) {
+		t.Errorf("Tree = %s", res.Tree)
+	}
+	if res.Target != "x" || res.Value.Float() != 30 {
+		t.Errorf("Eval() = %s = %v, want x = 30", res.Target, res.Value)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		code       string
+		position   int
+	}{
+		{"1 +", "E0202", 3},
+		{"1 2", "E0201", 2},
+		{"y = (1 + z)", "E0301", 9},
+		{"1.5", "E0101", 1},
+		{"2 / (1 - 1)", calculator.CodeDivisionByZero, 2},
+		{"y = 1 + 4 / (2 - 2)", calculator.CodeDivisionByZero, 10},
+		{"t1 + t1*2", CodeReservedName, 0},
+		{"x = 3 * t12", CodeReservedName, 8},
+	}
+	//会话中的t1与临时变量t1同名，不能在表达式中使用
+	env := calculator.Env{"t1": calculator.NewFloat(5)}
+	for _, test := range tests {
+		_, err := Eval(calculator.NewEvaluator(), test.expression, env)
+		var evalErr *calculator.Error
+		if !errors.As(err, &evalErr) {
+			t.Errorf("Eval(%q) error = %v, want *calculator.Error", test.expression, err)
+			continue
+		}
+		if evalErr.Code != test.code || evalErr.Position != test.position {
+			t.Errorf("Eval(%q) error = %s at %d (%s), want %s at %d", test.expression, evalErr.Code, evalErr.Position, evalErr.Message, test.code, test.position)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Package plot 对含自变量x的表达式采样，并画成带坐标轴与刻度的SVG折线图
+//
+// 函数在某点超出定义域、除以零或溢出时该点没有定义，折线在此断开；
+// 相邻两点之间的跳跃过大且中点的值不在两点之间时（如1/x、tan(x)的渐近线附近）也视为间断。
+package plot
+
+import (
+	"arithmeticExpression/calculator"
+	"errors"
+	"math"
+	"sort"
+)
+
+// Point 一个采样点，Defined为false时函数在该点没有定义；有定义的点Break为true时不与前一个点相连
+type Point struct {
+	X       float64
+	Y       float64
+	Defined bool
+	Break   bool
+}
+
+// pointErrors 只使函数在某一点没有定义的错误，其它错误（如语法错误）与x无关
+var pointErrors = map[string]bool{
+	calculator.CodeDomain:         true,
+	calculator.CodeDivisionByZero: true,
+	calculator.CodeOverflow:       true,
+}
+
+// Variable 自变量的名字
+const Variable = "x"
+
+// jumpRatio 相邻两点之差超过y的范围的这一比例时检查是否间断
+const jumpRatio = 0.25
+
+// Sample 在[from, to]上等距取n个点（n至少为2）对表达式求值，env中x以外的变量可以在表达式中使用；
+// 与x无关的错误直接返回*calculator.Error
+func Sample(e *calculator.Evaluator, expression string, env calculator.Env, from, to float64, n int) ([]Point, error) {
+	s := &sampler{evaluator: e, expression: expression, env: make(calculator.Env, len(env)+1)}
+	for name, v := range env {
+		s.env[name] = v
+	}
+	points := make([]Point, n)
+	for i := range points {
+		x := from + (to-from)*float64(i)/float64(n-1)
+		y, ok, err := s.eval(x)
+		if err != nil {
+			return nil, err
+		}
+		points[i] = Point{X: x, Y: y, Defined: ok, Break: ok && i > 0 && !points[i-1].Defined}
+	}
+	lo, hi := yRange(points)
+	for i := 1; i < n; i++ {
+		p, q := points[i-1], points[i]
+		if !p.Defined || !q.Defined || math.Abs(q.Y-p.Y) <= jumpRatio*(hi-lo) {
+			continue
+		}
+		y, ok, err := s.eval((p.X + q.X) / 2)
+		if err != nil {
+			return nil, err
+		}
+		if !ok || y < math.Min(p.Y, q.Y) || y > math.Max(p.Y, q.Y) {
+			points[i].Break = true
+		}
+	}
+	return points, nil
+}
+
+// sampler 在不同的x上对同一个表达式求值
+type sampler struct {
+	evaluator  *calculator.Evaluator
+	expression string
+	env        calculator.Env
+}
+
+// eval 求x处的值，函数在x处没有定义时ok为false
+func (s *sampler) eval(x float64) (y float64, ok bool, err error) {
+	s.env[Variable] = calculator.NewFloat(x)
+	v, err := s.evaluator.EvalIn(s.expression, s.env)
+	if err != nil {
+		var evalErr *calculator.Error
+		if errors.As(err, &evalErr) && pointErrors[evalErr.Code] {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return v.Float(), true, nil
+}
+
+// yRange 自动选择y的范围：去掉两端各2%的点后向外扩展，但不超过全部点的范围，
+// 使1/x这样在个别点上很大的函数不至于把其余部分压成一条直线
+func yRange(points []Point) (lo, hi float64) {
+	var ys []float64
+	for _, p := range points {
+		if p.Defined {
+			ys = append(ys, p.Y)
+		}
+	}
+	if len(ys) == 0 {
+		return -1, 1
+	}
+	sort.Float64s(ys)
+	low, high := ys[len(ys)*2/100], ys[(len(ys)-1)*98/100]
+	r := high - low
+	lo = math.Max(ys[0], low-r/4)
+	hi = math.Min(ys[len(ys)-1], high+r/4)
+	if lo == hi {
+		d := math.Max(math.Abs(lo)/10, 1)
+		lo, hi = lo-d, hi+d
+	}
+	return lo, hi
+}
@@ -0,0 +1,80 @@
+package plot
+
+import (
+	"arithmeticExpression/calculator"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSample(t *testing.T) {
+	e := calculator.NewEvaluator()
+	//1/x在0处没有定义，在0两侧间断
+	points, err := Sample(e, "1/x", nil, -1, 1, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if points[5].Defined || !points[6].Break {
+		t.Errorf("1/x at 0: %+v, next %+v", points[5], points[6])
+	}
+	//采样点不含0时由中点判断间断
+	points, err = Sample(e, "1/x", nil, -1, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range points {
+		if !p.Defined || p.Break != (i == 5) {
+			t.Errorf("1/x point %d = %+v", i, p)
+		}
+	}
+	//sqrt(x)在x<0时没有定义，连续的部分不断开
+	points, err = Sample(e, "sqrt(x) + a", calculator.Env{"a": calculator.NewFloat(1)}, -2, 2, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range points {
+		if p.Defined != (i >= 2) || p.Break != (i == 2) {
+			t.Errorf("sqrt(x) point %d = %+v", i, p)
+		}
+	}
+	if points[4].Y != 1+1.4142135623730951 {
+		t.Errorf("sqrt(2) + a = %v", points[4].Y)
+	}
+	//与x无关的错误直接返回
+	for expression, code := range map[string]string{
+		"sin(x": calculator.CodeUnmatchedParenthesis,
+		"()":    calculator.CodeOperandMissing,
+	} {
+		_, err = Sample(e, expression, nil, 0, 1, 5)
+		var evalErr *calculator.Error
+		if !errors.As(err, &evalErr) || evalErr.Code != code {
+			t.Errorf("%s: error = %v, want %s", expression, err, code)
+		}
+	}
+}
+
+func TestSVG(t *testing.T) {
+	points, err := Sample(calculator.NewEvaluator(), "1/x", nil, -1, 1, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg := string(SVG(points, Options{Width: 640, Height: 400, Title: "y = 1/x & <x>"}))
+	if !strings.HasPrefix(svg, "<svg") || !strings.Contains(svg, "y = 1/x &amp; &lt;x&gt;") {
+		t.Errorf("SVG = %s", svg)
+	}
+	start := strings.Index(svg, `<path d="`) + len(`<path d="`)
+	d := svg[start : start+strings.IndexByte(svg[start:], '"')]
+	if strings.Count(d, "M") != 2 || strings.Count(d, "L") != 8 {
+		t.Errorf("path = %s", d)
+	}
+}
+
+func TestTicks(t *testing.T) {
+	set := ticks(-1.05, 1.05, 5)
+	if got := len(set.values); set.step != 0.5 || got != 5 {
+		t.Errorf("ticks(-1.05, 1.05) = %v, step %v", set.values, set.step)
+	}
+	if set.label(set.values[2]) != "0.0" || set.label(set.values[4]) != "1.0" {
+		t.Errorf("labels = %q, %q", set.label(set.values[2]), set.label(set.values[4]))
+	}
+}
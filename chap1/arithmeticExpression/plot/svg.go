@@ -0,0 +1,160 @@
+package plot
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 图的四周留给刻度与标题的空白
+const (
+	marginLeft   = 56
+	marginRight  = 16
+	marginTop    = 28
+	marginBottom = 32
+)
+
+// Options 图的选项，YMin与YMax为nil时自动选择y的范围，Title显示在图的上方
+type Options struct {
+	Width  int
+	Height int
+	YMin   *float64
+	YMax   *float64
+	Title  string
+}
+
+// frame 数据坐标到SVG坐标的变换，(left, top)为绘图区的左上角
+type frame struct {
+	xlo, xhi, ylo, yhi float64
+	left, top          float64
+	width, height      float64
+}
+
+func (f *frame) sx(x float64) float64 {
+	return f.left + (x-f.xlo)/(f.xhi-f.xlo)*f.width
+}
+
+// sy 绘图区以外很远的点限制在绘图区上下各一个高度之内，避免过大的坐标，超出的部分会被裁掉
+func (f *frame) sy(y float64) float64 {
+	v := f.top + (f.yhi-y)/(f.yhi-f.ylo)*f.height
+	return math.Max(f.top-f.height, math.Min(f.top+2*f.height, v))
+}
+
+// SVG 将采样点画成折线图：浅色的网格、x=0与y=0处的坐标轴、边框上的刻度，
+// 没有定义的点与间断处折线断开
+func SVG(points []Point, opts Options) []byte {
+	f := &frame{
+		left:   marginLeft,
+		top:    marginTop,
+		width:  float64(opts.Width - marginLeft - marginRight),
+		height: float64(opts.Height - marginTop - marginBottom),
+	}
+	f.xlo, f.xhi = points[0].X, points[len(points)-1].X
+	f.ylo, f.yhi = yRange(points)
+	pad := (f.yhi - f.ylo) / 20
+	f.ylo, f.yhi = f.ylo-pad, f.yhi+pad
+	if opts.YMin != nil {
+		f.ylo = *opts.YMin
+	}
+	if opts.YMax != nil {
+		f.yhi = *opts.YMax
+	}
+	right, bottom := f.left+f.width, f.top+f.height
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n", opts.Width, opts.Height, opts.Width, opts.Height)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/>`+"\n", opts.Width, opts.Height)
+	fmt.Fprintf(&b, `<clipPath id="plot-area"><rect x="%.2f" y="%.2f" width="%.2f" height="%.2f"/></clipPath>`+"\n", f.left, f.top, f.width, f.height)
+
+	//网格与刻度
+	b.WriteString(`<g stroke="#eee">` + "\n")
+	xticks, yticks := ticks(f.xlo, f.xhi, f.width/80), ticks(f.ylo, f.yhi, f.height/50)
+	for _, x := range xticks.values {
+		fmt.Fprintf(&b, `<line x1="%.2f" y1="%.2f" x2="%.2f" y2="%.2f"/>`+"\n", f.sx(x), f.top, f.sx(x), bottom)
+	}
+	for _, y := range yticks.values {
+		fmt.Fprintf(&b, `<line x1="%.2f" y1="%.2f" x2="%.2f" y2="%.2f"/>`+"\n", f.left, f.sy(y), right, f.sy(y))
+	}
+	b.WriteString("</g>\n")
+	b.WriteString(`<g fill="#333">` + "\n")
+	for _, x := range xticks.values {
+		fmt.Fprintf(&b, `<line x1="%.2f" y1="%.2f" x2="%.2f" y2="%.2f" stroke="#333"/>`+"\n", f.sx(x), bottom, f.sx(x), bottom+4)
+		fmt.Fprintf(&b, `<text x="%.2f" y="%.2f" text-anchor="middle">%s</text>`+"\n", f.sx(x), bottom+16, xticks.label(x))
+	}
+	for _, y := range yticks.values {
+		fmt.Fprintf(&b, `<line x1="%.2f" y1="%.2f" x2="%.2f" y2="%.2f" stroke="#333"/>`+"\n", f.left-4, f.sy(y), f.left, f.sy(y))
+		fmt.Fprintf(&b, `<text x="%.2f" y="%.2f" text-anchor="end" dominant-baseline="middle">%s</text>`+"\n", f.left-6, f.sy(y), yticks.label(y))
+	}
+	b.WriteString("</g>\n")
+
+	//边框与坐标轴
+	fmt.Fprintf(&b, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" fill="none" stroke="#999"/>`+"\n", f.left, f.top, f.width, f.height)
+	if f.xlo <= 0 && 0 <= f.xhi {
+		fmt.Fprintf(&b, `<line x1="%.2f" y1="%.2f" x2="%.2f" y2="%.2f" stroke="#333"/>`+"\n", f.sx(0), f.top, f.sx(0), bottom)
+	}
+	if f.ylo <= 0 && 0 <= f.yhi {
+		fmt.Fprintf(&b, `<line x1="%.2f" y1="%.2f" x2="%.2f" y2="%.2f" stroke="#333"/>`+"\n", f.left, f.sy(0), right, f.sy(0))
+	}
+
+	//曲线，每一段连续的部分以M开始
+	var d strings.Builder
+	pen := false
+	for _, p := range points {
+		if !p.Defined {
+			pen = false
+			continue
+		}
+		cmd := "L"
+		if !pen || p.Break {
+			cmd = "M"
+		}
+		fmt.Fprintf(&d, "%s%.2f %.2f ", cmd, f.sx(p.X), f.sy(p.Y))
+		pen = true
+	}
+	fmt.Fprintf(&b, `<path d="%s" fill="none" stroke="#1976d2" stroke-width="1.5" stroke-linejoin="round" clip-path="url(#plot-area)"/>`+"\n", strings.TrimSpace(d.String()))
+	if opts.Title != "" {
+		fmt.Fprintf(&b, `<text x="%.2f" y="18" text-anchor="middle" font-size="13">%s</text>`+"\n", f.left+f.width/2, html.EscapeString(opts.Title))
+	}
+	b.WriteString("</svg>\n")
+	return []byte(b.String())
+}
+
+// tickSet 一个坐标轴上的刻度，step为相邻刻度之差
+type tickSet struct {
+	values []float64
+	step   float64
+}
+
+// ticks 在[lo, hi]上选取大约n个刻度，刻度之差为1、2或5乘以10的整数次方
+func ticks(lo, hi, n float64) tickSet {
+	if n < 2 {
+		n = 2
+	}
+	raw := (hi - lo) / n
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	step := magnitude * 10
+	for _, m := range []float64{1, 2, 5} {
+		if m*magnitude >= raw {
+			step = m * magnitude
+			break
+		}
+	}
+	set := tickSet{step: step}
+	for v := math.Ceil(lo/step) * step; v <= hi+step/1e6; v += step {
+		//消除累加的误差，0不显示为-0
+		v = math.Round(v/step) * step
+		if math.Abs(v) < step/1e6 {
+			v = 0
+		}
+		set.values = append(set.values, v)
+	}
+	return set
+}
+
+// label 刻度的文字，小数位数由刻度之差决定
+func (t tickSet) label(v float64) string {
+	digits := int(math.Max(0, -math.Floor(math.Log10(t.step))))
+	return strconv.FormatFloat(v, 'f', digits, 64)
+}
@@ -2,9 +2,12 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"log"
+	"os"
 	"strconv"
+	"strings"
 )
 
 type Stack[T byte | int] struct {
@@ -40,6 +43,9 @@ func (stack *Stack[T]) poll() T {
 var stack *Stack[byte]
 var priorityMap map[byte]int
 
+// variables 单个字母的变量及其值，在整个会话中保留
+var variables = make(map[byte]int)
+
 func init() {
 	stack = &Stack[byte]{
 		index: -1,
@@ -56,15 +62,19 @@ func init() {
 func main() {
 	scanExpression()
 }
+
+// scanExpression 逐行读入表达式，可以用"x = 3*4"给变量赋值，以后的表达式中可以使用x
 func scanExpression() {
-	var expression string
+	scanner := bufio.NewScanner(os.Stdin)
 	for {
 		fmt.Println("Please enter the expression：")
-		_, err := fmt.Scanln(&expression)
-		if err != nil {
-			log.Println(err)
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				log.Println(err)
+			}
 			return
 		}
+		expression := scanner.Text()
 		service(&expression)
 	}
 }
@@ -72,7 +82,13 @@ func service(expression *string) {
 	stack.index = -1
 	var buf []byte
 	i := 0
-	buf = []byte(*expression)
+	buf = []byte(strings.ReplaceAll(*expression, " ", ""))
+	//"x=表达式"：求出表达式的值后赋给x
+	var target byte
+	if len(buf) > 2 && isLetter(buf[0]) && buf[1] == '=' {
+		target = buf[0]
+		buf = buf[2:]
+	}
 	var res []byte
 	for i != len(buf) {
 		c := buf[i]
@@ -84,6 +100,15 @@ func service(expression *string) {
 			res = opService(c, res)
 		case '(':
 			stack.push('(')
+		default:
+			//变量与数一样直接进入后缀式，求值时再取它的值
+			if isLetter(c) {
+				if _, ok := variables[c]; !ok {
+					fmt.Println("undefined variable " + string(c))
+					return
+				}
+				res = append(res, c)
+			}
 		}
 
 	}
@@ -93,8 +118,16 @@ func service(expression *string) {
 
 	fmt.Println(string(res))
 	number := cal(res)
+	if target != 0 {
+		variables[target] = number
+		fmt.Printf("%c = %d\n", target, number)
+		return
+	}
 	fmt.Println(number)
 }
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
 func cal(res []byte) int {
 	numStack := &Stack[int]{
 		index: -1,
@@ -111,6 +144,10 @@ func cal(res []byte) int {
 			n1 := numStack.pop()
 			r := calNumber(n1, n2, c)
 			numStack.push(r)
+		default:
+			if isLetter(c) {
+				numStack.push(variables[c])
+			}
 		}
 	}
 	return numStack.pop()
@@ -2,22 +2,29 @@
 package main
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"log"
+	"os"
 	"strconv"
+	"strings"
 )
 
 var (
 	errorOperateNumberLack    = errors.New("cannot pop number from number stack")
 	errorRedundantNumber      = errors.New("redundant digital exist in the stack")
 	errorMatchLeftParenthesis = errors.New("cannot match (")
+	errorUndefinedVariable    = errors.New("undefined variable")
 )
 
 var opStack *Stack[byte]
 var numStack *Stack[int]
 var priorityMap map[byte]int
 
+// variables 单个字母的变量及其值，在整个会话中保留
+var variables = make(map[byte]int)
+
 type Stack[T byte | int] struct {
 	index int
 	data  []T
@@ -65,15 +72,19 @@ func init() {
 	priorityMap['('] = 0
 	priorityMap[')'] = 3
 }
+
+// scanExpression 逐行读入表达式，可以用"x = 3*4"给变量赋值，以后的表达式中可以使用x
 func scanExpression() {
-	var expression string
+	scanner := bufio.NewScanner(os.Stdin)
 	for {
 		fmt.Println("Please enter the expression：")
-		_, err := fmt.Scanln(&expression)
-		if err != nil {
-			log.Println(err)
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				log.Println(err)
+			}
 			return
 		}
+		expression := scanner.Text()
 		service(&expression)
 	}
 }
@@ -82,7 +93,13 @@ func service(expression *string) {
 	numStack.index = -1
 	var buf []byte
 	i := 0
-	buf = []byte(*expression)
+	buf = []byte(strings.ReplaceAll(*expression, " ", ""))
+	//"x=表达式"：求出表达式的值后赋给x
+	var target byte
+	if len(buf) > 2 && isLetter(buf[0]) && buf[1] == '=' {
+		target = buf[0]
+		buf = buf[2:]
+	}
 	var res int
 	for i != len(buf) {
 		c := buf[i]
@@ -99,6 +116,16 @@ func service(expression *string) {
 			}
 		case '(':
 			opStack.push('(')
+		default:
+			//变量的值与数一样压入数栈
+			if isLetter(c) {
+				v, ok := variables[c]
+				if !ok {
+					fmt.Println(errorUndefinedVariable.Error() + " " + string(c))
+					return
+				}
+				numStack.push(v)
+			}
 		}
 
 	}
@@ -122,8 +149,16 @@ func service(expression *string) {
 		return
 	}
 	res = numStack.data[0]
+	if target != 0 {
+		variables[target] = res
+		fmt.Printf("%c = %d\n", target, res)
+		return
+	}
 	fmt.Println(res)
 }
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
 func opService(op byte) error {
 	res := 0
 	if op == ')' {
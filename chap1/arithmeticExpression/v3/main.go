@@ -4,7 +4,17 @@ package main
 import "github.com/gin-gonic/gin"
 
 func main() {
+	newRouter().Run(":8081")
+}
+
+// newRouter 注册所有接口；Recovery使处理请求时的panic返回500，而不是断开连接
+func newRouter() *gin.Engine {
 	g := gin.New()
+	g.Use(gin.Recovery())
 	g.POST("/api/calculate", Calculate)
-	g.Run(":8081")
+	g.POST("/api/plot", Plot)
+	g.GET("/api/sessions", sessions.ListSessions)
+	g.GET("/api/sessions/:id", sessions.GetSession)
+	g.DELETE("/api/sessions/:id", sessions.DeleteSession)
+	return g
 }
@@ -0,0 +1,105 @@
+// Package main  @Author xiaobaiio 2023/3/11 16:54:00
+package main
+
+import (
+	"arithmeticExpression/calculator"
+	"arithmeticExpression/plot"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"math"
+	"net/http"
+)
+
+// 作图请求的默认值与范围
+const (
+	defaultSamples = 200
+	maxSamples     = 5000
+	defaultWidth   = 640
+	defaultHeight  = 400
+	minSize        = 100
+	maxSize        = 4000
+)
+
+// PlotRequest 画出表达式在[from, to]上的图像，自变量为x；带session时可以使用该会话中的变量；
+// samples为采样点数，yMin、yMax省略时自动选择y的范围，width、height为图的像素大小
+type PlotRequest struct {
+	Expression string   `json:"expression"`
+	From       float64  `json:"from"`
+	To         float64  `json:"to"`
+	Samples    int      `json:"samples"`
+	YMin       *float64 `json:"yMin"`
+	YMax       *float64 `json:"yMax"`
+	Width      int      `json:"width"`
+	Height     int      `json:"height"`
+	Session    string   `json:"session"`
+}
+
+// validate 检查请求并填入默认值
+func (r *PlotRequest) validate() error {
+	for _, v := range []*float64{&r.From, &r.To, r.YMin, r.YMax} {
+		if v != nil && (math.IsNaN(*v) || math.IsInf(*v, 0)) {
+			return errors.New("from, to, yMin and yMax must be finite")
+		}
+	}
+	if r.From >= r.To {
+		return errors.New("from must be less than to")
+	}
+	if r.YMin != nil && r.YMax != nil && *r.YMin >= *r.YMax {
+		return errors.New("yMin must be less than yMax")
+	}
+	if r.Samples == 0 {
+		r.Samples = defaultSamples
+	}
+	if r.Samples < 2 || r.Samples > maxSamples {
+		return fmt.Errorf("samples must be between 2 and %d", maxSamples)
+	}
+	if r.Width == 0 {
+		r.Width = defaultWidth
+	}
+	if r.Height == 0 {
+		r.Height = defaultHeight
+	}
+	if r.Width < minSize || r.Width > maxSize || r.Height < minSize || r.Height > maxSize {
+		return fmt.Errorf("width and height must be between %d and %d", minSize, maxSize)
+	}
+	return nil
+}
+
+// Plot 请求不合法时返回400，表达式有与x无关的错误时返回422（与Calculate的错误格式相同），
+// 成功时返回image/svg+xml
+func Plot(c *gin.Context) {
+	var request PlotRequest
+	err := c.ShouldBindJSON(&request)
+	if err == nil {
+		err = request.validate()
+	}
+	if err != nil {
+		fail(c, http.StatusBadRequest, &ErrorBody{Code: CodeBadRequest, Message: err.Error(), Position: -1})
+		return
+	}
+	var points []plot.Point
+	if busy := sessions.Do(request.Session, func(env calculator.Env) {
+		points, err = plot.Sample(evaluator, request.Expression, env, request.From, request.To, request.Samples)
+	}); busy != nil {
+		fail(c, http.StatusServiceUnavailable, &ErrorBody{Code: CodeBusy, Message: busy.Error(), Position: -1})
+		return
+	}
+	if err != nil {
+		var evalErr *calculator.Error
+		if errors.As(err, &evalErr) {
+			fail(c, http.StatusUnprocessableEntity, &ErrorBody{Code: evalErr.Code, Message: evalErr.Message, Position: evalErr.Position})
+		} else {
+			fail(c, http.StatusInternalServerError, &ErrorBody{Code: CodeInternal, Message: err.Error(), Position: -1})
+		}
+		return
+	}
+	svg := plot.SVG(points, plot.Options{
+		Width:  request.Width,
+		Height: request.Height,
+		YMin:   request.YMin,
+		YMax:   request.YMax,
+		Title:  "y = " + request.Expression,
+	})
+	c.Data(http.StatusOK, "image/svg+xml; charset=utf-8", svg)
+}
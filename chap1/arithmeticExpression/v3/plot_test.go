@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPlot(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := newRouter()
+	tests := []struct {
+		body   string
+		status int
+		code   string
+	}{
+		{`{"expression":"1/x","from":-5,"to":5}`, http.StatusOK, ""},
+		{`{"expression":"()","from":-5,"to":5}`, http.StatusUnprocessableEntity, "operand_missing"},
+		{`{"expression":"sin(x","from":0,"to":1}`, http.StatusUnprocessableEntity, "unmatched_parenthesis"},
+		{`{"expression":"x","from":1,"to":1}`, http.StatusBadRequest, CodeBadRequest},
+		{`{"expression":"x","from":0,"to":1,"samples":1}`, http.StatusBadRequest, CodeBadRequest},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/plot", strings.NewReader(test.body)))
+		if w.Code != test.status {
+			t.Errorf("POST %s: status = %d, want %d", test.body, w.Code, test.status)
+			continue
+		}
+		if test.code == "" {
+			if !strings.HasPrefix(w.Header().Get("Content-Type"), "image/svg+xml") || !strings.HasPrefix(w.Body.String(), "<svg") {
+				t.Errorf("POST %s: %s %.40q", test.body, w.Header().Get("Content-Type"), w.Body.String())
+			}
+			continue
+		}
+		var response CalculateResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Error == nil || response.Error.Code != test.code {
+			t.Errorf("POST %s: body = %s, want error %s", test.body, w.Body.String(), test.code)
+		}
+	}
+}
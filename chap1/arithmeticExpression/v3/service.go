@@ -2,209 +2,163 @@
 package main
 
 import (
+	"arithmeticExpression/calculator"
+	"arithmeticExpression/pipeline"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"log"
 	"net/http"
-	"strconv"
 )
 
+// evaluator与exactEvaluator 没有可变状态，所有请求共用
 var (
-	errorOperateNumberLack    = errors.New("cannot pop number from number stack")
-	errorRedundantNumber      = errors.New("redundant digital exist in the stack")
-	errorMatchLeftParenthesis = errors.New("cannot match (")
+	evaluator      = calculator.NewEvaluator()
+	exactEvaluator = calculator.NewExactEvaluator()
 )
 
-var opStack *Stack[byte]
-var numStack *Stack[int]
-var priorityMap map[byte]int
+// maxDigits 请求中digits的上限
+const maxDigits = 1000
 
-type Stack[T byte | int] struct {
-	index int
-	data  []T
-}
+// sessions 各会话的变量
+var sessions = NewSessionStore(sessionTTL, maxSessions)
 
-func (stack *Stack[T]) push(v T) {
-	stack.index++
-	if len(stack.data) < stack.index+1 {
-		stack.data = append(stack.data, v)
-		return
+func service(request *CalculateRequest, env calculator.Env) (*CalculateResponse, error) {
+	log.Println(request.Expression)
+	e := evaluator
+	if request.Exact {
+		e = exactEvaluator
 	}
-	stack.data[stack.index] = v
-}
-
-func (stack *Stack[T]) pop() (T, bool) {
-	if stack.index >= 0 {
-		v := stack.data[stack.index]
-		stack.index--
-		return v, true
-	}
-	return 0, false
-}
-func (stack *Stack[T]) poll() T {
-	if stack.index >= 0 {
-		v := stack.data[stack.index]
-		return v
+	if request.Engine == EngineChap4 {
+		res, err := pipeline.Eval(e, request.Expression, env)
+		if err != nil {
+			fmt.Println(err.Error())
+			return nil, err
+		}
+		fmt.Println(res.Value)
+		return &CalculateResponse{OK: true, Value: &res.Value, Compiler: res}, nil
 	}
-	return 0
-}
-
-func init() {
-	opStack = &Stack[byte]{
-		index: -1,
-		data:  []byte{},
+	opts := calculator.Options{Postfix: request.Notation == NotationPostfix, Tree: request.Forms, Trace: request.Trace}
+	res, err := e.Evaluate(request.Expression, env, opts)
+	if err != nil {
+		fmt.Println(err.Error())
+		return nil, err
 	}
-	numStack = &Stack[int]{
-		index: -1,
-		data:  []int{},
+	fmt.Println(res.Value)
+	response := &CalculateResponse{OK: true, Value: &res.Value, Steps: res.Steps}
+	if res.Tree != nil {
+		response.Infix = res.Tree.Infix()
+		response.Postfix = res.Tree.Postfix()
+		response.Prefix = res.Tree.Prefix()
+		response.Tree = res.Tree
 	}
-	priorityMap = make(map[byte]int)
-	priorityMap['+'] = 1
-	priorityMap['-'] = 1
-	priorityMap['*'] = 2
-	priorityMap['/'] = 2
-	priorityMap['('] = 0
-	priorityMap[')'] = 3
+	return response, nil
 }
-func service(expression string) (int, error) {
-	log.Println(expression)
-	opStack.index = -1
-	numStack.index = -1
-	var buf []byte
-	i := 0
-	buf = []byte(expression)
-	var res int
-	for i != len(buf) {
-		c := buf[i]
-		i++
-		switch c {
-		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-			num, _ := strconv.Atoi(string(c))
-			numStack.push(num)
-		case '+', '-', '*', '/', ')':
-			err := opService(c)
-			if err != nil {
-				fmt.Println(err.Error())
-				return 0, err
-			}
-		case '(':
-			opStack.push('(')
-		}
 
-	}
-	for opStack.index != -1 {
-		c, ok := opStack.pop()
-		n2, ok := numStack.pop()
-		if !ok {
-			fmt.Println(errorOperateNumberLack.Error())
-			return 0, errorOperateNumberLack
-		}
-		n1, ok := numStack.pop()
-		if !ok {
-			fmt.Println(errorOperateNumberLack.Error())
-			return 0, errorOperateNumberLack
+// 求值使用的引擎
+const (
+	EngineCalculator = "calculator" // 双栈算法，默认
+	EngineChap4      = "chap4"      // 第四章的编译器：词法分析、语法分析、生成四元式后执行
+)
 
-		}
-		res = cal(n1, n2, c)
-		numStack.push(res)
-	}
-	if numStack.index != 0 {
-		fmt.Println(errorRedundantNumber.Error())
-		return 0, errorRedundantNumber
+// 请求中表达式的写法
+const (
+	NotationInfix   = "infix"   // 中缀式，默认
+	NotationPostfix = "postfix" // 后缀式（逆波兰式），如"3 4 + 2 *"
+)
 
-	}
-	res = numStack.data[0]
-	fmt.Println(res)
-	return res, nil
-}
-func opService(op byte) error {
-	res := 0
-	if op == ')' {
-		c, ok := opStack.pop()
-		if !ok {
-			return errorMatchLeftParenthesis
-		}
-		for c != '(' {
-			n2, ok := numStack.pop()
-			if !ok {
-				return errorOperateNumberLack
-			}
-			n1, ok := numStack.pop()
-			if !ok {
-				return errorOperateNumberLack
-			}
-			res = cal(n1, n2, c)
-			numStack.push(res)
-			c, ok = opStack.pop()
-			if !ok {
-				return errorMatchLeftParenthesis
-			}
-		}
-	} else {
-		ok := comparePriority(op)
-		if ok {
-			opStack.push(op)
-		} else {
-			c, ok := opStack.pop()
-			if !ok {
-				return errorMatchLeftParenthesis
-			}
-			n2, ok := numStack.pop()
-			if !ok {
-				return errorOperateNumberLack
-			}
-			n1, ok := numStack.pop()
-			if !ok {
-				return errorOperateNumberLack
-			}
-			res = cal(n1, n2, c)
-			numStack.push(res)
-			opStack.push(op)
-		}
-	}
-	return nil
+// CalculateRequest 表达式可以是"x = 3*4"形式的赋值；带session时变量保存在该会话中，供以后的请求使用；
+// exact为true时用有理数精确计算，digits大于0时响应中带有小数点后digits位的小数形式；
+// notation为表达式的写法，forms为true时响应中带有表达式的中缀式、后缀式、前缀式与表达式树，
+// trace为true时响应中带有求值的每一步；engine为chap4时用第四章的编译器求值，
+// 响应中带有单词序列、语法树与四元式，此时只支持中缀式，不支持forms与trace
+type CalculateRequest struct {
+	Expression string `json:"expression"`
+	Session    string `json:"session"`
+	Exact      bool   `json:"exact"`
+	Digits     int    `json:"digits"`
+	Notation   string `json:"notation"`
+	Forms      bool   `json:"forms"`
+	Trace      bool   `json:"trace"`
+	Engine     string `json:"engine"`
 }
-func cal(n1, n2 int, op byte) int {
-	res := 0
-	switch op {
-	case '+':
-		res = n1 + n2
-	case '-':
-		res = n1 - n2
-	case '*':
-		res = n1 * n2
-	case '/':
-		res = n1 / n2
-	}
-	return res
+
+// CalculateResponse 所有响应的统一格式，成功时error为null，失败时value为null；
+// 精确模式下value是"2/3"形式的字符串
+type CalculateResponse struct {
+	OK       bool              `json:"ok"`
+	Value    *calculator.Value `json:"value"`
+	Decimal  string            `json:"decimal,omitempty"`
+	Infix    string            `json:"infix,omitempty"`
+	Postfix  string            `json:"postfix,omitempty"`
+	Prefix   string            `json:"prefix,omitempty"`
+	Tree     *calculator.Node  `json:"tree,omitempty"`
+	Steps    []calculator.Step `json:"steps,omitempty"`
+	Compiler *pipeline.Result  `json:"compiler,omitempty"`
+	Error    *ErrorBody        `json:"error"`
 }
-func comparePriority(op byte) bool {
-	if opStack.index == -1 {
-		return true
-	} else {
-		pop := opStack.poll()
-		if priorityMap[op] <= priorityMap[pop] {
-			return false
-		} else {
-			return true
-		}
-	}
+
+// ErrorBody 错误的详细信息，position为出错处在表达式中的字节偏移，与表达式无关的错误为-1
+type ErrorBody struct {
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	Position int    `json:"position"`
 }
 
-type CalculateRequest struct {
-	Expression string `json:"expression"`
+// 与表达式无关的错误码
+const (
+	CodeBadRequest = "bad_request" // 请求本身不是合法的JSON
+	CodeInternal   = "internal"    // 求值器返回了未分类的错误
+	CodeNoSession  = "no_session"  // 会话不存在或已过期
+	CodeBusy       = "busy"        // 会话数已达到上限
+)
+
+func fail(c *gin.Context, status int, body *ErrorBody) {
+	c.JSON(status, CalculateResponse{OK: false, Error: body})
 }
 
+// Calculate 请求无法解析时返回400，表达式有错误时返回422，成功时返回200
 func Calculate(c *gin.Context) {
 	var request CalculateRequest
 	err := c.ShouldBindJSON(&request)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, err.Error())
+		fail(c, http.StatusBadRequest, &ErrorBody{Code: CodeBadRequest, Message: err.Error(), Position: -1})
+		return
+	}
+	if request.Digits < 0 || request.Digits > maxDigits {
+		fail(c, http.StatusBadRequest, &ErrorBody{Code: CodeBadRequest, Message: fmt.Sprintf("digits must be between 0 and %d", maxDigits), Position: -1})
+		return
+	}
+	if request.Notation != "" && request.Notation != NotationInfix && request.Notation != NotationPostfix {
+		fail(c, http.StatusBadRequest, &ErrorBody{Code: CodeBadRequest, Message: "notation must be infix or postfix", Position: -1})
+		return
+	}
+	switch {
+	case request.Engine != "" && request.Engine != EngineCalculator && request.Engine != EngineChap4:
+		fail(c, http.StatusBadRequest, &ErrorBody{Code: CodeBadRequest, Message: "engine must be calculator or chap4", Position: -1})
+		return
+	case request.Engine == EngineChap4 && request.Notation == NotationPostfix:
+		fail(c, http.StatusBadRequest, &ErrorBody{Code: CodeBadRequest, Message: "the chap4 engine only accepts infix expressions", Position: -1})
+		return
+	}
+	var response *CalculateResponse
+	if busy := sessions.Do(request.Session, func(env calculator.Env) {
+		response, err = service(&request, env)
+	}); busy != nil {
+		fail(c, http.StatusServiceUnavailable, &ErrorBody{Code: CodeBusy, Message: busy.Error(), Position: -1})
+		return
 	}
-	res, err := service(request.Expression)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, err.Error())
+		var evalErr *calculator.Error
+		if errors.As(err, &evalErr) {
+			fail(c, http.StatusUnprocessableEntity, &ErrorBody{Code: evalErr.Code, Message: evalErr.Message, Position: evalErr.Position})
+		} else {
+			fail(c, http.StatusInternalServerError, &ErrorBody{Code: CodeInternal, Message: err.Error(), Position: -1})
+		}
+		return
+	}
+	if request.Digits > 0 {
+		response.Decimal = response.Value.Decimal(request.Digits)
 	}
-	c.JSON(http.StatusOK, res)
+	c.JSON(http.StatusOK, response)
 }
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// calculate 发送一个计算请求，返回状态码与响应体中唯一的JSON对象的各个字段
+func calculate(t *testing.T, router *gin.Engine, body string) (int, map[string]json.RawMessage) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/calculate", strings.NewReader(body)))
+	dec := json.NewDecoder(bytes.NewReader(w.Body.Bytes()))
+	var fields map[string]json.RawMessage
+	if err := dec.Decode(&fields); err != nil {
+		t.Fatalf("POST %s: %v in %s", body, err, w.Body.String())
+	}
+	//出错时只能写一次响应，否则400之后还会跟着200的响应体
+	if err := dec.Decode(&json.RawMessage{}); err != io.EOF {
+		t.Fatalf("POST %s: more than one response body: %s", body, w.Body.String())
+	}
+	return w.Code, fields
+}
+
+func TestCalculate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := newRouter()
+	tests := []struct {
+		body   string
+		status int
+		value  string
+		code   string
+	}{
+		{`{"expression":"1+2*3"}`, http.StatusOK, "7", ""},
+		{`{"expression":"1/3","exact":true,"digits":3}`, http.StatusOK, `"1/3"`, ""},
+		{`{"expression":"3 4 + 2 *","notation":"postfix"}`, http.StatusOK, "14", ""},
+		{`{"expression":"1/4","engine":"chap4"}`, http.StatusOK, "0.25", ""},
+		{`{"expression":`, http.StatusBadRequest, "", CodeBadRequest},
+		{`{"expression":"1","digits":-1}`, http.StatusBadRequest, "", CodeBadRequest},
+		{`{"expression":"1","digits":1001}`, http.StatusBadRequest, "", CodeBadRequest},
+		{`{"expression":"1","notation":"prefix"}`, http.StatusBadRequest, "", CodeBadRequest},
+		{`{"expression":"1","engine":"llvm"}`, http.StatusBadRequest, "", CodeBadRequest},
+		{`{"expression":"1 2 +","engine":"chap4","notation":"postfix"}`, http.StatusBadRequest, "", CodeBadRequest},
+		{`{"expression":"4/(2-2)"}`, http.StatusUnprocessableEntity, "", "division_by_zero"},
+		{`{"expression":"()"}`, http.StatusUnprocessableEntity, "", "operand_missing"},
+	}
+	for _, test := range tests {
+		status, fields := calculate(t, router, test.body)
+		if status != test.status {
+			t.Errorf("POST %s: status = %d, want %d", test.body, status, test.status)
+			continue
+		}
+		if test.code == "" {
+			if string(fields["ok"]) != "true" || string(fields["value"]) != test.value || string(fields["error"]) != "null" {
+				t.Errorf("POST %s: ok = %s, value = %s, error = %s, want true, %s, null", test.body, fields["ok"], fields["value"], fields["error"], test.value)
+			}
+			continue
+		}
+		if string(fields["ok"]) != "false" || string(fields["value"]) != "null" {
+			t.Errorf("POST %s: ok = %s, value = %s, want false, null", test.body, fields["ok"], fields["value"])
+		}
+		var body ErrorBody
+		if err := json.Unmarshal(fields["error"], &body); err != nil || body.Code != test.code || body.Message == "" {
+			t.Errorf("POST %s: error = %s, want code %s", test.body, fields["error"], test.code)
+		}
+	}
+}
+
+// TestCalculatePosition 422的响应中带有出错处在表达式中的位置，与表达式无关的错误位置为-1
+func TestCalculatePosition(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := newRouter()
+	for body, want := range map[string]int{
+		`{"expression":"1 + 2 3"}`: 6,
+		`{"expression":"1 + abc"}`: 4,
+		`not json`:                 -1,
+	} {
+		_, fields := calculate(t, router, body)
+		var e ErrorBody
+		if err := json.Unmarshal(fields["error"], &e); err != nil || e.Position != want {
+			t.Errorf("POST %s: error = %s, want position %d", body, fields["error"], want)
+		}
+	}
+}
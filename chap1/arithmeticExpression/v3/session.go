@@ -0,0 +1,151 @@
+package main
+
+import (
+	"arithmeticExpression/calculator"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// sessionTTL 会话在最后一次使用之后保留的时间
+const sessionTTL = 30 * time.Minute
+
+// maxSessions 同时存在的会话数的上限，会话由客户端任意指定，不加限制会耗尽内存
+const maxSessions = 10000
+
+// ErrTooManySessions 会话数已达到上限，不能再创建新的会话
+var ErrTooManySessions = errors.New("too many sessions")
+
+// session 一个会话的变量，mu保证同一会话的请求依次求值
+type session struct {
+	mu       sync.Mutex
+	env      calculator.Env
+	lastUsed time.Time
+}
+
+// SessionStore 内存中的会话，按请求中的session字段区分，过期的会话在每次访问时清除
+type SessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+	ttl      time.Duration
+	max      int
+}
+
+// NewSessionStore 创建一个会话存储，会话在ttl内没有使用就被删除，最多同时保存max个会话
+func NewSessionStore(ttl time.Duration, max int) *SessionStore {
+	return &SessionStore{
+		sessions: make(map[string]*session),
+		ttl:      ttl,
+		max:      max,
+	}
+}
+
+// expire 删除过期的会话，调用时需要持有s.mu
+func (s *SessionStore) expire() {
+	now := time.Now()
+	for id, sess := range s.sessions {
+		if now.Sub(sess.lastUsed) > s.ttl {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// get 返回会话，不存在时创建，会话数已达到上限时返回ErrTooManySessions
+func (s *SessionStore) get(id string) (*session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+	sess, ok := s.sessions[id]
+	if !ok {
+		if len(s.sessions) >= s.max {
+			return nil, ErrTooManySessions
+		}
+		sess = &session{env: calculator.Env{}}
+		s.sessions[id] = sess
+	}
+	sess.lastUsed = time.Now()
+	return sess, nil
+}
+
+// Do 用会话的变量表调用f，同一会话的调用依次进行；id为空时使用一个临时的变量表。
+// 求值的时间有上限（如精确模式下乘方结果的位数），因此同一会话的请求不会被长时间阻塞
+func (s *SessionStore) Do(id string, f func(env calculator.Env)) error {
+	if id == "" {
+		f(calculator.Env{})
+		return nil
+	}
+	sess, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	f(sess.env)
+	return nil
+}
+
+// SessionInfo 会话的概要
+type SessionInfo struct {
+	ID        string    `json:"id"`
+	Variables int       `json:"variables"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Variable 会话中的一个变量
+type Variable struct {
+	Name  string           `json:"name"`
+	Value calculator.Value `json:"value"`
+}
+
+// ListSessions GET /api/sessions 列出所有未过期的会话；先在s.mu下取得会话的快照，
+// 再逐个锁住会话统计变量数，正在求值的会话不会阻塞其它请求对存储的访问
+func (s *SessionStore) ListSessions(c *gin.Context) {
+	s.mu.Lock()
+	s.expire()
+	infos := make([]SessionInfo, 0, len(s.sessions))
+	snapshot := make([]*session, 0, len(s.sessions))
+	for id, sess := range s.sessions {
+		infos = append(infos, SessionInfo{ID: id, ExpiresAt: sess.lastUsed.Add(s.ttl)})
+		snapshot = append(snapshot, sess)
+	}
+	s.mu.Unlock()
+	for i, sess := range snapshot {
+		sess.mu.Lock()
+		infos[i].Variables = len(sess.env)
+		sess.mu.Unlock()
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
+	})
+	c.JSON(http.StatusOK, infos)
+}
+
+// GetSession GET /api/sessions/:id 列出会话中的变量，会话不存在时返回404
+func (s *SessionStore) GetSession(c *gin.Context) {
+	s.mu.Lock()
+	s.expire()
+	sess, ok := s.sessions[c.Param("id")]
+	s.mu.Unlock()
+	if !ok {
+		fail(c, http.StatusNotFound, &ErrorBody{Code: CodeNoSession, Message: "no such session", Position: -1})
+		return
+	}
+	sess.mu.Lock()
+	variables := make([]Variable, 0, len(sess.env))
+	for _, name := range sess.env.Names() {
+		variables = append(variables, Variable{name, sess.env[name]})
+	}
+	sess.mu.Unlock()
+	c.JSON(http.StatusOK, variables)
+}
+
+// DeleteSession DELETE /api/sessions/:id 清除会话及其变量
+func (s *SessionStore) DeleteSession(c *gin.Context) {
+	s.mu.Lock()
+	delete(s.sessions, c.Param("id"))
+	s.mu.Unlock()
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"arithmeticExpression/calculator"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSessionStoreLimit(t *testing.T) {
+	s := NewSessionStore(time.Minute, 2)
+	for _, id := range []string{"a", "b", "a"} {
+		if err := s.Do(id, func(env calculator.Env) { env["x"] = calculator.NewFloat(1) }); err != nil {
+			t.Fatalf("Do(%q) error = %v", id, err)
+		}
+	}
+	if err := s.Do("c", func(calculator.Env) { t.Error("Do(c) called f") }); !errors.Is(err, ErrTooManySessions) {
+		t.Errorf("Do(c) error = %v, want %v", err, ErrTooManySessions)
+	}
+	//没有会话的请求不受上限的限制
+	if err := s.Do("", func(calculator.Env) {}); err != nil {
+		t.Errorf("Do(\"\") error = %v", err)
+	}
+}
+
+func TestSessionStoreExpire(t *testing.T) {
+	s := NewSessionStore(time.Millisecond, 1)
+	if err := s.Do("a", func(calculator.Env) {}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	//a已过期，为b腾出位置
+	if err := s.Do("b", func(calculator.Env) {}); err != nil {
+		t.Errorf("Do(b) error = %v", err)
+	}
+}
@@ -1,9 +1,21 @@
-import { Box, Typography, Stack, TextField, Grid, Button } from '@mui/material';
+import { Box, Typography, Stack, TextField, Grid, Button, Table, TableHead, TableBody, TableRow, TableCell, FormControlLabel, Switch } from '@mui/material';
 import { useState } from 'react';
-import { cal } from '../../api/calculator';
+import { cal, plot } from '../../api/calculator';
 const Main = () => {
     const [expression, setExpression] = useState("")
     const [result, setResult] = useState("")
+    // 表达式的后缀式与前缀式，显示表达式是如何被解析的
+    const [forms, setForms] = useState({ postfix: "", prefix: "" })
+    // 双栈算法求值的每一步：读入的单词、动作与两个栈的内容
+    const [steps, setSteps] = useState([])
+    // 打开时用第四章的编译器求值，显示单词序列与四元式
+    const [chap4, setChap4] = useState(false)
+    const [compiler, setCompiler] = useState(null)
+    // 同一页面的请求共用一个会话，变量在请求之间保留
+    const [session] = useState(() => crypto.randomUUID())
+    // 以x为自变量作图的范围与得到的SVG
+    const [range, setRange] = useState({ from: "-10", to: "10" })
+    const [graph, setGraph] = useState("")
     const op = ["%", "CE", "C", "del", "1/x", "x^2", "x^(1/2)", "÷", "7", "8", "9", "X", "4", "5", "6", "-", "1", "2", "3", "+", "+/-", "0", ".", "="]
     const change = (event) => {
         setExpression(event.target.value)
@@ -17,20 +29,44 @@ const Main = () => {
             case "÷":
                 v = "/"
             case "=":
-                let res = await cal({ expression })
-                setResult(res.data)
+                try {
+                    let res = await cal(chap4 ? { expression, session, engine: "chap4" } : { expression, session, forms: true, trace: true })
+                    setResult(res.data.value)
+                    setForms({ postfix: res.data.postfix || "", prefix: res.data.prefix || "" })
+                    setSteps(res.data.steps || [])
+                    setCompiler(res.data.compiler || null)
+                } catch (err) {
+                    setForms({ postfix: "", prefix: "" })
+                    setSteps([])
+                    setCompiler(null)
+                    // 422时为{ok, value, error:{code, message, position}}
+                    setResult(err.error ? `${err.error.message} (${err.error.position})` : err.message)
+                }
                 return
             default:
                 break;
         }
         setExpression(expression + v)
     }
+    const draw = async () => {
+        try {
+            let res = await plot({ expression, session, from: Number(range.from), to: Number(range.to) })
+            setGraph(res.data)
+        } catch (err) {
+            setGraph("")
+            // 422时响应是JSON文本，400时在err.response中
+            let body = typeof err === "string" ? JSON.parse(err) : err.response && JSON.parse(err.response.data)
+            setResult(body && body.error ? `${body.error.message} (${body.error.position})` : err.message)
+        }
+    }
     return (
         <Stack sx={{ width: "400px", height: "600px" }} justifyContent={"center"} alignItems={"center"} direction={"column"}>
             <Typography variant='h1'>计算器</Typography>
             <Box >
                 <Typography variant='h1' sx={{ width: "400px", height: "100px", textAlign: "right" }}>{result}</Typography>
                 <Typography variant='h1' sx={{ width: "400px", height: "100px", textAlign: "right" }}>{expression}</Typography>
+                <Typography variant='body2' sx={{ width: "400px", textAlign: "right" }}>后缀式：{forms.postfix}</Typography>
+                <Typography variant='body2' sx={{ width: "400px", textAlign: "right" }}>前缀式：{forms.prefix}</Typography>
             </Box>
             <Grid container spacing={1}>
                 {
@@ -41,6 +77,41 @@ const Main = () => {
                     })
                 }
             </Grid>
+            <FormControlLabel control={<Switch checked={chap4} onChange={(event) => setChap4(event.target.checked)} />} label="用第四章的编译器求值" />
+            <Stack direction={"row"} spacing={1} alignItems={"center"}>
+                <TextField size="small" label="x从" value={range.from} onChange={(event) => setRange({ ...range, from: event.target.value })} />
+                <TextField size="small" label="到" value={range.to} onChange={(event) => setRange({ ...range, to: event.target.value })} />
+                <Button variant="outlined" onClick={draw}>作图</Button>
+            </Stack>
+            {graph && <img alt={expression} width="400" src={`data:image/svg+xml;charset=utf-8,${encodeURIComponent(graph)}`} />}
+            {compiler && <Box sx={{ width: "400px" }}>
+                <Typography variant='body2'>单词：{compiler.tokens.map((t) => `(${t.class}, ${t.value})`).join(" ")}</Typography>
+                {compiler.code.map((q, i) => (
+                    <Typography key={i} variant='body2'>{`${i}: (${q.op}, ${q.arg1}, ${q.arg2}, ${q.result})    ${q.text}    = ${q.value}`}</Typography>
+                ))}
+            </Box>}
+            {steps.length > 0 && <Table size="small">
+                <TableHead>
+                    <TableRow>
+                        <TableCell>#</TableCell>
+                        <TableCell>单词</TableCell>
+                        <TableCell>动作</TableCell>
+                        <TableCell>运算符栈</TableCell>
+                        <TableCell>数栈</TableCell>
+                    </TableRow>
+                </TableHead>
+                <TableBody>
+                    {steps.map((step, i) => (
+                        <TableRow key={i}>
+                            <TableCell>{i + 1}</TableCell>
+                            <TableCell>{step.token}</TableCell>
+                            <TableCell>{step.action} {step.operator}</TableCell>
+                            <TableCell>{step.opStack.join(" ")}</TableCell>
+                            <TableCell>{step.numStack.join(" ")}</TableCell>
+                        </TableRow>
+                    ))}
+                </TableBody>
+            </Table>}
         </Stack >
     )
 }
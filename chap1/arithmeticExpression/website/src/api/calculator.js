@@ -3,4 +3,10 @@ export const cal = (data) => request({
     method: "post",
     url: "/calculate",
     data
-})
\ No newline at end of file
+})// plot 返回SVG文本，失败时（422）为JSON文本
+export const plot = (data) => request({
+    method: "post",
+    url: "/plot",
+    data,
+    responseType: "text"
+})
@@ -0,0 +1,26 @@
+// 运行由chap4编译器生成的WebAssembly模块
+// .wat需先用wat2wasm转换为.wasm，模块从env导入read、write并导出main
+// 运行出错时抛出的错误带有已经产生的输出output
+export const runWasm = async (bytes, input = []) => {
+    const output = []
+    let pos = 0
+    const env = {
+        read() {
+            if (pos >= input.length) {
+                throw new Error("runtime error: cannot read an integer")
+            }
+            return input[pos++] | 0
+        },
+        write(value) {
+            output.push(value)
+        }
+    }
+    const { instance } = await WebAssembly.instantiate(bytes, { env })
+    try {
+        instance.exports.main()
+    } catch (error) {
+        error.output = output
+        throw error
+    }
+    return output
+}
@@ -1,3 +1,7 @@
 module chap3
 
 go 1.19
+
+require golden v0.0.0
+
+replace golden => ../golden
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"golden"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGolden 对test/source下的每个sourceN.txt做词法分析，与test/target/targetN.txt比较
+func TestGolden(t *testing.T) {
+	if err := InitLexer(); err != nil {
+		t.Fatal(err)
+	}
+	sources, err := filepath.Glob("test/source/source*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) == 0 {
+		t.Fatal("no source files found in test/source")
+	}
+	for _, source := range sources {
+		source := source
+		n := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(source), "source"), ".txt")
+		goldenFile := filepath.Join("test", "target", "target"+n+".txt")
+		t.Run(filepath.Base(source), func(t *testing.T) {
+			src, err := os.ReadFile(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			//本章的词法分析器要求换行为\r\n，golden文件也是在这种换行下生成的
+			src = bytes.ReplaceAll(bytes.ReplaceAll(src, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n"))
+			lexer := NewLexer()
+			lexer.source = src
+			lexer.Run()
+			out := filepath.Join(t.TempDir(), "target.txt")
+			if err := lexer.WriteToFile(out); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden.Check(t, goldenFile, got)
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"chap3/analyzer"
+	"chap3/lexer"
+	"golden"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGolden 对test下的每个sourceN.txt做语法分析，将语法树与test/targetN.txt比较
+func TestGolden(t *testing.T) {
+	if err := lexer.InitLexer(); err != nil {
+		t.Fatal(err)
+	}
+	analyzer.InitAnalyzer()
+	sources, err := filepath.Glob("test/source*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) == 0 {
+		t.Fatal("no source files found in test")
+	}
+	for _, source := range sources {
+		source := source
+		n := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(source), "source"), ".txt")
+		goldenFile := filepath.Join("test", "target"+n+".txt")
+		t.Run(filepath.Base(source), func(t *testing.T) {
+			l := lexer.NewLexer()
+			if err := l.ReadFromFile(source); err != nil {
+				t.Fatal(err)
+			}
+			l.Run()
+			a := analyzer.NewAnalyzer(l.Target())
+			a.Analyse()
+			out := filepath.Join(t.TempDir(), "target.txt")
+			if err := a.PrintToFile(out); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden.Check(t, goldenFile, got)
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"testing"
+)
+
+// TestInitFileNames InitLexer读取的文件名与lexer/init下的文件名大小写必须一致，
+// 否则在大小写不敏感的文件系统上能运行，在Linux上会找不到文件
+func TestInitFileNames(t *testing.T) {
+	source, err := os.ReadFile("lexer/Lexer.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir("lexer/init")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]bool)
+	for _, entry := range entries {
+		files[entry.Name()] = true
+	}
+	names := regexp.MustCompile(`"/lexer/init/([^"]+)"`).FindAllSubmatch(source, -1)
+	if len(names) == 0 {
+		t.Fatal("no init files referenced in lexer/Lexer.go")
+	}
+	for _, name := range names {
+		if !files[string(name[1])] {
+			t.Errorf("lexer/Lexer.go reads %s, which is not in lexer/init", name[1])
+		}
+	}
+}
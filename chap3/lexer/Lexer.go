@@ -87,20 +87,20 @@ type Token struct {
 
 func InitLexer() error {
 	initPrefix, _ := os.Getwd()
-	keywords, err := os.ReadFile(initPrefix + "/lexer/init/Keyword.txt")
+	keywords, err := os.ReadFile(initPrefix + "/lexer/init/keyword.txt")
 	if err != nil {
-		log.Fatal("cannot read source code from file: ", "Keyword.txt")
+		log.Fatal("cannot read source code from file: ", "keyword.txt")
 		return err
 	}
 	keywordList = strings.Split(string(keywords), ",")
-	operatorList, err = os.ReadFile(initPrefix + "/lexer/init/Operator.txt")
+	operatorList, err = os.ReadFile(initPrefix + "/lexer/init/operator.txt")
 	if err != nil {
-		log.Fatal("cannot read source code from file: ", "Operator.txt")
+		log.Fatal("cannot read source code from file: ", "operator.txt")
 		return err
 	}
-	separatorList, err = os.ReadFile(initPrefix + "/lexer/init/Separator.txt")
+	separatorList, err = os.ReadFile(initPrefix + "/lexer/init/separator.txt")
 	if err != nil {
-		log.Fatal("cannot read source code from file: ", "Separator.txt")
+		log.Fatal("cannot read source code from file: ", "separator.txt")
 		return err
 	}
 	data, err := os.ReadFile(initPrefix + "/lexer/init/validOperator.txt")
@@ -3,6 +3,7 @@ package analyzer
 
 import (
 	"chap4/lexer"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -61,6 +62,8 @@ type Analyzer struct {
 	treeSource []string
 	root       *Node
 	err        error
+	tracer     *tracer
+	furthest   int // 读取过的最远单词的序号（从1开始），超过单词个数表示读到了结尾
 }
 
 func NewAnalyzer(source []*lexer.Token) *Analyzer {
@@ -94,23 +97,86 @@ func InitAnalyzer() {
 	ConstMap[STMT] = "<STMT>"
 	ConstMap[NEGA] = "<NEGA>"
 }
+
+// SyntaxError 语法错误，Index为出错单词的序号（从1开始），Token为出错的单词
+type SyntaxError struct {
+	Index int
+	Token *lexer.Token
+	msg   string
+}
+
+func (e *SyntaxError) Error() string {
+	return e.msg
+}
+
 func classError(class, index int) error {
-	return fmt.Errorf("unexpected Token Class: %v,Token index: %d", class, index)
+	return &SyntaxError{Index: index, msg: fmt.Sprintf("unexpected Token Class: %v,Token index: %d", class, index)}
 }
 func valueError(value string, index int) error {
-	return fmt.Errorf("unexpected Token value: %s,Token index: %d", value, index)
+	return &SyntaxError{Index: index, msg: fmt.Sprintf("unexpected Token value: %s,Token index: %d", value, index)}
 }
 func (a *Analyzer) Analyse() {
-	node, err := a.PROG()
+	a.finish(a.PROG())
+}
+
+// AnalyseExpr 把全部单词作为一个算术表达式分析，语法树的根为<EXPR>
+func (a *Analyzer) AnalyseExpr() {
+	a.finish(a.E())
+}
+
+// finish 记录分析的结果，根结点之后不能再有多余的单词
+func (a *Analyzer) finish(node *Node, err error) {
+	if err == nil && a.index < len(a.source) {
+		node, err = nil, valueError(a.source[a.index].Value, a.index+1)
+	}
+	if err != nil {
+		err = a.furthestError(err)
+	}
+	var syntaxErr *SyntaxError
+	if errors.As(err, &syntaxErr) && syntaxErr.Index > 0 && syntaxErr.Index <= len(a.source) {
+		syntaxErr.Token = a.source[syntaxErr.Index-1]
+	}
 	a.root = node
 	a.err = err
+	if a.tracer != nil {
+		a.tracer.finish(node, err)
+	}
+}
+
+// furthestError 回溯会把错误留在较早的单词上，例如{ int a; a = ; }中STMTS回溯后错误在a处，
+// 因此改为报告回溯之前读到的最远单词，读到结尾时报告EndErr
+func (a *Analyzer) furthestError(err error) error {
+	index := len(a.source) + 1
+	var syntaxErr *SyntaxError
+	if errors.As(err, &syntaxErr) {
+		index = syntaxErr.Index
+	}
+	switch {
+	case a.furthest <= index:
+		return err
+	case a.furthest > len(a.source):
+		return EndErr
+	default:
+		return valueError(a.source[a.furthest-1].Value, a.furthest)
+	}
+}
+
+// Err 返回语法分析过程中出现的错误，可能是*SyntaxError或EndErr
+func (a *Analyzer) Err() error {
+	return a.err
 }
 func (a *Analyzer) GetToken() bool {
+	if a.index+1 > a.furthest {
+		a.furthest = a.index + 1
+	}
 	if a.index >= len(a.source) {
 		return false
 	}
 	a.token = a.source[a.index]
 	a.index++
+	if a.tracer != nil {
+		a.tracer.consume(a.index-1, a.token)
+	}
 	return true
 }
 
@@ -124,8 +190,8 @@ func (a *Analyzer) GetToken() bool {
 // NEGA -> - F | F
 //F->id | number | (E)
 
-// E E->T E1
-func (a *Analyzer) E() (*Node, error) {
+// expr E->T E1
+func (a *Analyzer) expr() (*Node, error) {
 	node := &Node{
 		Class: EXPR,
 	}
@@ -142,8 +208,8 @@ func (a *Analyzer) E() (*Node, error) {
 	return node, nil
 }
 
-// E1 E1->ADDOP T E1 、E1-> 空
-func (a *Analyzer) E1() (*Node, error) {
+// expr1 E1->ADDOP T E1 、E1-> 空
+func (a *Analyzer) expr1() (*Node, error) {
 	node := &Node{
 		Class: EXPR1,
 	}
@@ -167,7 +233,7 @@ func (a *Analyzer) E1() (*Node, error) {
 }
 
 // T -> NEGA T1
-func (a *Analyzer) T() (*Node, error) {
+func (a *Analyzer) term() (*Node, error) {
 	node := &Node{
 		Class: TERM,
 	}
@@ -185,7 +251,7 @@ func (a *Analyzer) T() (*Node, error) {
 }
 
 // NEGA -> - F | F
-func (a *Analyzer) NEGA() (*Node, error) {
+func (a *Analyzer) nega() (*Node, error) {
 	node := &Node{Class: NEGA}
 	tempIndex := a.index
 	if ok := a.GetToken(); !ok {
@@ -203,10 +269,10 @@ func (a *Analyzer) NEGA() (*Node, error) {
 			minus.RightBro = f
 			return node, nil
 		} else {
-			a.index = tempIndex
+			a.backtrack(tempIndex)
 		}
 	default:
-		a.index = tempIndex
+		a.backtrack(tempIndex)
 	}
 	f, err := a.F()
 	if err != nil {
@@ -217,7 +283,7 @@ func (a *Analyzer) NEGA() (*Node, error) {
 }
 
 // T1 ->MULOP NEGA T1 | empty
-func (a *Analyzer) T1() (*Node, error) {
+func (a *Analyzer) term1() (*Node, error) {
 	node := &Node{
 		Class: TERM1,
 	}
@@ -242,7 +308,7 @@ func (a *Analyzer) T1() (*Node, error) {
 
 //F->id | number | (E)
 
-func (a *Analyzer) F() (*Node, error) {
+func (a *Analyzer) factor() (*Node, error) {
 	lastIndex := a.index
 	node := &Node{
 		Class: FACTOR,
@@ -270,7 +336,7 @@ func (a *Analyzer) F() (*Node, error) {
 			leftBracket := &Node{Class: LeftBracket, Token: a.token, IsTerminal: true}
 			e, err := a.E()
 			if err != nil {
-				a.index = lastIndex
+				a.backtrack(lastIndex)
 				return nil, err
 			}
 			if ok := a.GetToken(); !ok {
@@ -284,21 +350,21 @@ func (a *Analyzer) F() (*Node, error) {
 				e.RightBro = rightBracket
 				return node, nil
 			} else {
-				a.index = lastIndex
+				a.backtrack(lastIndex)
 				return nil, valueError(a.token.Value, a.index)
 			}
 		} else {
-			a.index = lastIndex
+			a.backtrack(lastIndex)
 			return nil, valueError(a.token.Value, a.index)
 		}
 	default:
-		a.index = lastIndex
+		a.backtrack(lastIndex)
 		return nil, classError(a.token.Class, a.index)
 	}
 }
 
-// AddOp ADDOP -> + | -
-func (a *Analyzer) AddOp() (*Node, error) {
+// addOp ADDOP -> + | -
+func (a *Analyzer) addOp() (*Node, error) {
 	lastIndex := a.index
 	node := &Node{
 		Class: ADDOP,
@@ -308,11 +374,11 @@ func (a *Analyzer) AddOp() (*Node, error) {
 
 	}
 	if a.token.Class != lexer.Operator {
-		a.index = lastIndex
+		a.backtrack(lastIndex)
 		return nil, classError(a.token.Class, a.index)
 	}
 	if len(a.token.Value) != 1 {
-		a.index = lastIndex
+		a.backtrack(lastIndex)
 		return nil, valueError(a.token.Value, a.index)
 	}
 	switch a.token.Value {
@@ -324,11 +390,11 @@ func (a *Analyzer) AddOp() (*Node, error) {
 		}
 		return node, nil
 	default:
-		a.index = lastIndex
+		a.backtrack(lastIndex)
 		return nil, valueError(a.token.Value, a.index)
 	}
 }
-func (a *Analyzer) MulOp() (*Node, error) {
+func (a *Analyzer) mulOp() (*Node, error) {
 	lastIndex := a.index
 	node := &Node{
 		Class: MULOP,
@@ -337,11 +403,11 @@ func (a *Analyzer) MulOp() (*Node, error) {
 		return nil, EndErr
 	}
 	if a.token.Class != lexer.Operator {
-		a.index = lastIndex
+		a.backtrack(lastIndex)
 		return nil, classError(a.token.Class, a.index)
 	}
 	if len(a.token.Value) != 1 {
-		a.index = lastIndex
+		a.backtrack(lastIndex)
 		return nil, valueError(a.token.Value, a.index)
 	}
 	switch a.token.Value {
@@ -353,7 +419,7 @@ func (a *Analyzer) MulOp() (*Node, error) {
 		}
 		return node, nil
 	default:
-		a.index = lastIndex
+		a.backtrack(lastIndex)
 		return nil, valueError(a.token.Value, a.index)
 	}
 }
@@ -366,7 +432,7 @@ func (a *Analyzer) MulOp() (*Node, error) {
 //ROP      →     >  |  >=  |  <  |  <=  |  ==  |   !=
 
 // BOOL    →    JOIN  ||  BOOL    |    JOIN
-func (a *Analyzer) BOOL() (*Node, error) {
+func (a *Analyzer) boolean() (*Node, error) {
 	node := &Node{Class: BOOL}
 	join, err := a.JOIN()
 	if err != nil {
@@ -375,7 +441,7 @@ func (a *Analyzer) BOOL() (*Node, error) {
 	node.LeftChild = join
 	tempIndex := a.index
 	if ok := a.GetToken(); !ok {
-		a.index = tempIndex
+		a.backtrack(tempIndex)
 		return nil, EndErr
 	}
 	switch a.token.Class {
@@ -384,24 +450,24 @@ func (a *Analyzer) BOOL() (*Node, error) {
 			or := &Node{Class: Operator, Token: a.token, IsTerminal: true}
 			boolvar, err := a.BOOL()
 			if err != nil {
-				a.index = tempIndex
+				a.backtrack(tempIndex)
 				return node, nil
 			}
 			join.RightBro = or
 			or.RightBro = boolvar
 			return node, nil
 		} else {
-			a.index = tempIndex
+			a.backtrack(tempIndex)
 			return node, nil
 		}
 	default:
-		a.index = tempIndex
+		a.backtrack(tempIndex)
 		return node, nil
 	}
 }
 
 // JOIN     →    NOT   &&   JOIN  |   NOT
-func (a *Analyzer) JOIN() (*Node, error) {
+func (a *Analyzer) join() (*Node, error) {
 	node := &Node{Class: JOIN}
 	not, err := a.NOT()
 	if err != nil {
@@ -418,24 +484,24 @@ func (a *Analyzer) JOIN() (*Node, error) {
 			and := &Node{Class: Operator, Token: a.token, IsTerminal: true}
 			join, err := a.JOIN()
 			if err != nil {
-				a.index = tempIndex
+				a.backtrack(tempIndex)
 				return node, nil
 			}
 			not.RightBro = and
 			and.RightBro = join
 			return node, nil
 		} else {
-			a.index = tempIndex
+			a.backtrack(tempIndex)
 			return node, nil
 		}
 	default:
-		a.index = tempIndex
+		a.backtrack(tempIndex)
 		return node, nil
 	}
 }
 
 // NOT      →    REL   |  ! REL | ! id | id
-func (a *Analyzer) NOT() (*Node, error) {
+func (a *Analyzer) not() (*Node, error) {
 	node := &Node{Class: NOT}
 	tempIndex := a.index
 	if ok := a.GetToken(); !ok {
@@ -448,12 +514,12 @@ func (a *Analyzer) NOT() (*Node, error) {
 			tIndex := a.index
 			rel, err := a.REL()
 			if err != nil {
-				a.index = tIndex
+				a.backtrack(tIndex)
 				if ok := a.GetToken(); !ok {
 					return nil, EndErr
 				}
 				if a.token.Class != lexer.Identifier {
-					a.index = tempIndex
+					a.backtrack(tempIndex)
 					return nil, err
 				} else {
 					node.LeftChild.RightBro = &Node{Class: Id, Token: a.token, IsTerminal: true}
@@ -463,7 +529,7 @@ func (a *Analyzer) NOT() (*Node, error) {
 			node.LeftChild.RightBro = rel
 			return node, nil
 		} else {
-			a.index = tempIndex
+			a.backtrack(tempIndex)
 			rel, err := a.REL()
 			if err != nil {
 				return nil, err
@@ -472,10 +538,10 @@ func (a *Analyzer) NOT() (*Node, error) {
 			return node, nil
 		}
 	default:
-		a.index = tempIndex
+		a.backtrack(tempIndex)
 		rel, err := a.REL()
 		if err != nil {
-			a.index = tempIndex
+			a.backtrack(tempIndex)
 			if ok := a.GetToken(); !ok {
 				return nil, EndErr
 			}
@@ -492,7 +558,7 @@ func (a *Analyzer) NOT() (*Node, error) {
 }
 
 // REL       →    EXPR   ROP  EXPR
-func (a *Analyzer) REL() (*Node, error) {
+func (a *Analyzer) rel() (*Node, error) {
 	node := &Node{Class: REL}
 	expr, err := a.E()
 	if err != nil {
@@ -513,7 +579,7 @@ func (a *Analyzer) REL() (*Node, error) {
 }
 
 // ROP      →     >  |  >=  |  <  |  <=  |  ==  |   !=
-func (a *Analyzer) ROP() (*Node, error) {
+func (a *Analyzer) rop() (*Node, error) {
 	node := &Node{Class: ROP}
 	if ok := a.GetToken(); !ok {
 		return nil, EndErr
@@ -546,7 +612,7 @@ func (a *Analyzer) ROP() (*Node, error) {
 //STMT      →    write  id  ;
 
 // PROG   →    {  DECLS  STMTS  }
-func (a *Analyzer) PROG() (*Node, error) {
+func (a *Analyzer) prog() (*Node, error) {
 	node := &Node{Class: PROG}
 	if ok := a.GetToken(); !ok {
 		return nil, EndErr
@@ -584,12 +650,12 @@ func (a *Analyzer) PROG() (*Node, error) {
 }
 
 // STMTS    →    STMT  STMTS  |   empty
-func (a *Analyzer) STMTS() (*Node, error) {
+func (a *Analyzer) stmts() (*Node, error) {
 	node := &Node{Class: STMTS}
 	tempIndex := a.index
 	stmt, err := a.STMT()
 	if err != nil {
-		a.index = tempIndex
+		a.backtrack(tempIndex)
 		node.LeftChild = &Node{Class: Empty}
 		return node, nil
 	}
@@ -609,7 +675,7 @@ func (a *Analyzer) STMTS() (*Node, error) {
 // STMT      →    {  STMTS }
 // STMT      →    read  id  ;
 // STMT      →    write  id  ;
-func (a *Analyzer) STMT() (*Node, error) {
+func (a *Analyzer) stmt() (*Node, error) {
 	node := &Node{Class: STMT}
 	if ok := a.GetToken(); !ok {
 		return nil, EndErr
@@ -690,11 +756,11 @@ func (a *Analyzer) STMT() (*Node, error) {
 			then.RightBro = stmt
 			tempIndex := a.index
 			if ok := a.GetToken(); !ok {
-				a.index = tempIndex
+				a.backtrack(tempIndex)
 				return node, nil
 			}
 			if a.token.Class != lexer.Keyword || a.token.Value != "else" {
-				a.index = tempIndex
+				a.backtrack(tempIndex)
 				return node, nil
 			}
 			elsevar := &Node{Class: Else, Token: a.token, IsTerminal: true}
@@ -796,12 +862,12 @@ func (a *Analyzer) STMT() (*Node, error) {
 }
 
 // DECLS       →    DECL  DECLS    |   empty
-func (a *Analyzer) DECLS() (*Node, error) {
+func (a *Analyzer) decls() (*Node, error) {
 	node := &Node{Class: DECLS}
 	tempIndex := a.index
 	decl, err := a.DECL()
 	if err != nil {
-		a.index = tempIndex
+		a.backtrack(tempIndex)
 		node.LeftChild = &Node{Class: Empty}
 		return node, nil
 	}
@@ -815,7 +881,7 @@ func (a *Analyzer) DECLS() (*Node, error) {
 }
 
 // DECL         →    int  NAMES  ;  |  bool  NAMES  ;
-func (a *Analyzer) DECL() (*Node, error) {
+func (a *Analyzer) decl() (*Node, error) {
 	node := &Node{Class: DECL}
 	if ok := a.GetToken(); !ok {
 		return nil, EndErr
@@ -847,7 +913,7 @@ func (a *Analyzer) DECL() (*Node, error) {
 }
 
 // NAMES     →    NAME ,  NAMES  |  NAME
-func (a *Analyzer) NAMES() (*Node, error) {
+func (a *Analyzer) names() (*Node, error) {
 	node := &Node{Class: NAMES}
 	name, err := a.NAME()
 	if err != nil {
@@ -859,7 +925,7 @@ func (a *Analyzer) NAMES() (*Node, error) {
 		return nil, EndErr
 	}
 	if a.token.Class != lexer.Separator || a.token.Value != "," {
-		a.index = tempIndex
+		a.backtrack(tempIndex)
 		return node, nil
 	}
 	colon := &Node{Class: Separator, Token: a.token, IsTerminal: true}
@@ -873,7 +939,7 @@ func (a *Analyzer) NAMES() (*Node, error) {
 }
 
 // NAME      →    id
-func (a *Analyzer) NAME() (*Node, error) {
+func (a *Analyzer) name() (*Node, error) {
 	node := &Node{Class: NAME}
 	if ok := a.GetToken(); !ok {
 		return nil, EndErr
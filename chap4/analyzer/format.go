@@ -0,0 +1,93 @@
+package analyzer
+
+import (
+	"bytes"
+	"chap4/lexer"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Label 结点的显示名，终结符为单词的值，非终结符为<EXPR>等文法符号
+func (n *Node) Label() string {
+	if n.IsTerminal && n.Token != nil {
+		return n.Token.Value
+	}
+	return ConstMap[n.Class]
+}
+
+// Children 返回结点的所有儿子
+func (n *Node) Children() []*Node {
+	children := make([]*Node, 0)
+	for child := n.LeftChild; child != nil; child = child.RightBro {
+		children = append(children, child)
+	}
+	return children
+}
+
+// FormatTree 将语法树转换为与PrintTree相同的文本形式
+func FormatTree(root *Node) string {
+	a := &Analyzer{root: root}
+	a.genTreeString()
+	if len(a.treeSource) == 0 {
+		return ""
+	}
+	return strings.Join(a.treeSource, "\n") + "\n"
+}
+
+// Dot 将语法树转换为Graphviz的dot格式
+func Dot(root *Node) string {
+	var b strings.Builder
+	b.WriteString("digraph tree {\n")
+	b.WriteString("  node [shape=plaintext];\n")
+	id := 0
+	var walk func(node *Node) int
+	walk = func(node *Node) int {
+		self := id
+		id++
+		shape := ""
+		if node.IsTerminal {
+			shape = ", shape=box"
+		}
+		b.WriteString(fmt.Sprintf("  n%d [label=%q%s];\n", self, node.Label(), shape))
+		for _, child := range node.Children() {
+			b.WriteString(fmt.Sprintf("  n%d -> n%d;\n", self, walk(child)))
+		}
+		return self
+	}
+	if root != nil {
+		walk(root)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// jsonNode 语法树结点的JSON形式
+type jsonNode struct {
+	Symbol   string       `json:"symbol"`
+	Terminal bool         `json:"terminal"`
+	Token    *lexer.Token `json:"token,omitempty"`
+	Children []*jsonNode  `json:"children,omitempty"`
+}
+
+func toJSONNode(node *Node) *jsonNode {
+	res := &jsonNode{Symbol: node.Label(), Terminal: node.IsTerminal, Token: node.Token}
+	for _, child := range node.Children() {
+		res.Children = append(res.Children, toJSONNode(child))
+	}
+	return res
+}
+
+// JSON 将语法树转换为JSON，不转义<EXPR>等文法符号中的尖括号
+func JSON(root *Node) ([]byte, error) {
+	if root == nil {
+		return []byte("null"), nil
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(toJSONNode(root)); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(buf.Bytes()), nil
+}
@@ -11,3 +11,28 @@ type Node struct {
 	RightBro   *Node
 	Attr       map[string]any
 }
+
+// Span 结点对应的源程序范围，从第一个单词开始到最后一个单词结束，没有单词时返回零值
+func (n *Node) Span() lexer.Span {
+	var first, last *lexer.Token
+	var walk func(node *Node)
+	walk = func(node *Node) {
+		for ; node != nil; node = node.RightBro {
+			if node.Token != nil {
+				if first == nil {
+					first = node.Token
+				}
+				last = node.Token
+			}
+			walk(node.LeftChild)
+		}
+	}
+	if n.Token != nil {
+		return n.Token.Span()
+	}
+	walk(n.LeftChild)
+	if first == nil {
+		return lexer.Span{}
+	}
+	return lexer.Span{Start: first.Pos, End: last.Span().End}
+}
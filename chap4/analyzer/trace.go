@@ -0,0 +1,234 @@
+package analyzer
+
+import (
+	"bytes"
+	"chap4/lexer"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 每个非终结符对应一个导出的方法，经过nonterminal调用小写的同名方法，
+// 以便在跟踪模式下记录进入与退出；产生式的实现在小写的方法中。
+
+func (a *Analyzer) E() (*Node, error)     { return a.nonterminal(EXPR, a.expr) }
+func (a *Analyzer) E1() (*Node, error)    { return a.nonterminal(EXPR1, a.expr1) }
+func (a *Analyzer) T() (*Node, error)     { return a.nonterminal(TERM, a.term) }
+func (a *Analyzer) NEGA() (*Node, error)  { return a.nonterminal(NEGA, a.nega) }
+func (a *Analyzer) T1() (*Node, error)    { return a.nonterminal(TERM1, a.term1) }
+func (a *Analyzer) F() (*Node, error)     { return a.nonterminal(FACTOR, a.factor) }
+func (a *Analyzer) AddOp() (*Node, error) { return a.nonterminal(ADDOP, a.addOp) }
+func (a *Analyzer) MulOp() (*Node, error) { return a.nonterminal(MULOP, a.mulOp) }
+func (a *Analyzer) BOOL() (*Node, error)  { return a.nonterminal(BOOL, a.boolean) }
+func (a *Analyzer) JOIN() (*Node, error)  { return a.nonterminal(JOIN, a.join) }
+func (a *Analyzer) NOT() (*Node, error)   { return a.nonterminal(NOT, a.not) }
+func (a *Analyzer) REL() (*Node, error)   { return a.nonterminal(REL, a.rel) }
+func (a *Analyzer) ROP() (*Node, error)   { return a.nonterminal(ROP, a.rop) }
+func (a *Analyzer) PROG() (*Node, error)  { return a.nonterminal(PROG, a.prog) }
+func (a *Analyzer) STMTS() (*Node, error) { return a.nonterminal(STMTS, a.stmts) }
+func (a *Analyzer) STMT() (*Node, error)  { return a.nonterminal(STMT, a.stmt) }
+func (a *Analyzer) DECLS() (*Node, error) { return a.nonterminal(DECLS, a.decls) }
+func (a *Analyzer) DECL() (*Node, error)  { return a.nonterminal(DECL, a.decl) }
+func (a *Analyzer) NAMES() (*Node, error) { return a.nonterminal(NAMES, a.names) }
+func (a *Analyzer) NAME() (*Node, error)  { return a.nonterminal(NAME, a.name) }
+
+// nonterminal 调用非终结符的分析方法，跟踪模式下记录进入与退出
+func (a *Analyzer) nonterminal(class int, rule func() (*Node, error)) (*Node, error) {
+	if a.tracer == nil {
+		return rule()
+	}
+	symbol := ConstMap[class]
+	a.tracer.enter(symbol, a.index)
+	node, err := rule()
+	a.tracer.exit(symbol, a.index, err)
+	return node, err
+}
+
+// backtrack 回退到第index个单词，跟踪模式下记录回溯
+func (a *Analyzer) backtrack(index int) {
+	if a.tracer != nil && index < a.index {
+		a.tracer.backtrack(index, a.index)
+	}
+	a.index = index
+}
+
+// EnableTrace 开启跟踪模式，需要在Analyse之前调用
+func (a *Analyzer) EnableTrace() {
+	a.tracer = &tracer{trace: &Trace{Events: make([]TraceEvent, 0), RewoundBy: make(map[string]int)}}
+}
+
+// Trace 返回跟踪结果，没有开启跟踪模式时返回nil
+func (a *Analyzer) Trace() *Trace {
+	if a.tracer == nil {
+		return nil
+	}
+	return a.tracer.trace
+}
+
+// 跟踪事件的种类
+const (
+	TraceEnter     = "enter"
+	TraceExit      = "exit"
+	TraceConsume   = "consume"
+	TraceBacktrack = "backtrack"
+)
+
+// TraceEvent 语法分析过程中的一个事件
+type TraceEvent struct {
+	Kind   string       `json:"kind"`
+	Depth  int          `json:"depth"`
+	Symbol string       `json:"symbol,omitempty"` // 事件所在的非终结符
+	Index  int          `json:"index"`            // 下一个单词的序号（从0开始），consume时为读入单词的序号
+	Token  *lexer.Token `json:"token,omitempty"`  // consume读入的单词
+	From   int          `json:"from,omitempty"`   // backtrack之前的位置，回退了From-Index个单词
+	Error  string       `json:"error,omitempty"`  // exit时失败的原因，为空表示成功
+}
+
+// Trace 一次语法分析的跟踪结果
+type Trace struct {
+	Events     []TraceEvent   `json:"events"`
+	Derivation [][]string     `json:"derivation"` // 最左推导的各个句型，分析失败时为空
+	Consumed   int            `json:"consumed"`   // 读入单词的次数，包括回溯后重新读入的
+	Backtracks int            `json:"backtracks"` // 回溯的次数
+	Rewound    int            `json:"rewound"`    // 因回溯而退回的单词总数
+	RewoundBy  map[string]int `json:"rewoundBy"`  // 每个非终结符退回的单词数
+}
+
+// tracer 记录跟踪事件，stack为当前正在分析的非终结符
+type tracer struct {
+	trace *Trace
+	stack []string
+}
+
+func (t *tracer) add(event TraceEvent) {
+	event.Depth = len(t.stack)
+	if event.Symbol == "" && len(t.stack) > 0 {
+		event.Symbol = t.stack[len(t.stack)-1]
+	}
+	t.trace.Events = append(t.trace.Events, event)
+}
+
+func (t *tracer) enter(symbol string, index int) {
+	t.add(TraceEvent{Kind: TraceEnter, Symbol: symbol, Index: index})
+	t.stack = append(t.stack, symbol)
+}
+
+func (t *tracer) exit(symbol string, index int, err error) {
+	t.stack = t.stack[:len(t.stack)-1]
+	event := TraceEvent{Kind: TraceExit, Symbol: symbol, Index: index}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	t.add(event)
+}
+
+func (t *tracer) consume(index int, token *lexer.Token) {
+	t.trace.Consumed++
+	t.add(TraceEvent{Kind: TraceConsume, Index: index, Token: token})
+}
+
+func (t *tracer) backtrack(index, from int) {
+	t.trace.Backtracks++
+	t.trace.Rewound += from - index
+	if len(t.stack) > 0 {
+		t.trace.RewoundBy[t.stack[len(t.stack)-1]] += from - index
+	}
+	t.add(TraceEvent{Kind: TraceBacktrack, Index: index, From: from})
+}
+
+func (t *tracer) finish(root *Node, err error) {
+	if err == nil && root != nil {
+		t.trace.Derivation = Derivation(root)
+	}
+}
+
+// Derivation 由语法树得到最左推导，每一步将句型中最左边的非终结符替换为它的儿子，empty不出现在句型中
+func Derivation(root *Node) [][]string {
+	forms := make([][]string, 0)
+	form := []*Node{root}
+	for {
+		labels := make([]string, 0, len(form))
+		for _, node := range form {
+			labels = append(labels, node.Label())
+		}
+		forms = append(forms, labels)
+		i := 0
+		for i < len(form) && (form[i].IsTerminal || form[i].Class == Empty) {
+			i++
+		}
+		if i == len(form) {
+			return forms
+		}
+		children := make([]*Node, 0)
+		for _, child := range form[i].Children() {
+			if child.Class != Empty {
+				children = append(children, child)
+			}
+		}
+		next := make([]*Node, 0, len(form)-1+len(children))
+		next = append(next, form[:i]...)
+		next = append(next, children...)
+		form = append(next, form[i+1:]...)
+	}
+}
+
+// Text 将跟踪结果转换为文本，事件按嵌套深度缩进，最后是统计与最左推导
+func (t *Trace) Text() string {
+	var b strings.Builder
+	for _, event := range t.Events {
+		b.WriteString(strings.Repeat("  ", event.Depth))
+		switch event.Kind {
+		case TraceEnter:
+			fmt.Fprintf(&b, "enter %s at %d\n", event.Symbol, event.Index)
+		case TraceExit:
+			if event.Error == "" {
+				fmt.Fprintf(&b, "exit %s at %d\n", event.Symbol, event.Index)
+			} else {
+				fmt.Fprintf(&b, "fail %s at %d: %s\n", event.Symbol, event.Index, event.Error)
+			}
+		case TraceConsume:
+			fmt.Fprintf(&b, "consume %d %q at %s\n", event.Index, event.Token.Value, event.Token.Pos)
+		case TraceBacktrack:
+			fmt.Fprintf(&b, "backtrack %d -> %d\n", event.From, event.Index)
+		}
+	}
+	fmt.Fprintf(&b, "\ntokens consumed: %d, backtracks: %d, tokens rewound: %d\n", t.Consumed, t.Backtracks, t.Rewound)
+	symbols := make([]string, 0, len(t.RewoundBy))
+	for symbol := range t.RewoundBy {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		if t.RewoundBy[symbols[i]] != t.RewoundBy[symbols[j]] {
+			return t.RewoundBy[symbols[i]] > t.RewoundBy[symbols[j]]
+		}
+		return symbols[i] < symbols[j]
+	})
+	for _, symbol := range symbols {
+		fmt.Fprintf(&b, "  %-8s %d\n", symbol, t.RewoundBy[symbol])
+	}
+	if len(t.Derivation) > 0 {
+		b.WriteString("\nleftmost derivation:\n")
+		for i, form := range t.Derivation {
+			if i == 0 {
+				b.WriteString("    ")
+			} else {
+				b.WriteString(" => ")
+			}
+			b.WriteString(strings.Join(form, " "))
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// JSON 将跟踪结果转换为JSON，不转义文法符号中的尖括号
+func (t *Trace) JSON() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(t); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(buf.Bytes()), nil
+}
@@ -0,0 +1,74 @@
+package analyzer_test
+
+import (
+	"chap4/analyzer"
+	"chap4/compiler"
+	"golden"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// trace 编译到语法分析为止并返回跟踪结果
+func trace(t *testing.T, src []byte) (*analyzer.Trace, []compiler.Diagnostic) {
+	t.Helper()
+	result, diagnostics := compiler.Compile(src, compiler.Options{StopAfter: compiler.PhaseParse, Trace: true})
+	if result.Trace == nil {
+		t.Fatalf("no trace: %v", diagnostics)
+	}
+	return result.Trace, diagnostics
+}
+
+// TestTraceGolden testdata下每个程序的跟踪过程、回溯统计与最左推导与同名的.golden文件比较；
+// go test -update改为重写golden文件
+func TestTraceGolden(t *testing.T) {
+	sources, err := filepath.Glob("testdata/*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) == 0 {
+		t.Fatal("no programs found in testdata")
+	}
+	for _, source := range sources {
+		source := source
+		t.Run(filepath.Base(source), func(t *testing.T) {
+			src, err := os.ReadFile(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr, diagnostics := trace(t, src)
+			if compiler.HasErrors(diagnostics) {
+				t.Fatal(diagnostics)
+			}
+			golden.Check(t, strings.TrimSuffix(source, ".txt")+".golden", []byte(tr.Text()))
+		})
+	}
+}
+
+// TestTraceCounts 回溯的次数与退回的单词数：<DECLS>、<NAMES>、<STMTS>在声明与语句序列的结尾试探失败，
+// <NEGA>试探"-"、<MULOP>与<ADDOP>试探运算符失败时各退回一个单词
+func TestTraceCounts(t *testing.T) {
+	tests := []struct {
+		src                           string
+		consumed, backtracks, rewound int
+		rewoundBy                     map[string]int
+	}{
+		{"{ int a; write a; }", 11, 3, 3, map[string]int{"<DECLS>": 1, "<NAMES>": 1, "<STMTS>": 1}},
+		{"{ int a; a = 1 + 2; write a; }", 22, 8, 8, map[string]int{"<ADDOP>": 1, "<DECLS>": 1, "<MULOP>": 2, "<NAMES>": 1, "<NEGA>": 2, "<STMTS>": 1}},
+		//语句出错时<STMTS>退回整条语句
+		{"{ int a; a = ; }", 11, 5, 6, map[string]int{"<DECLS>": 1, "<FACTOR>": 1, "<NAMES>": 1, "<NEGA>": 1, "<STMTS>": 2}},
+	}
+	for _, test := range tests {
+		tr, diagnostics := trace(t, []byte(test.src))
+		if tr.Consumed != test.consumed || tr.Backtracks != test.backtracks || tr.Rewound != test.rewound || !reflect.DeepEqual(tr.RewoundBy, test.rewoundBy) {
+			t.Errorf("%q: consumed %d, backtracks %d, rewound %d, by %v, want %d, %d, %d, %v", test.src,
+				tr.Consumed, tr.Backtracks, tr.Rewound, tr.RewoundBy, test.consumed, test.backtracks, test.rewound, test.rewoundBy)
+		}
+		//分析失败时没有最左推导
+		if (len(tr.Derivation) == 0) != compiler.HasErrors(diagnostics) {
+			t.Errorf("%q: %d sentential forms, diagnostics %v", test.src, len(tr.Derivation), diagnostics)
+		}
+	}
+}
@@ -0,0 +1,407 @@
+// Package assembly 由四元式生成 x86-64 汇编代码（GNU as 语法，System V ABI）
+//
+// int与bool都占一个64位的栈槽，运算使用64位指令，与解释器一致；WAT与LLVM后端是i32
+package assembly
+
+import (
+	"chap4/cfg"
+	"chap4/semantic"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+var (
+	EmptyProgramErr = errors.New("error: no quadruple to generate")
+	UnknownOpErr    = errors.New("error: unknown quadruple op")
+)
+
+// jumpMap 条件跳转四元式与x86条件跳转指令的对应关系
+var jumpMap = map[string]string{
+	"j>":  "jg",
+	"j>=": "jge",
+	"j<":  "jl",
+	"j<=": "jle",
+	"j==": "je",
+	"j!=": "jne",
+}
+
+// Generator 汇编代码生成器
+type Generator struct {
+	quadrupleList []*semantic.Quadruple
+	vars          []string       // 变量及临时变量
+	slots         map[string]int // 变量在栈帧中相对rbp的偏移
+	frameSize     int            // 栈帧大小，16字节对齐
+	labels        map[int]bool   // 需要生成标号的四元式下标
+	lines         []string       // 生成的汇编代码
+	registerCount int            // 可用于分配的物理寄存器数量，为0时所有变量都放在栈上
+	allocation    *Allocation    // 寄存器分配结果
+	live          *cfg.Liveness  // 活跃变量信息，用于在调用前后保存寄存器
+	saved         []string       // 需要在序言中保存的被调用者保存寄存器
+}
+
+// NewGenerator 创建一个汇编代码生成器实例
+func NewGenerator(s *semantic.Semantic) *Generator {
+	return &Generator{
+		quadrupleList: s.QuadrupleList(),
+		vars:          s.VarList(),
+		slots:         make(map[string]int),
+		labels:        make(map[int]bool),
+		lines:         make([]string, 0),
+	}
+}
+
+// SetRegisterCount 设置可用于分配的物理寄存器数量，超过MaxRegisters时按MaxRegisters处理
+func (g *Generator) SetRegisterCount(k int) {
+	g.registerCount = k
+}
+
+// Allocation 返回最近一次生成代码时的寄存器分配结果
+func (g *Generator) Allocation() *Allocation {
+	return g.allocation
+}
+
+// Generate 生成汇编代码
+func (g *Generator) Generate() (string, error) {
+	if len(g.quadrupleList) == 0 {
+		return "", EmptyProgramErr
+	}
+	g.lines = g.lines[:0]
+	if err := g.allocRegisters(); err != nil {
+		return "", err
+	}
+	g.allocSlots()
+	if err := g.collectLabels(); err != nil {
+		return "", err
+	}
+	g.emitEntry()
+	g.emitPrologue()
+	for index, q := range g.quadrupleList {
+		if g.labels[index] {
+			g.emitLabel(labelName(index))
+		}
+		if err := g.emitQuadruple(index, q); err != nil {
+			return "", fmt.Errorf("%w : %d: %s", err, index, q)
+		}
+	}
+	//跳转到四元式末尾的情况
+	if g.labels[len(g.quadrupleList)] {
+		g.emitLabel(labelName(len(g.quadrupleList)))
+	}
+	g.emitEpilogue()
+	g.lines = append(g.lines, runtime)
+	g.emit(`.section .note.GNU-stack,"",@progbits`)
+	return strings.Join(g.lines, "\n") + "\n", nil
+}
+
+// PrintToFile 将汇编代码写入文件
+func (g *Generator) PrintToFile(filename string) error {
+	code, err := g.Generate()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, []byte(code), 0666)
+}
+
+// allocRegisters 基于活跃变量分析进行寄存器分配
+func (g *Generator) allocRegisters() error {
+	graph, err := cfg.Build(g.quadrupleList)
+	if err != nil {
+		return err
+	}
+	g.live = graph.Liveness()
+	g.allocation = Allocate(graph, g.live, g.vars, g.registerCount)
+	g.saved = make([]string, 0)
+	used := make(map[string]bool)
+	for _, reg := range g.allocation.Assignment {
+		used[reg] = true
+	}
+	for _, reg := range registerPool {
+		if used[reg] && calleeSaved[reg] {
+			g.saved = append(g.saved, reg)
+		}
+	}
+	return nil
+}
+
+// allocSlots 为溢出的变量以及需要保存的寄存器各分配一个8字节的栈槽
+func (g *Generator) allocSlots() {
+	count := 0
+	for _, name := range g.vars {
+		if _, ok := g.allocation.Register(name); ok {
+			continue
+		}
+		count++
+		g.slots[name] = -8 * count
+	}
+	for _, reg := range g.saved {
+		count++
+		g.slots[reg] = -8 * count
+	}
+	g.frameSize = (8*count + 15) / 16 * 16
+}
+
+// collectLabels 收集所有跳转目标
+func (g *Generator) collectLabels() error {
+	for index, q := range g.quadrupleList {
+		if !q.IsJump() {
+			continue
+		}
+		target, err := q.JumpTarget()
+		if err != nil {
+			return err
+		}
+		if target < 0 || target > len(g.quadrupleList) {
+			return fmt.Errorf("error: jump target %d out of range at %d", target, index)
+		}
+		g.labels[target] = true
+	}
+	return nil
+}
+
+// labelName 生成四元式下标对应的标号
+func labelName(index int) string {
+	return fmt.Sprintf(".Lq%d", index)
+}
+
+// operand 将四元式的操作数转换为汇编操作数
+func (g *Generator) operand(arg string) (string, error) {
+	if semantic.IsConst(arg) {
+		return "$" + arg, nil
+	}
+	if reg, ok := g.allocation.Register(arg); ok {
+		return reg, nil
+	}
+	offset, ok := g.slots[arg]
+	if !ok {
+		return "", fmt.Errorf("error: %s is not declared", arg)
+	}
+	return fmt.Sprintf("%d(%%rbp)", offset), nil
+}
+
+func (g *Generator) emit(format string, a ...any) {
+	g.lines = append(g.lines, "\t"+fmt.Sprintf(format, a...))
+}
+func (g *Generator) emitLabel(name string) {
+	g.lines = append(g.lines, name+":")
+}
+
+// emitEntry 生成程序入口，_start调用main后以其返回值退出
+func (g *Generator) emitEntry() {
+	g.emit(".text")
+	g.emit(".globl _start")
+	g.emitLabel("_start")
+	g.emit("call main")
+	g.emit("movq %%rax, %%rdi")
+	g.emit("movq $60, %%rax")
+	g.emit("syscall")
+	g.lines = append(g.lines, "")
+	g.emit(".globl main")
+}
+
+// emitPrologue 生成main的函数序言
+func (g *Generator) emitPrologue() {
+	g.emitLabel("main")
+	g.emit("pushq %%rbp")
+	g.emit("movq %%rsp, %%rbp")
+	if g.frameSize > 0 {
+		g.emit("subq $%d, %%rsp", g.frameSize)
+	}
+	for _, reg := range g.saved {
+		g.emit("movq %s, %d(%%rbp)", reg, g.slots[reg])
+	}
+	//变量初始化为0
+	for _, name := range g.vars {
+		dst, _ := g.operand(name)
+		g.emit("movq $0, %s", dst)
+	}
+}
+
+// emitEpilogue 生成main的函数尾声
+func (g *Generator) emitEpilogue() {
+	g.emitLabel(".Lquit")
+	for _, reg := range g.saved {
+		g.emit("movq %d(%%rbp), %s", g.slots[reg], reg)
+	}
+	g.emit("xorq %%rax, %%rax")
+	g.emit("leave")
+	g.emit("ret")
+	g.lines = append(g.lines, "")
+}
+
+// emitQuadruple 将一条四元式翻译为汇编指令
+func (g *Generator) emitQuadruple(index int, q *semantic.Quadruple) error {
+	g.lines = append(g.lines, "\t# "+q.String())
+	switch q.Op() {
+	case "+", "-", "*":
+		return g.emitArith(q)
+	case "/":
+		return g.emitDiv(q)
+	case "=", ":=":
+		src, err := g.operand(q.Arg1())
+		if err != nil {
+			return err
+		}
+		dst, err := g.operand(q.Result())
+		if err != nil {
+			return err
+		}
+		if src == dst {
+			//复制语句两端被合并到同一个寄存器
+			return nil
+		}
+		g.emit("movq %s, %%rax", src)
+		g.emit("movq %%rax, %s", dst)
+	case "j":
+		target, err := q.JumpTarget()
+		if err != nil {
+			return err
+		}
+		g.emit("jmp %s", labelName(target))
+	case "jnz":
+		target, err := q.JumpTarget()
+		if err != nil {
+			return err
+		}
+		src, err := g.operand(q.Arg1())
+		if err != nil {
+			return err
+		}
+		g.emit("movq %s, %%rax", src)
+		g.emit("testq %%rax, %%rax")
+		g.emit("jne %s", labelName(target))
+	case "j>", "j>=", "j<", "j<=", "j==", "j!=":
+		target, err := q.JumpTarget()
+		if err != nil {
+			return err
+		}
+		src1, err := g.operand(q.Arg1())
+		if err != nil {
+			return err
+		}
+		src2, err := g.operand(q.Arg2())
+		if err != nil {
+			return err
+		}
+		g.emit("movq %s, %%rax", src1)
+		g.emit("movq %s, %%rcx", src2)
+		g.emit("cmpq %%rcx, %%rax")
+		g.emit("%s %s", jumpMap[q.Op()], labelName(target))
+	case "read":
+		dst, err := g.operand(q.Arg1())
+		if err != nil {
+			return err
+		}
+		saved := g.saveCallerSaved(index, q.Arg1())
+		g.emit("call __read_int")
+		g.restoreCallerSaved(saved)
+		g.emit("movq %%rax, %s", dst)
+	case "write":
+		src, err := g.operand(q.Arg1())
+		if err != nil {
+			return err
+		}
+		saved := g.saveCallerSaved(index, "")
+		g.emit("movq %s, %%rdi", src)
+		g.emit("call __write_int")
+		g.restoreCallerSaved(saved)
+	case "quit":
+		g.emit("jmp .Lquit")
+	default:
+		return UnknownOpErr
+	}
+	return nil
+}
+
+// saveCallerSaved 在调用运行时函数前保存调用之后仍然活跃的、位于调用者保存寄存器中的变量
+// def为本条四元式定值的变量，它在调用后会被重新赋值，无需保存
+func (g *Generator) saveCallerSaved(index int, def string) []string {
+	saved := make([]string, 0)
+	seen := make(map[string]bool)
+	names := make([]string, 0, len(g.live.LiveOut[index]))
+	for name := range g.live.LiveOut[index] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == def {
+			continue
+		}
+		reg, ok := g.allocation.Register(name)
+		if !ok || calleeSaved[reg] || seen[reg] {
+			continue
+		}
+		seen[reg] = true
+		saved = append(saved, reg)
+	}
+	//保持栈指针16字节对齐
+	if len(saved)%2 == 1 {
+		g.emit("subq $8, %%rsp")
+	}
+	for _, reg := range saved {
+		g.emit("pushq %s", reg)
+	}
+	return saved
+}
+
+// restoreCallerSaved 在调用运行时函数后恢复寄存器
+func (g *Generator) restoreCallerSaved(saved []string) {
+	for i := len(saved) - 1; i >= 0; i-- {
+		g.emit("popq %s", saved[i])
+	}
+	if len(saved)%2 == 1 {
+		g.emit("addq $8, %%rsp")
+	}
+}
+
+// emitArith 翻译加减乘
+func (g *Generator) emitArith(q *semantic.Quadruple) error {
+	src1, err := g.operand(q.Arg1())
+	if err != nil {
+		return err
+	}
+	src2, err := g.operand(q.Arg2())
+	if err != nil {
+		return err
+	}
+	dst, err := g.operand(q.Result())
+	if err != nil {
+		return err
+	}
+	g.emit("movq %s, %%rax", src1)
+	g.emit("movq %s, %%rcx", src2)
+	switch q.Op() {
+	case "+":
+		g.emit("addq %%rcx, %%rax")
+	case "-":
+		g.emit("subq %%rcx, %%rax")
+	case "*":
+		g.emit("imulq %%rcx, %%rax")
+	}
+	g.emit("movq %%rax, %s", dst)
+	return nil
+}
+
+// emitDiv 翻译除法，使用idiv，商在rax中
+func (g *Generator) emitDiv(q *semantic.Quadruple) error {
+	src1, err := g.operand(q.Arg1())
+	if err != nil {
+		return err
+	}
+	src2, err := g.operand(q.Arg2())
+	if err != nil {
+		return err
+	}
+	dst, err := g.operand(q.Result())
+	if err != nil {
+		return err
+	}
+	g.emit("movq %s, %%rax", src1)
+	g.emit("movq %s, %%rcx", src2)
+	g.emit("cqto")
+	g.emit("idivq %%rcx")
+	g.emit("movq %%rax, %s", dst)
+	return nil
+}
@@ -0,0 +1,76 @@
+package assembly
+
+import (
+	"bytes"
+	"chap4/compiler"
+	"chap4/internal/corpus"
+	"chap4/interpreter"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// registerCounts 往返测试使用的寄存器数量：0时全部在栈上，1到3时大量溢出，11为全部寄存器
+var registerCounts = []int{0, 1, 2, 3, 11}
+
+// TestRoundTrip 用as、ld汇编链接每个样例程序生成的汇编代码，在不同的寄存器数量下
+// 运行结果都应与四元式解释器相同；没有as或ld时跳过
+func TestRoundTrip(t *testing.T) {
+	as, err := exec.LookPath("as")
+	if err != nil {
+		t.Skip("as not found")
+	}
+	ld, err := exec.LookPath("ld")
+	if err != nil {
+		t.Skip("ld not found")
+	}
+	programs, err := corpus.Programs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range programs {
+		p := p
+		t.Run(p.Name, func(t *testing.T) {
+			result, diagnostics := compiler.CompileFile(p.Path, compiler.Options{})
+			if compiler.HasErrors(diagnostics) {
+				t.Skipf("%s does not compile: %v", p.Path, diagnostics[0])
+			}
+			var want bytes.Buffer
+			runErr := interpreter.NewInterpreter(result.Semantic, strings.NewReader(corpus.Input), &want).Run()
+			for _, k := range registerCounts {
+				k := k
+				t.Run(fmt.Sprintf("regs=%d", k), func(t *testing.T) {
+					generator := NewGenerator(result.Semantic)
+					generator.SetRegisterCount(k)
+					src, err := generator.Generate()
+					if err != nil {
+						t.Fatal(err)
+					}
+					dir := t.TempDir()
+					if err := os.WriteFile(filepath.Join(dir, "main.s"), []byte(src), 0666); err != nil {
+						t.Fatal(err)
+					}
+					for _, cmd := range [][]string{{as, "-o", "main.o", "main.s"}, {ld, "-o", "main", "main.o"}} {
+						c := exec.Command(cmd[0], cmd[1:]...)
+						c.Dir = dir
+						if out, err := c.CombinedOutput(); err != nil {
+							t.Fatalf("%s: %v\n%s", filepath.Base(cmd[0]), err, out)
+						}
+					}
+					run := exec.Command(filepath.Join(dir, "main"))
+					run.Stdin = strings.NewReader(corpus.Input)
+					got, err := run.Output()
+					if (err != nil) != (runErr != nil) {
+						t.Fatalf("program error = %v, interpreter error = %v", err, runErr)
+					}
+					if string(got) != want.String() {
+						t.Errorf("program output = %q, interpreter output = %q\n%s", got, want.String(), generator.Allocation())
+					}
+				})
+			}
+		})
+	}
+}
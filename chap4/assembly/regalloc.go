@@ -0,0 +1,291 @@
+package assembly
+
+import (
+	"chap4/cfg"
+	"chap4/semantic"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// registerPool 可分配的物理寄存器，按分配优先级排列
+// rax、rcx、rdx保留为临时寄存器，用于运算、idiv以及加载溢出的变量
+var registerPool = []string{
+	"%rbx", "%r12", "%r13", "%r14", "%r15",
+	"%rsi", "%rdi", "%r8", "%r9", "%r10", "%r11",
+}
+
+// calleeSaved 被调用者保存寄存器，使用前需要在函数序言中保存
+var calleeSaved = map[string]bool{
+	"%rbx": true,
+	"%r12": true,
+	"%r13": true,
+	"%r14": true,
+	"%r15": true,
+}
+
+// MaxRegisters 可分配的物理寄存器数量上限
+var MaxRegisters = len(registerPool)
+
+// Allocation 寄存器分配的结果
+type Allocation struct {
+	Function   string            // 函数名
+	Registers  int               // 可用的物理寄存器数量
+	Assignment map[string]string // 变量到物理寄存器的映射，溢出的变量不在其中
+	Coalesced  map[string]string // 被合并的变量到其代表变量的映射
+	Spilled    []string          // 溢出到栈上的变量
+	SpillCost  map[string]float64
+}
+
+// SpillCount 返回溢出的变量数量
+func (a *Allocation) SpillCount() int {
+	return len(a.Spilled)
+}
+
+// Register 返回变量被分配到的寄存器，溢出时返回false
+func (a *Allocation) Register(name string) (string, bool) {
+	reg, ok := a.Assignment[a.find(name)]
+	return reg, ok
+}
+
+// find 返回变量合并后的代表变量
+func (a *Allocation) find(name string) string {
+	for {
+		alias, ok := a.Coalesced[name]
+		if !ok {
+			return name
+		}
+		name = alias
+	}
+}
+
+// String 输出分配报告
+func (a *Allocation) String() string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("function %s: %d registers, %d spilled\n", a.Function, a.Registers, a.SpillCount()))
+	names := make([]string, 0, len(a.Assignment)+len(a.Coalesced)+len(a.Spilled))
+	for name := range a.Assignment {
+		names = append(names, name)
+	}
+	for name := range a.Coalesced {
+		names = append(names, name)
+	}
+	names = append(names, a.Spilled...)
+	sort.Strings(names)
+	for _, name := range names {
+		location := "spilled"
+		if reg, ok := a.Register(name); ok {
+			location = reg
+		}
+		if rep := a.find(name); rep != name {
+			location += " (coalesced with " + rep + ")"
+		} else {
+			location += fmt.Sprintf(" (cost %g)", a.SpillCost[name])
+		}
+		b.WriteString(fmt.Sprintf("  %-8s -> %s\n", name, location))
+	}
+	return b.String()
+}
+
+// allocator 基于图着色的寄存器分配器（Chaitin/Briggs）
+type allocator struct {
+	graph *cfg.Graph
+	live  *cfg.Liveness
+	k     int
+	vars  []string
+	adj   map[string]cfg.Set // 冲突图
+	moves [][2]string        // =语句产生的复制关系
+	alloc *Allocation
+}
+
+// Allocate 对控制流图中的变量进行寄存器分配，k为可用的物理寄存器数量
+func Allocate(graph *cfg.Graph, live *cfg.Liveness, vars []string, k int) *Allocation {
+	if k < 0 {
+		k = 0
+	}
+	if k > MaxRegisters {
+		k = MaxRegisters
+	}
+	a := &allocator{
+		graph: graph,
+		live:  live,
+		k:     k,
+		vars:  vars,
+		adj:   make(map[string]cfg.Set),
+		alloc: &Allocation{
+			Function:   "main",
+			Registers:  k,
+			Assignment: make(map[string]string),
+			Coalesced:  make(map[string]string),
+			Spilled:    make([]string, 0),
+			SpillCost:  make(map[string]float64),
+		},
+	}
+	a.build()
+	a.computeSpillCost()
+	a.coalesce()
+	a.color()
+	return a.alloc
+}
+
+// build 构造冲突图：被定值的变量与该点之后活跃的其它变量冲突
+// 对于复制语句 d = s，d与s不冲突，以便后续合并
+func (a *allocator) build() {
+	for _, v := range a.vars {
+		a.adj[v] = make(cfg.Set)
+	}
+	for index, q := range a.graph.Quadruples {
+		d := cfg.Def(q)
+		if d == "" {
+			continue
+		}
+		a.touch(d)
+		isMove := q.Op() == "=" && !semantic.IsConst(q.Arg1())
+		if isMove {
+			a.touch(q.Arg1())
+			a.moves = append(a.moves, [2]string{q.Arg1(), d})
+		}
+		for v := range a.live.LiveOut[index] {
+			if v == d || (isMove && v == q.Arg1()) {
+				continue
+			}
+			a.addEdge(d, v)
+		}
+	}
+}
+
+// touch 确保变量在冲突图中有对应的结点
+func (a *allocator) touch(v string) {
+	if _, ok := a.adj[v]; !ok {
+		a.adj[v] = make(cfg.Set)
+	}
+}
+
+func (a *allocator) addEdge(u, v string) {
+	a.touch(u)
+	a.touch(v)
+	a.adj[u][v] = true
+	a.adj[v][u] = true
+}
+
+// computeSpillCost 溢出代价为变量每次使用和定值的权重之和，循环内的权重为10的循环深度次方
+func (a *allocator) computeSpillCost() {
+	depth := a.graph.LoopDepth()
+	for _, block := range a.graph.Blocks {
+		weight := math.Pow(10, float64(depth[block]))
+		for i := block.Start; i < block.End; i++ {
+			q := a.graph.Quadruples[i]
+			for _, v := range cfg.Uses(q) {
+				a.alloc.SpillCost[v] += weight
+			}
+			if d := cfg.Def(q); d != "" {
+				a.alloc.SpillCost[d] += weight
+			}
+		}
+	}
+}
+
+// coalesce 按Briggs保守策略合并复制语句两端的变量：
+// 合并后的结点中度数不小于k的邻居少于k个时才合并，保证不会使图变得不可着色
+func (a *allocator) coalesce() {
+	for changed := true; changed; {
+		changed = false
+		for _, move := range a.moves {
+			u, v := a.alloc.find(move[0]), a.alloc.find(move[1])
+			if u == v || a.adj[u][v] {
+				continue
+			}
+			neighbors := a.adj[u].Copy()
+			for n := range a.adj[v] {
+				neighbors[n] = true
+			}
+			significant := 0
+			for n := range neighbors {
+				degree := len(a.adj[n])
+				if a.adj[n][u] && a.adj[n][v] {
+					degree--
+				}
+				if degree >= a.k {
+					significant++
+				}
+			}
+			if significant >= a.k {
+				continue
+			}
+			//将v合并到u
+			for n := range a.adj[v] {
+				delete(a.adj[n], v)
+				a.addEdge(u, n)
+			}
+			delete(a.adj, v)
+			a.alloc.Coalesced[v] = u
+			a.alloc.SpillCost[u] += a.alloc.SpillCost[v]
+			changed = true
+		}
+	}
+}
+
+// color 简化与选择：反复移除度数小于k的结点，无法移除时选择代价/度数最小的结点乐观地压栈，
+// 然后逆序为结点着色，无可用颜色的结点溢出
+func (a *allocator) color() {
+	nodes := make([]string, 0, len(a.adj))
+	for v := range a.adj {
+		nodes = append(nodes, v)
+	}
+	sort.Strings(nodes)
+	degree := make(map[string]int)
+	for _, v := range nodes {
+		degree[v] = len(a.adj[v])
+	}
+	removed := make(cfg.Set)
+	stack := make([]string, 0, len(nodes))
+	for len(stack) < len(nodes) {
+		candidate := ""
+		for _, v := range nodes {
+			if !removed[v] && degree[v] < a.k {
+				candidate = v
+				break
+			}
+		}
+		if candidate == "" {
+			best := math.Inf(1)
+			for _, v := range nodes {
+				if removed[v] {
+					continue
+				}
+				priority := a.alloc.SpillCost[v] / float64(degree[v]+1)
+				if priority < best {
+					best = priority
+					candidate = v
+				}
+			}
+		}
+		removed[candidate] = true
+		stack = append(stack, candidate)
+		for n := range a.adj[candidate] {
+			degree[n]--
+		}
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		v := stack[i]
+		used := make(map[string]bool)
+		for n := range a.adj[v] {
+			if reg, ok := a.alloc.Assignment[n]; ok {
+				used[reg] = true
+			}
+		}
+		assigned := false
+		for _, reg := range registerPool[:a.k] {
+			if !used[reg] {
+				a.alloc.Assignment[v] = reg
+				assigned = true
+				break
+			}
+		}
+		if !assigned {
+			a.alloc.Spilled = append(a.alloc.Spilled, v)
+		}
+	}
+	sort.Strings(a.alloc.Spilled)
+}
@@ -0,0 +1,143 @@
+package assembly
+
+import (
+	"chap4/cfg"
+	"chap4/compiler"
+	"chap4/internal/corpus"
+	"chap4/semantic"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// loop 与cfg的测试相同的小程序：t1 → c → d是一串复制，循环中a、b、d、e同时活跃，
+// b只在循环外使用，溢出代价最小
+const loop = "{ int a, b, c, d; bool e; read a; read b; c = a + b; d = c; e := a > 0; while e do { a = a - d; e := a > 0; } write b; }"
+
+// analyze 编译源程序，返回控制流图、活跃变量与变量表
+func analyze(t *testing.T, src []byte, filename string) (*cfg.Graph, *cfg.Liveness, []string) {
+	t.Helper()
+	result, diagnostics := compiler.Compile(src, compiler.Options{Filename: filename})
+	if compiler.HasErrors(diagnostics) {
+		t.Skipf("%s does not compile: %v", filename, diagnostics[0])
+	}
+	graph, err := cfg.Build(result.Semantic.QuadrupleList())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return graph, graph.Liveness(), result.Semantic.VarList()
+}
+
+// interferences 由活跃变量独立地求出冲突的变量对，与build的规则相同：
+// 被定值的变量与该点之后活跃的其它变量冲突，复制语句d = s中d与s不冲突
+func interferences(graph *cfg.Graph, live *cfg.Liveness) [][2]string {
+	var pairs [][2]string
+	for index, q := range graph.Quadruples {
+		d := cfg.Def(q)
+		if d == "" {
+			continue
+		}
+		isMove := q.Op() == "=" && !semantic.IsConst(q.Arg1())
+		for v := range live.LiveOut[index] {
+			if v != d && !(isMove && v == q.Arg1()) {
+				pairs = append(pairs, [2]string{d, v})
+			}
+		}
+	}
+	return pairs
+}
+
+// checkAllocation 检查分配结果：冲突的变量不能合并，也不能分到同一个寄存器；
+// 每个变量要么有寄存器要么溢出；使用的寄存器不超过k个
+func checkAllocation(a *Allocation, graph *cfg.Graph, live *cfg.Liveness, vars []string, k int) error {
+	for _, pair := range interferences(graph, live) {
+		if a.find(pair[0]) == a.find(pair[1]) {
+			return fmt.Errorf("%s and %s interfere but were coalesced", pair[0], pair[1])
+		}
+		r0, ok0 := a.Register(pair[0])
+		r1, ok1 := a.Register(pair[1])
+		if ok0 && ok1 && r0 == r1 {
+			return fmt.Errorf("%s and %s interfere but share %s", pair[0], pair[1], r0)
+		}
+	}
+	spilled := make(map[string]bool)
+	for _, name := range a.Spilled {
+		spilled[name] = true
+	}
+	used := make(map[string]bool)
+	for _, name := range vars {
+		reg, ok := a.Register(name)
+		if ok == spilled[a.find(name)] {
+			return fmt.Errorf("%s: register %q, spilled %v", name, reg, spilled[a.find(name)])
+		}
+		if ok {
+			used[reg] = true
+		}
+	}
+	if len(used) > k {
+		return fmt.Errorf("%d registers used, only %d available", len(used), k)
+	}
+	return nil
+}
+
+func TestAllocate(t *testing.T) {
+	graph, live, vars := analyze(t, []byte(loop), "loop")
+	tests := []struct {
+		k         int
+		spilled   []string
+		coalesced map[string]string
+	}{
+		{0, []string{"a", "b", "c", "d", "e", "t1", "t2"}, map[string]string{}},
+		{1, []string{"b", "c", "d", "e", "t1"}, map[string]string{}},
+		//循环中活跃的变量多于寄存器时，先溢出只在循环外使用的b
+		{2, []string{"b", "d"}, map[string]string{}},
+		{3, []string{"b"}, map[string]string{"c": "t1"}},
+		//寄存器足够时复制链t1 → c → d合并为一个结点，a = t2也被合并
+		{11, []string{}, map[string]string{"c": "t1", "d": "t1", "a": "t2"}},
+	}
+	for _, test := range tests {
+		a := Allocate(graph, live, vars, test.k)
+		if err := checkAllocation(a, graph, live, vars, test.k); err != nil {
+			t.Errorf("k=%d: %v\n%s", test.k, err, a)
+		}
+		if !reflect.DeepEqual(a.Spilled, test.spilled) {
+			t.Errorf("k=%d: spilled %v, want %v\n%s", test.k, a.Spilled, test.spilled, a)
+		}
+		coalesced := make(map[string]string)
+		for name := range a.Coalesced {
+			coalesced[name] = a.find(name)
+		}
+		if !reflect.DeepEqual(coalesced, test.coalesced) {
+			t.Errorf("k=%d: coalesced %v, want %v\n%s", test.k, coalesced, test.coalesced, a)
+		}
+	}
+	//循环中的使用按10倍计算代价
+	if cost := Allocate(graph, live, vars, 0).SpillCost; cost["a"] != 33 || cost["b"] != 3 {
+		t.Errorf("spill cost of a = %v, b = %v, want 33, 3", cost["a"], cost["b"])
+	}
+}
+
+// TestAllocateCorpus 每个样例程序在各种寄存器数量下的分配结果都满足checkAllocation
+func TestAllocateCorpus(t *testing.T) {
+	programs, err := corpus.Programs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range programs {
+		p := p
+		t.Run(p.Name, func(t *testing.T) {
+			src, err := os.ReadFile(p.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			graph, live, vars := analyze(t, src, p.Path)
+			for _, k := range registerCounts {
+				a := Allocate(graph, live, vars, k)
+				if err := checkAllocation(a, graph, live, vars, k); err != nil {
+					t.Errorf("k=%d: %v\n%s", k, err, a)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package assembly
+
+// runtime 随生成代码一起输出的运行时，通过系统调用实现read和write，不依赖libc
+//
+// __read_int 从标准输入读取一个十进制整数（可带负号），跳过前导空白，结果放在rax中
+// __write_int 将rdi中的整数以十进制输出到标准输出，并追加换行
+const runtime = `__read_int:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $16, %rsp
+	xorq %r8, %r8
+	xorq %r9, %r9
+	xorq %r10, %r10
+1:
+	movq $0, %rax
+	movq $0, %rdi
+	leaq -1(%rbp), %rsi
+	movq $1, %rdx
+	syscall
+	cmpq $1, %rax
+	jne 3f
+	movzbq -1(%rbp), %rax
+	cmpq $45, %rax
+	jne 2f
+	testq %r10, %r10
+	jnz 3f
+	movq $1, %r9
+	jmp 1b
+2:
+	subq $48, %rax
+	cmpq $9, %rax
+	ja 4f
+	imulq $10, %r8
+	addq %rax, %r8
+	movq $1, %r10
+	jmp 1b
+4:
+	testq %r10, %r10
+	jz 1b
+3:
+	movq %r8, %rax
+	testq %r9, %r9
+	jz 5f
+	negq %rax
+5:
+	leave
+	ret
+
+__write_int:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $32, %rsp
+	movq %rdi, %rax
+	leaq -1(%rbp), %rsi
+	movb $10, (%rsi)
+	movq $10, %rcx
+	xorq %r8, %r8
+	testq %rax, %rax
+	jns 1f
+	negq %rax
+	movq $1, %r8
+1:
+	xorq %rdx, %rdx
+	divq %rcx
+	addb $48, %dl
+	decq %rsi
+	movb %dl, (%rsi)
+	testq %rax, %rax
+	jnz 1b
+	testq %r8, %r8
+	jz 2f
+	decq %rsi
+	movb $45, (%rsi)
+2:
+	movq $1, %rax
+	movq $1, %rdi
+	movq %rbp, %rdx
+	subq %rsi, %rdx
+	syscall
+	leave
+	ret`
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"chap4/bytecode"
+	"chap4/compiler"
+	"chap4/interpreter"
+	"io"
+	"strings"
+	"testing"
+)
+
+// benchSource 两种执行方式共同使用的程序
+const benchSource = "text/bench.txt"
+
+func compileBench(b *testing.B) *compiler.Result {
+	result, diagnostics := compiler.CompileFile(benchSource, compiler.Options{})
+	if compiler.HasErrors(diagnostics) {
+		b.Fatalf("%s does not compile: %v", benchSource, diagnostics)
+	}
+	return result
+}
+
+// BenchmarkVM 在字节码虚拟机上执行text/bench.txt，与BenchmarkInterpreter比较
+func BenchmarkVM(b *testing.B) {
+	program, err := bytecode.Compile(compileBench(b).Tree)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := bytecode.NewVM(program, strings.NewReader(""), io.Discard).Run(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkInterpreter 用四元式解释器执行text/bench.txt
+func BenchmarkInterpreter(b *testing.B) {
+	result := compileBench(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		in := interpreter.NewInterpreter(result.Semantic, strings.NewReader(""), io.Discard)
+		if err := in.Run(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package bytecode
+
+import (
+	"bytes"
+	"chap4/compiler"
+	"chap4/internal/corpus"
+	"chap4/interpreter"
+	"encoding/binary"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// countdown 读入a，输出a-1到0
+const countdown = "{ int a; bool c; read a; c := a > 0; while c do { a = a - 1; write a; c := a > 0; } }"
+
+// compile 编译源程序，返回字节码程序与四元式解释器的运行结果
+func compile(t *testing.T, src []byte, filename string) (*Program, string, error) {
+	t.Helper()
+	result, diagnostics := compiler.Compile(src, compiler.Options{Filename: filename})
+	if compiler.HasErrors(diagnostics) {
+		t.Skipf("%s does not compile: %v", filename, diagnostics[0])
+	}
+	program, err := Compile(result.Tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err = interpreter.NewInterpreter(result.Semantic, strings.NewReader(corpus.Input), &out).Run()
+	return program, out.String(), err
+}
+
+// TestCorpus 每个样例程序编码后能原样解码，虚拟机的运行结果与四元式解释器相同
+func TestCorpus(t *testing.T) {
+	programs, err := corpus.Programs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range programs {
+		p := p
+		t.Run(p.Name, func(t *testing.T) {
+			src, err := os.ReadFile(p.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			program, want, wantErr := compile(t, src, p.Path)
+			decoded, err := Decode(program.Encode())
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, program) {
+				t.Errorf("Decode(Encode(p)) = %+v, want %+v", decoded, program)
+			}
+			var out bytes.Buffer
+			err = NewVM(decoded, strings.NewReader(corpus.Input), &out).Run()
+			if (err != nil) != (wantErr != nil) {
+				t.Fatalf("vm error = %v, interpreter error = %v", err, wantErr)
+			}
+			if out.String() != want {
+				t.Errorf("vm output = %q, interpreter output = %q", out.String(), want)
+			}
+		})
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	program, _, _ := compile(t, []byte(countdown), "countdown")
+	want := `; max stack: 2
+; constants: 2
+;   #0 = 0
+;   #1 = 1
+; vars: 2
+;   0 = a
+;   1 = c
+0000  READ
+0001  STORE  0        ; a
+0006  LOAD   0        ; a
+0011  PUSH   #0       ; 0
+0016  GT
+0017  STORE  1        ; c
+0022  LOAD   1        ; c
+0027  JZ     0075
+0032  LOAD   0        ; a
+0037  PUSH   #1       ; 1
+0042  SUB
+0043  STORE  0        ; a
+0048  LOAD   0        ; a
+0053  WRITE
+0054  LOAD   0        ; a
+0059  PUSH   #0       ; 0
+0064  GT
+0065  STORE  1        ; c
+0070  JMP    0022
+0075  RET
+`
+	if got := Disassemble(program); got != want {
+		t.Errorf("Disassemble =\n%s\nwant\n%s", got, want)
+	}
+	var out bytes.Buffer
+	if err := NewVM(program, strings.NewReader("3"), &out).Run(); err != nil || out.String() != "2\n1\n0\n" {
+		t.Errorf("Run = %q, %v", out.String(), err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	push := func(k uint32) []byte {
+		return binary.LittleEndian.AppendUint32([]byte{byte(OpPush)}, k)
+	}
+	jump := func(op Opcode, addr uint32) []byte {
+		return binary.LittleEndian.AppendUint32([]byte{byte(op)}, addr)
+	}
+	concat := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	tests := []struct {
+		name string
+		code []byte
+		want string
+	}{
+		{"valid", concat(push(0), []byte{byte(OpWrite)}, jump(OpJmp, 6), []byte{byte(OpRet)}), ""},
+		{"jump to end", concat(jump(OpJmp, 5)), ""},
+		{"unknown opcode", []byte{0xff}, "unknown opcode"},
+		{"truncated instruction", push(0)[:3], "truncated instruction"},
+		{"constant out of range", push(1), "constant #1 out of range"},
+		{"variable out of range", jump(OpLoad, 2), "variable 2 out of range"},
+		{"jump into an instruction", concat(push(0), jump(OpJz, 2)), "bad jump target 0002"},
+		{"jump past the end", jump(OpCall, 6), "bad jump target 0006"},
+	}
+	for _, test := range tests {
+		p := &Program{Constants: []int64{7}, Vars: []string{"a", "b"}, Code: test.code, MaxStack: 1}
+		err := p.Verify()
+		if test.want == "" {
+			if err != nil {
+				t.Errorf("%s: Verify = %v", test.name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, BadCodeErr) || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: Verify = %v, want an error containing %q", test.name, err, test.want)
+		}
+	}
+}
+
+// TestDecodeInvalid 截断或计数被改写的文件都返回错误，不会按文件头中的计数分配内存
+func TestDecodeInvalid(t *testing.T) {
+	program, _, _ := compile(t, []byte(countdown), "countdown")
+	data := program.Encode()
+	for n := 0; n < len(data); n++ {
+		if _, err := Decode(data[:n]); err == nil {
+			t.Errorf("Decode of the first %d of %d bytes succeeded", n, len(data))
+		}
+	}
+	if _, err := Decode(append(data[:len(data):len(data)], 0)); !errors.Is(err, BadCodeErr) {
+		t.Errorf("Decode with a trailing byte = %v, want %v", err, BadCodeErr)
+	}
+	//文件头中各字段的偏移：maxStack 8，nConst 12，nVar 16，nCode 20，第一个变量名的长度在常量之后
+	nameLen := 24 + 8*len(program.Constants)
+	tests := []struct {
+		name   string
+		offset int
+		value  []byte
+		want   error
+	}{
+		{"magic", 0, []byte("QBC!"), BadMagicErr},
+		{"version", 4, []byte{2, 0}, BadVersionErr},
+		{"max stack", 8, []byte{0xff, 0xff, 0xff, 0x7f}, BadCodeErr},
+		{"constants", 12, []byte{0xff, 0xff, 0xff, 0x7f}, BadCodeErr},
+		{"variables", 16, []byte{0xff, 0xff, 0xff, 0x7f}, BadCodeErr},
+		{"code", 20, []byte{0xff, 0xff, 0xff, 0x7f}, BadCodeErr},
+		{"name length", nameLen, []byte{0xff, 0xff}, BadCodeErr},
+	}
+	for _, test := range tests {
+		corrupt := append([]byte(nil), data...)
+		copy(corrupt[test.offset:], test.value)
+		if _, err := Decode(corrupt); !errors.Is(err, test.want) {
+			t.Errorf("%s: Decode = %v, want %v", test.name, err, test.want)
+		}
+	}
+	if _, err := ReadFrom(bytes.NewReader(make([]byte, MaxFileSize+1))); !errors.Is(err, BadCodeErr) {
+		t.Errorf("ReadFrom of a file larger than MaxFileSize = %v, want %v", err, BadCodeErr)
+	}
+}
@@ -0,0 +1,433 @@
+package bytecode
+
+import (
+	"chap4/analyzer"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var (
+	EmptyTreeErr = errors.New("error: syntax tree is empty")
+)
+
+// Compiler 将语法树编译为栈式字节码
+type Compiler struct {
+	root      *analyzer.Node
+	code      []byte
+	constants []int64
+	constMap  map[int64]int  // 常量到常量池下标的映射
+	vars      []string       // 变量名，下标即为变量的槽号
+	varMap    map[string]int // 变量名到槽号的映射
+	varType   map[string]string
+	depth     int // 当前操作数栈深度
+	maxDepth  int
+}
+
+// NewCompiler 创建一个字节码编译器实例
+func NewCompiler(root *analyzer.Node) *Compiler {
+	return &Compiler{
+		root:      root,
+		code:      make([]byte, 0),
+		constants: make([]int64, 0),
+		constMap:  make(map[int64]int),
+		vars:      make([]string, 0),
+		varMap:    make(map[string]int),
+		varType:   make(map[string]string),
+	}
+}
+
+// Compile 编译语法树
+func Compile(root *analyzer.Node) (*Program, error) {
+	return NewCompiler(root).Compile()
+}
+
+// Compile 编译语法树，返回字节码程序
+// PROG   →    {  DECLS  STMTS  }
+func (c *Compiler) Compile() (*Program, error) {
+	if c.root == nil {
+		return nil, EmptyTreeErr
+	}
+	decls := c.root.LeftChild.RightBro
+	stmts := decls.RightBro
+	if err := c.compileDecls(decls); err != nil {
+		return nil, err
+	}
+	if err := c.compileSTMTS(stmts); err != nil {
+		return nil, err
+	}
+	c.emit(OpRet)
+	return &Program{
+		Constants: c.constants,
+		Vars:      c.vars,
+		Code:      c.code,
+		MaxStack:  c.maxDepth,
+	}, nil
+}
+
+// emit 生成一条不带操作数的指令
+func (c *Compiler) emit(op Opcode) {
+	c.code = append(c.code, byte(op))
+	c.adjustDepth(op)
+}
+
+// emitOperand 生成一条带操作数的指令，返回操作数所在位置以便回填
+func (c *Compiler) emitOperand(op Opcode, operand int) int {
+	c.code = append(c.code, byte(op))
+	pos := len(c.code)
+	c.code = binary.LittleEndian.AppendUint32(c.code, uint32(operand))
+	c.adjustDepth(op)
+	return pos
+}
+
+// patch 回填跳转地址
+func (c *Compiler) patch(pos, addr int) {
+	binary.LittleEndian.PutUint32(c.code[pos:], uint32(addr))
+}
+
+// adjustDepth 根据指令对操作数栈的影响更新栈深度
+func (c *Compiler) adjustDepth(op Opcode) {
+	switch op {
+	case OpPush, OpLoad, OpRead:
+		c.depth++
+	case OpStore, OpJz, OpWrite, OpAdd, OpSub, OpMul, OpDiv, OpGt, OpGe, OpLt, OpLe, OpEq, OpNe:
+		c.depth--
+	}
+	if c.depth > c.maxDepth {
+		c.maxDepth = c.depth
+	}
+}
+
+// constant 返回常量在常量池中的下标，不存在时加入常量池
+func (c *Compiler) constant(v int64) int {
+	if index, ok := c.constMap[v]; ok {
+		return index
+	}
+	c.constants = append(c.constants, v)
+	c.constMap[v] = len(c.constants) - 1
+	return len(c.constants) - 1
+}
+
+// slot 返回变量的槽号，并检查变量是否已声明
+func (c *Compiler) slot(id string, typ string) (int, error) {
+	index, ok := c.varMap[id]
+	if !ok {
+		return 0, fmt.Errorf("error: %s is not declared", id)
+	}
+	if c.varType[id] != typ {
+		return 0, fmt.Errorf("error: %s is not an %s", id, typ)
+	}
+	return index, nil
+}
+
+// compileDecls DECLS       →    DECL  DECLS    |   empty
+// DECL         →    int  NAMES  ;  |  bool  NAMES  ;
+// NAMES     →    NAME ,  NAMES  |  NAME
+func (c *Compiler) compileDecls(node *analyzer.Node) error {
+	for node.LeftChild.Class != analyzer.Empty {
+		decl := node.LeftChild
+		typ := "int"
+		if decl.LeftChild.Class == analyzer.Bool {
+			typ = "bool"
+		}
+		for names := decl.LeftChild.RightBro; names != nil; {
+			name := names.LeftChild
+			id := name.LeftChild.Token.Value
+			if _, ok := c.varMap[id]; ok {
+				return errors.New("Error: " + id + " has been declared")
+			}
+			c.vars = append(c.vars, id)
+			c.varMap[id] = len(c.vars) - 1
+			c.varType[id] = typ
+			if name.RightBro == nil {
+				break
+			}
+			names = name.RightBro.RightBro
+		}
+		node = decl.RightBro
+	}
+	return nil
+}
+
+// compileSTMTS STMTS       →    STMT  STMTS | ε
+func (c *Compiler) compileSTMTS(node *analyzer.Node) error {
+	for node.LeftChild.Class != analyzer.Empty {
+		stmt := node.LeftChild
+		if err := c.compileSTMT(stmt); err != nil {
+			return err
+		}
+		node = stmt.RightBro
+	}
+	return nil
+}
+
+// compileSTMT 编译语句
+// STMT      →    id  =  EXPR ;    |   id := BOOL ;
+// STMT      →    if   id   then  STMT  [else STMT]
+// STMT      →    while   id  do  STMT
+// STMT      →    {  STMTS  }
+// STMT      →    read  id  ;   |   write  id  ;
+func (c *Compiler) compileSTMT(node *analyzer.Node) error {
+	first := node.LeftChild
+	switch first.Class {
+	case analyzer.Id:
+		assign := first.RightBro
+		typ := "int"
+		if assign.Token.Value == ":=" {
+			typ = "bool"
+		}
+		index, err := c.slot(first.Token.Value, typ)
+		if err != nil {
+			return err
+		}
+		if typ == "int" {
+			err = c.compileExpr(assign.RightBro)
+		} else {
+			err = c.compileBOOL(assign.RightBro)
+		}
+		if err != nil {
+			return err
+		}
+		c.emitOperand(OpStore, index)
+	case analyzer.If:
+		id := first.RightBro
+		stmt := id.RightBro.RightBro
+		index, err := c.slot(id.Token.Value, "bool")
+		if err != nil {
+			return err
+		}
+		c.emitOperand(OpLoad, index)
+		elsePos := c.emitOperand(OpJz, 0)
+		if err := c.compileSTMT(stmt); err != nil {
+			return err
+		}
+		if stmt.RightBro == nil {
+			c.patch(elsePos, len(c.code))
+			return nil
+		}
+		endPos := c.emitOperand(OpJmp, 0)
+		c.patch(elsePos, len(c.code))
+		if err := c.compileSTMT(stmt.RightBro.RightBro); err != nil {
+			return err
+		}
+		c.patch(endPos, len(c.code))
+	case analyzer.While:
+		id := first.RightBro
+		stmt := id.RightBro.RightBro
+		index, err := c.slot(id.Token.Value, "bool")
+		if err != nil {
+			return err
+		}
+		start := len(c.code)
+		c.emitOperand(OpLoad, index)
+		endPos := c.emitOperand(OpJz, 0)
+		if err := c.compileSTMT(stmt); err != nil {
+			return err
+		}
+		c.emitOperand(OpJmp, start)
+		c.patch(endPos, len(c.code))
+	case analyzer.Read:
+		index, err := c.slotAny(first.RightBro.Token.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(OpRead)
+		c.emitOperand(OpStore, index)
+	case analyzer.Write:
+		index, err := c.slotAny(first.RightBro.Token.Value)
+		if err != nil {
+			return err
+		}
+		c.emitOperand(OpLoad, index)
+		c.emit(OpWrite)
+	case analyzer.LeftBracket:
+		return c.compileSTMTS(first.RightBro)
+	}
+	return nil
+}
+
+// slotAny 返回变量的槽号，不检查类型
+func (c *Compiler) slotAny(id string) (int, error) {
+	index, ok := c.varMap[id]
+	if !ok {
+		return 0, fmt.Errorf("error: %s is not declared", id)
+	}
+	return index, nil
+}
+
+// compileExpr EXPR → TERM EXPR1，EXPR1 → ADDOP TERM EXPR1 | empty，按左结合生成
+func (c *Compiler) compileExpr(node *analyzer.Node) error {
+	term := node.LeftChild
+	if err := c.compileTerm(term); err != nil {
+		return err
+	}
+	for expr1 := term.RightBro; expr1.LeftChild.Class != analyzer.Empty; {
+		addOp := expr1.LeftChild
+		term := addOp.RightBro
+		if err := c.compileTerm(term); err != nil {
+			return err
+		}
+		if addOp.LeftChild.Token.Value == "+" {
+			c.emit(OpAdd)
+		} else {
+			c.emit(OpSub)
+		}
+		expr1 = term.RightBro
+	}
+	return nil
+}
+
+// compileTerm TERM → NEGA TERM1，TERM1 → MULOP NEGA TERM1 | empty，按左结合生成
+func (c *Compiler) compileTerm(node *analyzer.Node) error {
+	nega := node.LeftChild
+	if err := c.compileNEGA(nega); err != nil {
+		return err
+	}
+	for term1 := nega.RightBro; term1.LeftChild.Class != analyzer.Empty; {
+		mulOp := term1.LeftChild
+		nega := mulOp.RightBro
+		if err := c.compileNEGA(nega); err != nil {
+			return err
+		}
+		if mulOp.LeftChild.Token.Value == "*" {
+			c.emit(OpMul)
+		} else {
+			c.emit(OpDiv)
+		}
+		term1 = nega.RightBro
+	}
+	return nil
+}
+
+// compileNEGA NEGA -> - FACTOR | FACTOR
+func (c *Compiler) compileNEGA(node *analyzer.Node) error {
+	if node.LeftChild.Class == analyzer.FACTOR {
+		return c.compileFactor(node.LeftChild)
+	}
+	factor := node.LeftChild.RightBro
+	//常数取负直接放入常量池
+	if factor.LeftChild.Class == analyzer.Number {
+		v, err := strconv.ParseInt(factor.LeftChild.Token.Value, 10, 64)
+		if err != nil {
+			return err
+		}
+		c.emitOperand(OpPush, c.constant(-v))
+		return nil
+	}
+	if err := c.compileFactor(factor); err != nil {
+		return err
+	}
+	c.emit(OpNeg)
+	return nil
+}
+
+// compileFactor FACTOR -> ID | NUMBER | ( EXPR )
+func (c *Compiler) compileFactor(node *analyzer.Node) error {
+	child := node.LeftChild
+	switch child.Class {
+	case analyzer.Id:
+		index, err := c.slot(child.Token.Value, "int")
+		if err != nil {
+			return err
+		}
+		c.emitOperand(OpLoad, index)
+	case analyzer.Number:
+		v, err := strconv.ParseInt(child.Token.Value, 10, 64)
+		if err != nil {
+			return err
+		}
+		c.emitOperand(OpPush, c.constant(v))
+	case analyzer.LeftBracket:
+		return c.compileExpr(child.RightBro)
+	default:
+		return errors.New("unknown error")
+	}
+	return nil
+}
+
+// compileBOOL BOOL → JOIN || BOOL | JOIN，短路求值
+// JOIN; JZ next; PUSH 1; JMP end; next: BOOL; end:
+func (c *Compiler) compileBOOL(node *analyzer.Node) error {
+	join := node.LeftChild
+	if err := c.compileJOIN(join); err != nil {
+		return err
+	}
+	if join.RightBro == nil {
+		return nil
+	}
+	nextPos := c.emitOperand(OpJz, 0)
+	c.emitOperand(OpPush, c.constant(1))
+	endPos := c.emitOperand(OpJmp, 0)
+	c.depth--
+	c.patch(nextPos, len(c.code))
+	if err := c.compileBOOL(join.RightBro.RightBro); err != nil {
+		return err
+	}
+	c.patch(endPos, len(c.code))
+	return nil
+}
+
+// compileJOIN JOIN → NOT && JOIN | NOT，短路求值
+// NOT; JZ false; JOIN; JMP end; false: PUSH 0; end:
+func (c *Compiler) compileJOIN(node *analyzer.Node) error {
+	not := node.LeftChild
+	if err := c.compileNOT(not); err != nil {
+		return err
+	}
+	if not.RightBro == nil {
+		return nil
+	}
+	falsePos := c.emitOperand(OpJz, 0)
+	if err := c.compileJOIN(not.RightBro.RightBro); err != nil {
+		return err
+	}
+	endPos := c.emitOperand(OpJmp, 0)
+	c.depth--
+	c.patch(falsePos, len(c.code))
+	c.emitOperand(OpPush, c.constant(0))
+	c.patch(endPos, len(c.code))
+	return nil
+}
+
+// compileNOT NOT → REL | ! REL | ! id | id
+func (c *Compiler) compileNOT(node *analyzer.Node) error {
+	child := node.LeftChild
+	negate := false
+	if child.Class == analyzer.Operator {
+		negate = true
+		child = child.RightBro
+	}
+	if child.Class == analyzer.Id {
+		index, err := c.slot(child.Token.Value, "bool")
+		if err != nil {
+			return err
+		}
+		c.emitOperand(OpLoad, index)
+	} else if err := c.compileREL(child); err != nil {
+		return err
+	}
+	if negate {
+		c.emit(OpNot)
+	}
+	return nil
+}
+
+// compileREL REL → EXPR ROP EXPR
+func (c *Compiler) compileREL(node *analyzer.Node) error {
+	expr1 := node.LeftChild
+	rop := expr1.RightBro
+	expr2 := rop.RightBro
+	if err := c.compileExpr(expr1); err != nil {
+		return err
+	}
+	if err := c.compileExpr(expr2); err != nil {
+		return err
+	}
+	op, ok := ropMap[rop.LeftChild.Token.Value]
+	if !ok {
+		return fmt.Errorf("error: unknown relational operator %s", rop.LeftChild.Token.Value)
+	}
+	c.emit(op)
+	return nil
+}
@@ -0,0 +1,44 @@
+package bytecode
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Disassemble 将字节码程序反汇编为可读的文本
+func Disassemble(p *Program) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("; max stack: %d\n", p.MaxStack))
+	b.WriteString(fmt.Sprintf("; constants: %d\n", len(p.Constants)))
+	for i, v := range p.Constants {
+		b.WriteString(fmt.Sprintf(";   #%d = %d\n", i, v))
+	}
+	b.WriteString(fmt.Sprintf("; vars: %d\n", len(p.Vars)))
+	for i, name := range p.Vars {
+		b.WriteString(fmt.Sprintf(";   %d = %s\n", i, name))
+	}
+	for pc := 0; pc < len(p.Code); {
+		op := Opcode(p.Code[pc])
+		if op.Size() == 1 || pc+op.Size() > len(p.Code) {
+			b.WriteString(fmt.Sprintf("%04d  %s\n", pc, op))
+			pc++
+			continue
+		}
+		operand := int(binary.LittleEndian.Uint32(p.Code[pc+1:]))
+		comment := ""
+		switch {
+		case op == OpPush && operand < len(p.Constants):
+			comment = fmt.Sprintf("#%d", operand)
+			b.WriteString(fmt.Sprintf("%04d  %-6s %-8s ; %d\n", pc, op, comment, p.Constants[operand]))
+		case (op == OpLoad || op == OpStore) && operand < len(p.Vars):
+			b.WriteString(fmt.Sprintf("%04d  %-6s %-8d ; %s\n", pc, op, operand, p.Vars[operand]))
+		case op.isJump():
+			b.WriteString(fmt.Sprintf("%04d  %-6s %04d\n", pc, op, operand))
+		default:
+			b.WriteString(fmt.Sprintf("%04d  %-6s %d\n", pc, op, operand))
+		}
+		pc += op.Size()
+	}
+	return b.String()
+}
@@ -0,0 +1,215 @@
+package bytecode
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// 字节码文件格式（小端序）：
+//
+//	magic     [4]byte  "CPBC"
+//	version   uint16
+//	reserved  uint16
+//	maxStack  uint32   操作数栈的最大深度
+//	nConst    uint32   常量池大小
+//	nVar      uint32   变量个数
+//	nCode     uint32   代码字节数
+//	constants [nConst]int64
+//	vars      [nVar]{len uint16, name [len]byte}
+//	code      [nCode]byte
+const (
+	Magic   = "CPBC"
+	Version = 1
+)
+
+var (
+	BadMagicErr   = errors.New("error: not a bytecode file")
+	BadVersionErr = errors.New("error: unsupported bytecode version")
+	BadCodeErr    = errors.New("error: invalid bytecode")
+)
+
+// Program 字节码程序
+type Program struct {
+	Constants []int64  // 常量池
+	Vars      []string // 变量名，下标即为槽号
+	Code      []byte
+	MaxStack  int
+}
+
+type header struct {
+	Magic    [4]byte
+	Version  uint16
+	Reserved uint16
+	MaxStack uint32
+	NConst   uint32
+	NVar     uint32
+	NCode    uint32
+}
+
+// Encode 将程序编码为二进制格式
+func (p *Program) Encode() []byte {
+	var buf bytes.Buffer
+	_ = p.Write(&buf)
+	return buf.Bytes()
+}
+
+// Write 将程序以二进制格式写入w
+func (p *Program) Write(w io.Writer) error {
+	h := header{
+		Version:  Version,
+		MaxStack: uint32(p.MaxStack),
+		NConst:   uint32(len(p.Constants)),
+		NVar:     uint32(len(p.Vars)),
+		NCode:    uint32(len(p.Code)),
+	}
+	copy(h.Magic[:], Magic)
+	bw := bufio.NewWriter(w)
+	if err := binary.Write(bw, binary.LittleEndian, h); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.LittleEndian, p.Constants); err != nil {
+		return err
+	}
+	for _, name := range p.Vars {
+		if err := binary.Write(bw, binary.LittleEndian, uint16(len(name))); err != nil {
+			return err
+		}
+		if _, err := bw.WriteString(name); err != nil {
+			return err
+		}
+	}
+	if _, err := bw.Write(p.Code); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// WriteFile 将程序写入文件
+func (p *Program) WriteFile(filename string) error {
+	return os.WriteFile(filename, p.Encode(), 0666)
+}
+
+// MaxFileSize 字节码文件的最大字节数，文件头中的各个计数都不能超出文件剩余的字节
+const MaxFileSize = 64 << 20
+
+// Decode 从二进制数据中解码程序，并校验指令的合法性；
+// 文件头中的计数在分配内存之前先与剩余的字节数比较，损坏的文件不会导致分配过大的内存
+func Decode(data []byte) (*Program, error) {
+	if len(data) > MaxFileSize {
+		return nil, fmt.Errorf("%w : file larger than %d bytes", BadCodeErr, MaxFileSize)
+	}
+	r := bytes.NewReader(data)
+	var h header
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return nil, fmt.Errorf("%w : %v", BadCodeErr, err)
+	}
+	if string(h.Magic[:]) != Magic {
+		return nil, BadMagicErr
+	}
+	if h.Version != Version {
+		return nil, BadVersionErr
+	}
+	//每个常量8字节，每个变量至少2字节；栈深度不超过代码的字节数，因为每条压栈指令至少占1字节
+	rest := uint64(r.Len())
+	switch {
+	case uint64(h.NConst)*8 > rest:
+		return nil, fmt.Errorf("%w : %d constants in %d bytes", BadCodeErr, h.NConst, rest)
+	case uint64(h.NVar)*2 > rest-uint64(h.NConst)*8:
+		return nil, fmt.Errorf("%w : %d variables in %d bytes", BadCodeErr, h.NVar, rest)
+	case uint64(h.NCode) > rest-uint64(h.NConst)*8-uint64(h.NVar)*2:
+		return nil, fmt.Errorf("%w : %d bytes of code in %d bytes", BadCodeErr, h.NCode, rest)
+	case h.MaxStack > h.NCode:
+		return nil, fmt.Errorf("%w : stack depth %d exceeds code size %d", BadCodeErr, h.MaxStack, h.NCode)
+	}
+	p := &Program{
+		Constants: make([]int64, h.NConst),
+		Vars:      make([]string, h.NVar),
+		MaxStack:  int(h.MaxStack),
+	}
+	if err := binary.Read(r, binary.LittleEndian, p.Constants); err != nil {
+		return nil, fmt.Errorf("%w : %v", BadCodeErr, err)
+	}
+	for i := range p.Vars {
+		var n uint16
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, fmt.Errorf("%w : %v", BadCodeErr, err)
+		}
+		if int(n) > r.Len() {
+			return nil, fmt.Errorf("%w : variable name of %d bytes in %d bytes", BadCodeErr, n, r.Len())
+		}
+		name := make([]byte, n)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return nil, fmt.Errorf("%w : %v", BadCodeErr, err)
+		}
+		p.Vars[i] = string(name)
+	}
+	if int(h.NCode) != r.Len() {
+		return nil, fmt.Errorf("%w : %d bytes of code, %d bytes left", BadCodeErr, h.NCode, r.Len())
+	}
+	p.Code = make([]byte, h.NCode)
+	if _, err := io.ReadFull(r, p.Code); err != nil {
+		return nil, fmt.Errorf("%w : %v", BadCodeErr, err)
+	}
+	if err := p.Verify(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ReadFile 从文件中读取程序
+func ReadFile(filename string) (*Program, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadFrom(f)
+}
+
+// ReadFrom 从r中读取程序，最多读取MaxFileSize字节
+func ReadFrom(r io.Reader) (*Program, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	return Decode(data)
+}
+
+// Verify 校验每条指令的操作码、常量下标、变量槽号以及跳转地址
+func (p *Program) Verify() error {
+	starts := make(map[int]bool)
+	jumps := make(map[int]int)
+	for pc := 0; pc < len(p.Code); {
+		op := Opcode(p.Code[pc])
+		if _, ok := opcodeInfo[op]; !ok {
+			return fmt.Errorf("%w : unknown opcode %d at %04d", BadCodeErr, op, pc)
+		}
+		if pc+op.Size() > len(p.Code) {
+			return fmt.Errorf("%w : truncated instruction at %04d", BadCodeErr, pc)
+		}
+		starts[pc] = true
+		if op.Size() > 1 {
+			operand := int(binary.LittleEndian.Uint32(p.Code[pc+1:]))
+			switch {
+			case op == OpPush && operand >= len(p.Constants):
+				return fmt.Errorf("%w : constant #%d out of range at %04d", BadCodeErr, operand, pc)
+			case (op == OpLoad || op == OpStore) && operand >= len(p.Vars):
+				return fmt.Errorf("%w : variable %d out of range at %04d", BadCodeErr, operand, pc)
+			case op.isJump():
+				jumps[pc] = operand
+			}
+		}
+		pc += op.Size()
+	}
+	for pc, target := range jumps {
+		if !starts[target] && target != len(p.Code) {
+			return fmt.Errorf("%w : bad jump target %04d at %04d", BadCodeErr, target, pc)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// Package bytecode 栈式字节码：由语法树编译、二进制格式读写、反汇编以及虚拟机
+//
+// 常量池、变量与操作数栈都是int64，整数运算与解释器一样按64位进行
+package bytecode
+
+// Opcode 字节码操作码
+type Opcode byte
+
+const (
+	OpPush  Opcode = iota + 1 // PUSH #k      将常量池中第k个常量压栈
+	OpLoad                    // LOAD n       将第n个变量压栈
+	OpStore                   // STORE n      弹出栈顶存入第n个变量
+	OpAdd                     // ADD          弹出b、a，压入a+b
+	OpSub                     // SUB          弹出b、a，压入a-b
+	OpMul                     // MUL          弹出b、a，压入a*b
+	OpDiv                     // DIV          弹出b、a，压入a/b
+	OpNeg                     // NEG          栈顶取负
+	OpGt                      // GT           弹出b、a，a>b时压入1，否则压入0
+	OpGe                      // GE
+	OpLt                      // LT
+	OpLe                      // LE
+	OpEq                      // EQ
+	OpNe                      // NE
+	OpNot                     // NOT          栈顶为0时变为1，否则变为0
+	OpJmp                     // JMP addr     无条件跳转
+	OpJz                      // JZ addr      弹出栈顶，为0时跳转
+	OpCall                    // CALL addr    返回地址压入调用栈后跳转
+	OpRet                     // RET          从调用栈弹出返回地址，调用栈为空时结束程序
+	OpRead                    // READ         读入一个整数压栈
+	OpWrite                   // WRITE        弹出栈顶并输出
+)
+
+// opcodeInfo 操作码的助记符以及是否带有4字节操作数
+var opcodeInfo = map[Opcode]struct {
+	name       string
+	hasOperand bool
+}{
+	OpPush:  {"PUSH", true},
+	OpLoad:  {"LOAD", true},
+	OpStore: {"STORE", true},
+	OpAdd:   {"ADD", false},
+	OpSub:   {"SUB", false},
+	OpMul:   {"MUL", false},
+	OpDiv:   {"DIV", false},
+	OpNeg:   {"NEG", false},
+	OpGt:    {"GT", false},
+	OpGe:    {"GE", false},
+	OpLt:    {"LT", false},
+	OpLe:    {"LE", false},
+	OpEq:    {"EQ", false},
+	OpNe:    {"NE", false},
+	OpNot:   {"NOT", false},
+	OpJmp:   {"JMP", true},
+	OpJz:    {"JZ", true},
+	OpCall:  {"CALL", true},
+	OpRet:   {"RET", false},
+	OpRead:  {"READ", false},
+	OpWrite: {"WRITE", false},
+}
+
+// String 返回操作码的助记符
+func (op Opcode) String() string {
+	if info, ok := opcodeInfo[op]; ok {
+		return info.name
+	}
+	return "UNKNOWN"
+}
+
+// Size 返回指令的字节数
+func (op Opcode) Size() int {
+	if opcodeInfo[op].hasOperand {
+		return 5
+	}
+	return 1
+}
+
+// isJump 判断操作数是否为跳转地址
+func (op Opcode) isJump() bool {
+	return op == OpJmp || op == OpJz || op == OpCall
+}
+
+// ropMap 关系运算符对应的操作码
+var ropMap = map[string]Opcode{
+	">":  OpGt,
+	">=": OpGe,
+	"<":  OpLt,
+	"<=": OpLe,
+	"==": OpEq,
+	"!=": OpNe,
+}
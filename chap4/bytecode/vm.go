@@ -0,0 +1,183 @@
+package bytecode
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+var (
+	DivisionByZeroErr = errors.New("runtime error: division by zero")
+	ReadErr           = errors.New("runtime error: cannot read an integer")
+	StackOverflowErr  = errors.New("runtime error: stack overflow")
+)
+
+// VM 栈式虚拟机
+type VM struct {
+	program *Program
+	vars    []int64
+	stack   []int64
+	calls   []int // 调用栈，保存返回地址
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+}
+
+// NewVM 创建一个虚拟机实例，READ从in中读取，WRITE输出到out
+func NewVM(p *Program, in io.Reader, out io.Writer) *VM {
+	return &VM{
+		program: p,
+		vars:    make([]int64, len(p.Vars)),
+		stack:   make([]int64, p.MaxStack+1),
+		calls:   make([]int, 0),
+		reader:  bufio.NewReader(in),
+		writer:  bufio.NewWriter(out),
+	}
+}
+
+// Vars 返回变量当前的值
+func (vm *VM) Vars() map[string]int64 {
+	vars := make(map[string]int64, len(vm.vars))
+	for i, name := range vm.program.Vars {
+		vars[name] = vm.vars[i]
+	}
+	return vars
+}
+
+// Run 执行程序，程序需已通过Verify校验
+func (vm *VM) Run() (err error) {
+	defer func() {
+		if flushErr := vm.writer.Flush(); err == nil {
+			err = flushErr
+		}
+	}()
+	defer func() {
+		//操作数栈越界说明文件头中的maxStack与代码不符
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w : %v", BadCodeErr, r)
+		}
+	}()
+	code := vm.program.Code
+	constants := vm.program.Constants
+	vars := vm.vars
+	stack := vm.stack
+	for i := range vars {
+		vars[i] = 0
+	}
+	vm.calls = vm.calls[:0]
+	sp, pc := 0, 0
+	for pc < len(code) {
+		op := Opcode(code[pc])
+		switch op {
+		case OpPush:
+			stack[sp] = constants[binary.LittleEndian.Uint32(code[pc+1:])]
+			sp++
+			pc += 5
+		case OpLoad:
+			stack[sp] = vars[binary.LittleEndian.Uint32(code[pc+1:])]
+			sp++
+			pc += 5
+		case OpStore:
+			sp--
+			vars[binary.LittleEndian.Uint32(code[pc+1:])] = stack[sp]
+			pc += 5
+		case OpAdd:
+			sp--
+			stack[sp-1] += stack[sp]
+			pc++
+		case OpSub:
+			sp--
+			stack[sp-1] -= stack[sp]
+			pc++
+		case OpMul:
+			sp--
+			stack[sp-1] *= stack[sp]
+			pc++
+		case OpDiv:
+			sp--
+			if stack[sp] == 0 {
+				return fmt.Errorf("%w : %04d", DivisionByZeroErr, pc)
+			}
+			stack[sp-1] /= stack[sp]
+			pc++
+		case OpNeg:
+			stack[sp-1] = -stack[sp-1]
+			pc++
+		case OpGt, OpGe, OpLt, OpLe, OpEq, OpNe:
+			sp--
+			stack[sp-1] = boolValue(compare(op, stack[sp-1], stack[sp]))
+			pc++
+		case OpNot:
+			stack[sp-1] = boolValue(stack[sp-1] == 0)
+			pc++
+		case OpJmp:
+			pc = int(binary.LittleEndian.Uint32(code[pc+1:]))
+		case OpJz:
+			sp--
+			if stack[sp] == 0 {
+				pc = int(binary.LittleEndian.Uint32(code[pc+1:]))
+			} else {
+				pc += 5
+			}
+		case OpCall:
+			if len(vm.calls) >= maxCallDepth {
+				return fmt.Errorf("%w : %04d", StackOverflowErr, pc)
+			}
+			vm.calls = append(vm.calls, pc+5)
+			pc = int(binary.LittleEndian.Uint32(code[pc+1:]))
+		case OpRet:
+			if len(vm.calls) == 0 {
+				return nil
+			}
+			pc = vm.calls[len(vm.calls)-1]
+			vm.calls = vm.calls[:len(vm.calls)-1]
+		case OpRead:
+			var v int64
+			if _, err := fmt.Fscan(vm.reader, &v); err != nil {
+				return fmt.Errorf("%w : %04d", ReadErr, pc)
+			}
+			stack[sp] = v
+			sp++
+			pc++
+		case OpWrite:
+			sp--
+			vm.writer.WriteString(strconv.FormatInt(stack[sp], 10))
+			vm.writer.WriteByte('\n')
+			pc++
+		default:
+			return fmt.Errorf("%w : unknown opcode %d at %04d", BadCodeErr, op, pc)
+		}
+	}
+	return nil
+}
+
+// maxCallDepth 调用栈的最大深度
+const maxCallDepth = 1 << 16
+
+func boolValue(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// compare 计算关系运算
+func compare(op Opcode, a, b int64) bool {
+	switch op {
+	case OpGt:
+		return a > b
+	case OpGe:
+		return a >= b
+	case OpLt:
+		return a < b
+	case OpLe:
+		return a <= b
+	case OpEq:
+		return a == b
+	case OpNe:
+		return a != b
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+// Package cfg 由四元式列表构造控制流图（基本块划分）并进行活跃变量分析
+package cfg
+
+import (
+	"chap4/semantic"
+	"fmt"
+	"sort"
+)
+
+// Block 基本块，包含四元式下标区间[Start, End)
+type Block struct {
+	Index int
+	Start int
+	End   int
+	Succs []*Block
+	Preds []*Block
+}
+
+// Graph 控制流图
+type Graph struct {
+	Quadruples []*semantic.Quadruple
+	Blocks     []*Block
+	blockOf    map[int]*Block // 首指令下标到基本块的映射
+}
+
+// String 将基本块转换为字符串
+func (b *Block) String() string {
+	return fmt.Sprintf("B%d[%d,%d)", b.Index, b.Start, b.End)
+}
+
+// Last 返回基本块的最后一条四元式的下标
+func (b *Block) Last() int {
+	return b.End - 1
+}
+
+// Build 构造控制流图
+func Build(list []*semantic.Quadruple) (*Graph, error) {
+	g := &Graph{
+		Quadruples: list,
+		Blocks:     make([]*Block, 0),
+		blockOf:    make(map[int]*Block),
+	}
+	if len(list) == 0 {
+		return g, nil
+	}
+	//确定首指令：第一条四元式、跳转目标、跳转指令的下一条
+	leaders := map[int]bool{0: true}
+	for index, q := range list {
+		if q.IsJump() {
+			target, err := q.JumpTarget()
+			if err != nil {
+				return nil, err
+			}
+			if target < 0 || target > len(list) {
+				return nil, fmt.Errorf("error: jump target %d out of range at %d", target, index)
+			}
+			if target < len(list) {
+				leaders[target] = true
+			}
+		}
+		if (q.IsJump() || q.Op() == "quit") && index+1 < len(list) {
+			leaders[index+1] = true
+		}
+	}
+	starts := make([]int, 0, len(leaders))
+	for start := range leaders {
+		starts = append(starts, start)
+	}
+	sort.Ints(starts)
+	for i, start := range starts {
+		end := len(list)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		block := &Block{Index: i, Start: start, End: end}
+		g.Blocks = append(g.Blocks, block)
+		g.blockOf[start] = block
+	}
+	//连接后继与前驱
+	for i, block := range g.Blocks {
+		q := list[block.Last()]
+		fallThrough := q.Op() != "j" && q.Op() != "quit"
+		if q.IsJump() {
+			target, _ := q.JumpTarget()
+			if succ, ok := g.blockOf[target]; ok {
+				g.addEdge(block, succ)
+			}
+		}
+		if fallThrough && i+1 < len(g.Blocks) {
+			g.addEdge(block, g.Blocks[i+1])
+		}
+	}
+	return g, nil
+}
+
+// addEdge 添加一条控制流边，重复的边只保留一条
+func (g *Graph) addEdge(from, to *Block) {
+	for _, succ := range from.Succs {
+		if succ == to {
+			return
+		}
+	}
+	from.Succs = append(from.Succs, to)
+	to.Preds = append(to.Preds, from)
+}
+
+// BlockAt 返回以下标index为首指令的基本块，不存在时返回nil
+func (g *Graph) BlockAt(index int) *Block {
+	return g.blockOf[index]
+}
+
+// BlockOf 返回包含下标index的四元式的基本块
+func (g *Graph) BlockOf(index int) *Block {
+	i := sort.Search(len(g.Blocks), func(i int) bool {
+		return g.Blocks[i].End > index
+	})
+	if i == len(g.Blocks) {
+		return nil
+	}
+	return g.Blocks[i]
+}
+
+// LoopDepth 计算每个基本块的循环嵌套深度
+// 四元式由结构化的while语句生成，回边(后继的首指令不在当前块之后)与其目标之间的基本块即为循环体
+func (g *Graph) LoopDepth() map[*Block]int {
+	depth := make(map[*Block]int)
+	for _, block := range g.Blocks {
+		for _, succ := range block.Succs {
+			if succ.Start > block.Start {
+				continue
+			}
+			for i := succ.Index; i <= block.Index; i++ {
+				depth[g.Blocks[i]]++
+			}
+		}
+	}
+	return depth
+}
+
+// Uses 返回四元式使用的变量
+func Uses(q *semantic.Quadruple) []string {
+	var args []string
+	switch q.Op() {
+	case "+", "-", "*", "/", "j>", "j>=", "j<", "j<=", "j==", "j!=":
+		args = []string{q.Arg1(), q.Arg2()}
+	case "=", ":=", "jnz", "write":
+		args = []string{q.Arg1()}
+	}
+	uses := make([]string, 0, len(args))
+	for _, arg := range args {
+		if !semantic.IsConst(arg) {
+			uses = append(uses, arg)
+		}
+	}
+	return uses
+}
+
+// Def 返回四元式定值的变量，没有定值时返回空串
+func Def(q *semantic.Quadruple) string {
+	switch q.Op() {
+	case "+", "-", "*", "/", "=", ":=":
+		return q.Result()
+	case "read":
+		return q.Arg1()
+	}
+	return ""
+}
@@ -0,0 +1,125 @@
+package cfg_test
+
+import (
+	"chap4/cfg"
+	"chap4/compiler"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// loop 含有复制语句与while循环的小程序，四元式为：
+//
+//	0: (read, a, _, mem)     8: (j, _, _, 10)          16: (:=, 1, _, e)
+//	1: (read, b, _, mem)     9: (:=, 0, _, e)          17: (j, _, _, 19)
+//	2: (+, a, b, t1)        10: (jnz, e, _, 12)        18: (:=, 0, _, e)
+//	3: (=, t1, _, c)        11: (j, _, _, 20)          19: (j, _, _, 10)
+//	4: (=, c, _, d)         12: (-, a, d, t2)          20: (write, b, _, mem)
+//	5: (j>, a, 0, 7)        13: (=, t2, _, a)          21: (quit, _, _, _)
+//	6: (j, _, _, 9)         14: (j>, a, 0, 16)
+//	7: (:=, 1, _, e)        15: (j, _, _, 18)
+const loop = "{ int a, b, c, d; bool e; read a; read b; c = a + b; d = c; e := a > 0; while e do { a = a - d; e := a > 0; } write b; }"
+
+func build(t *testing.T) *cfg.Graph {
+	t.Helper()
+	result, diagnostics := compiler.Compile([]byte(loop), compiler.Options{})
+	if compiler.HasErrors(diagnostics) {
+		t.Fatal(diagnostics)
+	}
+	graph, err := cfg.Build(result.Semantic.QuadrupleList())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return graph
+}
+
+// sorted 集合中的变量按字典序排列
+func sorted(s cfg.Set) []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestBuild(t *testing.T) {
+	graph := build(t)
+	want := []struct {
+		start, end int
+		succs      []int
+	}{
+		{0, 6, []int{2, 1}},
+		{6, 7, []int{3}},
+		{7, 9, []int{4}},
+		{9, 10, []int{4}},
+		{10, 11, []int{6, 5}},
+		{11, 12, []int{11}},
+		{12, 15, []int{8, 7}},
+		{15, 16, []int{9}},
+		{16, 18, []int{10}},
+		{18, 19, []int{10}},
+		{19, 20, []int{4}},
+		{20, 22, nil},
+	}
+	if len(graph.Blocks) != len(want) {
+		t.Fatalf("%d blocks, want %d", len(graph.Blocks), len(want))
+	}
+	for i, block := range graph.Blocks {
+		var succs []int
+		for _, succ := range block.Succs {
+			succs = append(succs, succ.Index)
+		}
+		if block.Start != want[i].start || block.End != want[i].end || !reflect.DeepEqual(succs, want[i].succs) {
+			t.Errorf("%s -> %v, want [%d,%d) -> %v", block, succs, want[i].start, want[i].end, want[i].succs)
+		}
+	}
+	if b := graph.BlockOf(13); b != graph.Blocks[6] {
+		t.Errorf("BlockOf(13) = %v", b)
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	graph := build(t)
+	live := graph.Liveness()
+	//t1只在复制给c之前活跃；e在循环头活跃，在循环体中先定值后使用
+	liveOut := map[int][]string{
+		1:  {"a", "b"},
+		2:  {"a", "b", "t1"},
+		4:  {"a", "b", "d"},
+		11: {"b"},
+		12: {"b", "d", "t2"},
+		19: {"a", "b", "d", "e"},
+		20: {},
+	}
+	for index, want := range liveOut {
+		if got := sorted(live.LiveOut[index]); !reflect.DeepEqual(got, want) {
+			t.Errorf("live after %d: %v, want %v", index, got, want)
+		}
+	}
+	in := map[int][]string{
+		0:  {},
+		4:  {"a", "b", "d", "e"},
+		6:  {"a", "b", "d"},
+		11: {"b"},
+	}
+	for index, want := range in {
+		if got := sorted(live.In[graph.Blocks[index]]); !reflect.DeepEqual(got, want) {
+			t.Errorf("in[B%d] = %v, want %v", index, got, want)
+		}
+	}
+}
+
+func TestLoopDepth(t *testing.T) {
+	graph := build(t)
+	depth := graph.LoopDepth()
+	for _, block := range graph.Blocks {
+		want := 0
+		if block.Start >= 10 && block.Start < 20 {
+			want = 1
+		}
+		if depth[block] != want {
+			t.Errorf("depth of %s = %d, want %d", block, depth[block], want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package cfg
+
+import "sort"
+
+// DominatorTree 支配树，只包含从入口可达的基本块
+type DominatorTree struct {
+	Idom     map[*Block]*Block   // 直接支配结点，入口结点的直接支配结点为其自身
+	Children map[*Block][]*Block // 支配树中的子结点，按逆后序排列
+	RPO      map[*Block]int      // 逆后序编号
+	Order    []*Block            // 按逆后序排列的基本块
+}
+
+// ReversePostorder 返回从入口可达的基本块的逆后序序列
+func (g *Graph) ReversePostorder() []*Block {
+	if len(g.Blocks) == 0 {
+		return nil
+	}
+	visited := make(map[*Block]bool)
+	post := make([]*Block, 0, len(g.Blocks))
+	var dfs func(b *Block)
+	dfs = func(b *Block) {
+		visited[b] = true
+		for _, succ := range b.Succs {
+			if !visited[succ] {
+				dfs(succ)
+			}
+		}
+		post = append(post, b)
+	}
+	dfs(g.Blocks[0])
+	for i, j := 0, len(post)-1; i < j; i, j = i+1, j-1 {
+		post[i], post[j] = post[j], post[i]
+	}
+	return post
+}
+
+// DominatorTree 使用Cooper-Harvey-Kennedy迭代算法计算支配树
+func (g *Graph) DominatorTree() *DominatorTree {
+	order := g.ReversePostorder()
+	t := &DominatorTree{
+		Idom:     make(map[*Block]*Block),
+		Children: make(map[*Block][]*Block),
+		RPO:      make(map[*Block]int),
+		Order:    order,
+	}
+	if len(order) == 0 {
+		return t
+	}
+	for i, b := range order {
+		t.RPO[b] = i
+	}
+	entry := order[0]
+	t.Idom[entry] = entry
+	intersect := func(a, b *Block) *Block {
+		for a != b {
+			for t.RPO[a] > t.RPO[b] {
+				a = t.Idom[a]
+			}
+			for t.RPO[b] > t.RPO[a] {
+				b = t.Idom[b]
+			}
+		}
+		return a
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, b := range order[1:] {
+			var idom *Block
+			for _, pred := range b.Preds {
+				if _, ok := t.Idom[pred]; !ok {
+					continue
+				}
+				if idom == nil {
+					idom = pred
+				} else {
+					idom = intersect(pred, idom)
+				}
+			}
+			if t.Idom[b] != idom {
+				t.Idom[b] = idom
+				changed = true
+			}
+		}
+	}
+	for _, b := range order[1:] {
+		parent := t.Idom[b]
+		t.Children[parent] = append(t.Children[parent], b)
+	}
+	for _, children := range t.Children {
+		sort.Slice(children, func(i, j int) bool {
+			return t.RPO[children[i]] < t.RPO[children[j]]
+		})
+	}
+	return t
+}
+
+// Dominates 判断a是否支配b
+func (t *DominatorTree) Dominates(a, b *Block) bool {
+	for {
+		if a == b {
+			return true
+		}
+		idom, ok := t.Idom[b]
+		if !ok || idom == b {
+			return false
+		}
+		b = idom
+	}
+}
+
+// IsBackEdge 判断from到to的边是否为回边（目标的逆后序编号不大于源）
+func (t *DominatorTree) IsBackEdge(from, to *Block) bool {
+	return t.RPO[to] <= t.RPO[from]
+}
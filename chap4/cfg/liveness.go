@@ -0,0 +1,102 @@
+package cfg
+
+// Set 变量集合
+type Set map[string]bool
+
+// Copy 复制集合
+func (s Set) Copy() Set {
+	c := make(Set, len(s))
+	for k := range s {
+		c[k] = true
+	}
+	return c
+}
+
+// Equal 判断两个集合是否相等
+func (s Set) Equal(o Set) bool {
+	if len(s) != len(o) {
+		return false
+	}
+	for k := range s {
+		if !o[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// Liveness 活跃变量分析的结果
+type Liveness struct {
+	In      map[*Block]Set // 基本块入口处活跃的变量
+	Out     map[*Block]Set // 基本块出口处活跃的变量
+	LiveOut []Set          // 每条四元式之后活跃的变量
+}
+
+// Liveness 对控制流图进行活跃变量分析
+// in[B] = use[B] ∪ (out[B] - def[B]), out[B] = ∪ in[S], S为B的后继
+func (g *Graph) Liveness() *Liveness {
+	use := make(map[*Block]Set)
+	def := make(map[*Block]Set)
+	for _, block := range g.Blocks {
+		use[block] = make(Set)
+		def[block] = make(Set)
+		for i := block.Start; i < block.End; i++ {
+			q := g.Quadruples[i]
+			for _, v := range Uses(q) {
+				if !def[block][v] {
+					use[block][v] = true
+				}
+			}
+			if d := Def(q); d != "" {
+				def[block][d] = true
+			}
+		}
+	}
+	live := &Liveness{
+		In:      make(map[*Block]Set),
+		Out:     make(map[*Block]Set),
+		LiveOut: make([]Set, len(g.Quadruples)),
+	}
+	for _, block := range g.Blocks {
+		live.In[block] = make(Set)
+		live.Out[block] = make(Set)
+	}
+	for changed := true; changed; {
+		changed = false
+		for i := len(g.Blocks) - 1; i >= 0; i-- {
+			block := g.Blocks[i]
+			out := make(Set)
+			for _, succ := range block.Succs {
+				for v := range live.In[succ] {
+					out[v] = true
+				}
+			}
+			in := use[block].Copy()
+			for v := range out {
+				if !def[block][v] {
+					in[v] = true
+				}
+			}
+			if !in.Equal(live.In[block]) || !out.Equal(live.Out[block]) {
+				changed = true
+			}
+			live.In[block] = in
+			live.Out[block] = out
+		}
+	}
+	//由基本块出口逆序推出每条四元式之后的活跃变量
+	for _, block := range g.Blocks {
+		current := live.Out[block].Copy()
+		for i := block.Last(); i >= block.Start; i-- {
+			live.LiveOut[i] = current.Copy()
+			q := g.Quadruples[i]
+			if d := Def(q); d != "" {
+				delete(current, d)
+			}
+			for _, v := range Uses(q) {
+				current[v] = true
+			}
+		}
+	}
+	return live
+}
@@ -0,0 +1,572 @@
+package main
+
+import (
+	"bytes"
+	"chap4/analyzer"
+	"chap4/assembly"
+	"chap4/bytecode"
+	"chap4/compiler"
+	"chap4/csource"
+	"chap4/debugger"
+	"chap4/interpreter"
+	"chap4/lexer"
+	"chap4/llvm"
+	"chap4/lsp"
+	"chap4/repl"
+	"chap4/wat"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// newFlagSet 创建子命令的选项集合
+func newFlagSet(e *env, name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "usage: cpc %s %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags 解析选项，返回值不为-1时子命令应直接以该值退出
+func parseFlags(fs *flag.FlagSet, args []string) int {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	return -1
+}
+
+// compileSource 编译一个源程序，诊断信息输出到标准错误
+func compileSource(e *env, s source, stop compiler.Phase) (*compiler.Result, bool) {
+	result, diagnostics := compiler.Compile(s.data, compiler.Options{Filename: s.name, StopAfter: stop})
+	for _, d := range diagnostics {
+		fmt.Fprintln(e.stderr, d)
+	}
+	return result, !compiler.HasErrors(diagnostics)
+}
+
+// writeJSON 以缩进格式输出JSON，不转义<、>
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// forEachSource 读取源程序并打开输出，依次处理每个源程序，返回退出码
+func forEachSource(e *env, fs *flag.FlagSet, out string, handle func(w io.Writer, sources []source, s source) (bool, error)) int {
+	sources, err := readSources(e, fs.Args())
+	if err != nil {
+		fmt.Fprintln(e.stderr, "cpc:", err)
+		return exitRuntime
+	}
+	w, closeOutput, err := output(e, out)
+	if err != nil {
+		fmt.Fprintln(e.stderr, "cpc:", err)
+		return exitRuntime
+	}
+	code := exitOK
+	for _, s := range sources {
+		ok, err := handle(w, sources, s)
+		if err != nil {
+			fmt.Fprintln(e.stderr, "cpc:", err)
+			code = exitRuntime
+			break
+		}
+		if !ok {
+			code = exitCompile
+		}
+	}
+	if err := closeOutput(); err != nil && code == exitOK {
+		fmt.Fprintln(e.stderr, "cpc:", err)
+		code = exitRuntime
+	}
+	return code
+}
+
+// tokenJSON 单词的JSON形式，种别用名字表示
+type tokenJSON struct {
+	Class string         `json:"class"`
+	Value string         `json:"value"`
+	Pos   lexer.Position `json:"pos"`
+}
+
+func runLex(e *env, args []string) int {
+	fs := newFlagSet(e, "lex", "[-format text|json] [-o file] [file ...]")
+	format := fs.String("format", "text", "output format: text or json")
+	out := fs.String("o", "", "write output to `file`")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if !oneOf(e, "format", *format, "text", "json") {
+		return exitUsage
+	}
+	return forEachSource(e, fs, *out, func(w io.Writer, sources []source, s source) (bool, error) {
+		result, ok := compileSource(e, s, compiler.PhaseLex)
+		if *format == "json" {
+			tokens := make([]tokenJSON, 0, len(result.Tokens))
+			for _, token := range result.Tokens {
+				tokens = append(tokens, tokenJSON{lexer.ClassName(token.Class), token.Value, token.Pos})
+			}
+			return ok, writeJSON(w, struct {
+				File   string      `json:"file"`
+				Tokens []tokenJSON `json:"tokens"`
+			}{s.name, tokens})
+		}
+		header(w, sources, s)
+		for _, token := range result.Tokens {
+			if _, err := fmt.Fprintf(w, "%-8s %-10s %s\n", token.Pos, lexer.ClassName(token.Class), token.Value); err != nil {
+				return ok, err
+			}
+		}
+		return ok, nil
+	})
+}
+
+func runParse(e *env, args []string) int {
+	fs := newFlagSet(e, "parse", "[-format text|dot|json] [-o file] [file ...]")
+	format := fs.String("format", "text", "output format: text, dot or json")
+	out := fs.String("o", "", "write output to `file`")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if !oneOf(e, "format", *format, "text", "dot", "json") {
+		return exitUsage
+	}
+	return forEachSource(e, fs, *out, func(w io.Writer, sources []source, s source) (bool, error) {
+		result, ok := compileSource(e, s, compiler.PhaseParse)
+		if !ok {
+			return false, nil
+		}
+		switch *format {
+		case "dot":
+			_, err := io.WriteString(w, analyzer.Dot(result.Tree))
+			return true, err
+		case "json":
+			tree, err := analyzer.JSON(result.Tree)
+			if err != nil {
+				return true, err
+			}
+			return true, writeJSON(w, struct {
+				File string          `json:"file"`
+				Tree json.RawMessage `json:"tree"`
+			}{s.name, tree})
+		}
+		header(w, sources, s)
+		_, err := io.WriteString(w, analyzer.FormatTree(result.Tree))
+		return true, err
+	})
+}
+
+func runTrace(e *env, args []string) int {
+	fs := newFlagSet(e, "trace", "[-format text|json] [-o file] [file ...]")
+	format := fs.String("format", "text", "output format: text or json")
+	out := fs.String("o", "", "write output to `file`")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if !oneOf(e, "format", *format, "text", "json") {
+		return exitUsage
+	}
+	return forEachSource(e, fs, *out, func(w io.Writer, sources []source, s source) (bool, error) {
+		result, diagnostics := compiler.Compile(s.data, compiler.Options{Filename: s.name, StopAfter: compiler.PhaseParse, Trace: true})
+		for _, d := range diagnostics {
+			fmt.Fprintln(e.stderr, d)
+		}
+		ok := !compiler.HasErrors(diagnostics)
+		//词法分析出错时没有进行语法分析，也就没有跟踪结果
+		if result.Trace == nil {
+			return ok, nil
+		}
+		if *format == "json" {
+			trace, err := result.Trace.JSON()
+			if err != nil {
+				return ok, err
+			}
+			return ok, writeJSON(w, struct {
+				File  string          `json:"file"`
+				Trace json.RawMessage `json:"trace"`
+			}{s.name, trace})
+		}
+		header(w, sources, s)
+		_, err := io.WriteString(w, result.Trace.Text())
+		return ok, err
+	})
+}
+
+func runCheck(e *env, args []string) int {
+	fs := newFlagSet(e, "check", "[-format text|json] [-o file] [file ...]")
+	format := fs.String("format", "text", "output format: text or json")
+	out := fs.String("o", "", "write output to `file`")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if !oneOf(e, "format", *format, "text", "json") {
+		return exitUsage
+	}
+	return forEachSource(e, fs, *out, func(w io.Writer, sources []source, s source) (bool, error) {
+		_, diagnostics := compiler.Compile(s.data, compiler.Options{Filename: s.name})
+		ok := !compiler.HasErrors(diagnostics)
+		if *format == "json" {
+			if diagnostics == nil {
+				diagnostics = []compiler.Diagnostic{}
+			}
+			return ok, writeJSON(w, struct {
+				File        string                `json:"file"`
+				Diagnostics []compiler.Diagnostic `json:"diagnostics"`
+			}{s.name, diagnostics})
+		}
+		for _, d := range diagnostics {
+			if _, err := fmt.Fprintln(w, d); err != nil {
+				return ok, err
+			}
+		}
+		return ok, nil
+	})
+}
+
+func runIR(e *env, args []string) int {
+	fs := newFlagSet(e, "ir", "[-S] [-o file] [file ...]")
+	withSource := fs.Bool("S", false, "interleave source lines as comments")
+	out := fs.String("o", "", "write output to `file`")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	return forEachSource(e, fs, *out, func(w io.Writer, sources []source, s source) (bool, error) {
+		result, ok := compileSource(e, s, "")
+		if !ok {
+			return false, nil
+		}
+		header(w, sources, s)
+		if *withSource {
+			_, err := io.WriteString(w, result.Semantic.Listing(s.data))
+			return true, err
+		}
+		for index, q := range result.IR {
+			if _, err := fmt.Fprintf(w, "%d: %s\n", index, q); err != nil {
+				return true, err
+			}
+		}
+		return true, nil
+	})
+}
+
+// readOne 读取唯一的一个源程序
+func readOne(e *env, fs *flag.FlagSet) (source, int) {
+	if fs.NArg() > 1 {
+		fmt.Fprintln(e.stderr, "cpc: at most one source file is allowed")
+		return source{}, exitUsage
+	}
+	sources, err := readSources(e, fs.Args())
+	if err != nil {
+		fmt.Fprintln(e.stderr, "cpc:", err)
+		return source{}, exitRuntime
+	}
+	return sources[0], exitOK
+}
+
+// compileOne 读取并编译唯一的一个源程序
+func compileOne(e *env, fs *flag.FlagSet) (source, *compiler.Result, int) {
+	s, code := readOne(e, fs)
+	if code != exitOK {
+		return s, nil, code
+	}
+	result, ok := compileSource(e, s, "")
+	if !ok {
+		return s, nil, exitCompile
+	}
+	return s, result, exitOK
+}
+
+// isBytecode 判断文件是否为cpc build -target bytecode生成的字节码文件
+func isBytecode(s source) bool {
+	return bytes.HasPrefix(s.data, []byte(bytecode.Magic))
+}
+
+// loadProgram 取得vm引擎执行的字节码：字节码文件直接解码并校验，源程序先编译
+func loadProgram(e *env, s source) (*bytecode.Program, int) {
+	if isBytecode(s) {
+		program, err := bytecode.Decode(s.data)
+		if err != nil {
+			fmt.Fprintf(e.stderr, "cpc: %s: %v\n", s.name, err)
+			return nil, exitRuntime
+		}
+		return program, exitOK
+	}
+	result, ok := compileSource(e, s, "")
+	if !ok {
+		return nil, exitCompile
+	}
+	program, err := bytecode.Compile(result.Tree)
+	if err != nil {
+		fmt.Fprintln(e.stderr, err)
+		return nil, exitCompile
+	}
+	return program, exitOK
+}
+
+// printProfile 按源程序的行输出执行统计
+func printProfile(w io.Writer, src []byte, profile []interpreter.LineProfile) {
+	lines := strings.Split(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n")
+	fmt.Fprintf(w, "%6s %10s  %s\n", "line", "count", "source")
+	for _, p := range profile {
+		text := ""
+		if p.Line <= len(lines) {
+			text = strings.TrimSpace(lines[p.Line-1])
+		}
+		fmt.Fprintf(w, "%6d %10d  %s\n", p.Line, p.Count, text)
+	}
+}
+
+// runRun 执行源程序；-engine vm时也可以执行cpc build -target bytecode生成的.qbc文件
+func runRun(e *env, args []string) int {
+	fs := newFlagSet(e, "run", "[-engine quad|vm] [-input file] [-profile] [-o file] [file|file.qbc]")
+	engine := fs.String("engine", "quad", "execution engine: quad (quadruple interpreter) or vm (bytecode vm)")
+	inputFile := fs.String("input", "", "read the program's input from `file` instead of standard input")
+	profile := fs.Bool("profile", false, "print the number of quadruples executed per source line to standard error (quad engine only)")
+	out := fs.String("o", "", "write the program's output to `file`")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if !oneOf(e, "engine", *engine, "quad", "vm") {
+		return exitUsage
+	}
+	if *profile && *engine != "quad" {
+		fmt.Fprintln(e.stderr, "cpc: -profile requires -engine quad")
+		return exitUsage
+	}
+	s, code := readOne(e, fs)
+	if code != exitOK {
+		return code
+	}
+	if isBytecode(s) && *engine != "vm" {
+		fmt.Fprintf(e.stderr, "cpc: %s is a bytecode file, which requires -engine vm\n", s.name)
+		return exitUsage
+	}
+	var result *compiler.Result
+	var program *bytecode.Program
+	if *engine == "vm" {
+		program, code = loadProgram(e, s)
+	} else {
+		var ok bool
+		result, ok = compileSource(e, s, "")
+		if !ok {
+			code = exitCompile
+		}
+	}
+	if code != exitOK {
+		return code
+	}
+	//源程序来自标准输入时，程序的输入只能来自-input
+	var in io.Reader = e.stdin
+	if *inputFile != "" {
+		f, err := os.Open(*inputFile)
+		if err != nil {
+			fmt.Fprintln(e.stderr, "cpc:", err)
+			return exitRuntime
+		}
+		defer f.Close()
+		in = f
+	} else if s.name == "<stdin>" {
+		in = bytes.NewReader(nil)
+	}
+	w, closeOutput, err := output(e, *out)
+	if err != nil {
+		fmt.Fprintln(e.stderr, "cpc:", err)
+		return exitRuntime
+	}
+	if *engine == "vm" {
+		if err := bytecode.NewVM(program, in, w).Run(); err != nil {
+			closeOutput()
+			fmt.Fprintln(e.stderr, err)
+			return exitRuntime
+		}
+	} else {
+		interp := interpreter.NewInterpreter(result.Semantic, in, w)
+		if *profile {
+			interp.EnableProfile()
+		}
+		err := interp.Run()
+		if *profile {
+			printProfile(e.stderr, s.data, interp.Profile())
+		}
+		if err != nil {
+			closeOutput()
+			fmt.Fprintln(e.stderr, err)
+			return exitRuntime
+		}
+	}
+	if err := closeOutput(); err != nil {
+		fmt.Fprintln(e.stderr, "cpc:", err)
+		return exitRuntime
+	}
+	return exitOK
+}
+
+func runBuild(e *env, args []string) int {
+	fs := newFlagSet(e, "build", "[-target asm|c|wat|llvm|llvm-runtime|bytecode|disasm] [-regs n] [-alloc] [-o file] [file]")
+	target := fs.String("target", "asm", "backend: asm, c, wat, llvm, llvm-runtime, bytecode or disasm")
+	regs := fs.Int("regs", assembly.MaxRegisters, "number of registers available to the asm backend")
+	alloc := fs.Bool("alloc", false, "print the register allocation to standard error (asm target only)")
+	out := fs.String("o", "", "write output to `file`")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if !oneOf(e, "target", *target, "asm", "c", "wat", "llvm", "llvm-runtime", "bytecode", "disasm") {
+		return exitUsage
+	}
+	if *alloc && *target != "asm" {
+		fmt.Fprintln(e.stderr, "cpc: -alloc requires -target asm")
+		return exitUsage
+	}
+	var code []byte
+	if *target == "llvm-runtime" {
+		code = []byte(llvm.Runtime)
+	} else {
+		_, result, exit := compileOne(e, fs)
+		if exit != exitOK {
+			return exit
+		}
+		var allocation *assembly.Allocation
+		var err error
+		code, allocation, err = generate(*target, *regs, result)
+		if err != nil {
+			fmt.Fprintln(e.stderr, err)
+			return exitCompile
+		}
+		if *alloc {
+			fmt.Fprint(e.stderr, allocation)
+		}
+	}
+	w, closeOutput, err := output(e, *out)
+	if err != nil {
+		fmt.Fprintln(e.stderr, "cpc:", err)
+		return exitRuntime
+	}
+	_, err = w.Write(code)
+	if closeErr := closeOutput(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintln(e.stderr, "cpc:", err)
+		return exitRuntime
+	}
+	return exitOK
+}
+
+// generate 调用后端生成代码，asm后端同时返回寄存器分配的结果
+func generate(target string, regs int, result *compiler.Result) ([]byte, *assembly.Allocation, error) {
+	var text string
+	var err error
+	switch target {
+	case "asm":
+		generator := assembly.NewGenerator(result.Semantic)
+		generator.SetRegisterCount(regs)
+		text, err = generator.Generate()
+		return []byte(text), generator.Allocation(), err
+	case "c":
+		text, err = csource.NewGenerator(result.Semantic).Generate()
+	case "wat":
+		text, err = wat.NewGenerator(result.Semantic).Generate()
+	case "llvm":
+		text, err = llvm.NewGenerator(result.Semantic).Generate()
+	case "bytecode", "disasm":
+		program, err := bytecode.Compile(result.Tree)
+		if err != nil {
+			return nil, nil, err
+		}
+		if target == "bytecode" {
+			return program.Encode(), nil, nil
+		}
+		text = bytecode.Disassemble(program)
+	}
+	return []byte(text), nil, err
+}
+
+func runREPL(e *env, args []string) int {
+	fs := newFlagSet(e, "repl", "[-prompt=false]")
+	showPrompt := fs.Bool("prompt", true, "print prompts")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	r := repl.New(e.stdin, e.stdout)
+	r.SetPrompt(*showPrompt)
+	if err := r.Run(); err != nil {
+		fmt.Fprintln(e.stderr, "cpc:", err)
+		return exitRuntime
+	}
+	return exitOK
+}
+
+func runDebug(e *env, args []string) int {
+	fs := newFlagSet(e, "debug", "[-input file] [-x file] [file]")
+	inputFile := fs.String("input", "", "read the program's input from `file` instead of the command stream")
+	script := fs.String("x", "", "read debugger commands from `file` instead of standard input")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if *script == "" && (fs.NArg() == 0 || fs.Arg(0) == "-") {
+		fmt.Fprintln(e.stderr, "cpc: the source must be a file unless commands come from -x")
+		return exitUsage
+	}
+	s, result, code := compileOne(e, fs)
+	if code != exitOK {
+		return code
+	}
+	commands := e.stdin
+	if *script != "" {
+		f, err := os.Open(*script)
+		if err != nil {
+			fmt.Fprintln(e.stderr, "cpc:", err)
+			return exitRuntime
+		}
+		defer f.Close()
+		commands = f
+	}
+	d := debugger.New(result.Semantic, s.data, commands, e.stdout)
+	//从命令文件中读取时回显命令而不打印提示符，输出与交互时的记录一样，结尾也没有多余的提示符
+	d.SetEcho(*script != "")
+	d.SetPrompt(*script == "")
+	if *inputFile != "" {
+		data, err := os.ReadFile(*inputFile)
+		if err != nil {
+			fmt.Fprintln(e.stderr, "cpc:", err)
+			return exitRuntime
+		}
+		d.SetInput(data)
+	}
+	if err := d.Run(); err != nil {
+		fmt.Fprintln(e.stderr, "cpc:", err)
+		return exitRuntime
+	}
+	return exitOK
+}
+
+func runLSP(e *env, args []string) int {
+	fs := newFlagSet(e, "lsp", "")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := lsp.NewServer(e.stdin, e.stdout).Run(); err != nil {
+		fmt.Fprintln(e.stderr, "cpc:", err)
+		return exitRuntime
+	}
+	return exitOK
+}
@@ -0,0 +1,157 @@
+// Command cpc 编译器的命令行入口，用子命令运行编译的各个阶段
+//
+//	cpc lex    [-format text|json] [-o file] [file ...]
+//	cpc parse  [-format text|dot|json] [-o file] [file ...]
+//	cpc trace  [-format text|json] [-o file] [file ...]
+//	cpc check  [-format text|json] [-o file] [file ...]
+//	cpc ir     [-S] [-o file] [file ...]
+//	cpc run    [-engine quad|vm] [-input file] [-profile] [-o file] [file|file.qbc]
+//	cpc build  [-target asm|c|wat|llvm|llvm-runtime|bytecode|disasm] [-regs n] [-alloc] [-o file] [file]
+//	cpc repl   [-prompt=false]
+//	cpc debug  [-input file] [-x file] file
+//	cpc lsp
+//
+// 没有文件参数或文件名为"-"时从标准输入读取源程序。run -engine vm也接受build -target bytecode生成的文件，
+// 按文件开头的"CPBC"识别，不再重新编译。
+// 退出码：0成功，1编译错误，2用法错误，3运行时错误或读写失败。
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	exitOK      = 0
+	exitCompile = 1
+	exitUsage   = 2
+	exitRuntime = 3
+)
+
+// env 命令运行的环境，便于替换标准输入输出
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// command 子命令
+type command struct {
+	summary string
+	run     func(e *env, args []string) int
+}
+
+var commands = map[string]*command{
+	"lex":   {"print the tokens", runLex},
+	"parse": {"print the syntax tree", runParse},
+	"trace": {"trace the parser and print the leftmost derivation", runTrace},
+	"check": {"report diagnostics only", runCheck},
+	"ir":    {"print the quadruples", runIR},
+	"run":   {"compile and execute the program", runRun},
+	"build": {"generate code for a backend", runBuild},
+	"repl":  {"start an interactive session", runREPL},
+	"debug": {"debug the program on the quadruple interpreter", runDebug},
+	"lsp":   {"start a language server on standard input and output", runLSP},
+}
+
+func main() {
+	os.Exit(run(&env{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}, os.Args[1:]))
+}
+
+func run(e *env, args []string) int {
+	if len(args) == 0 {
+		usage(e.stderr)
+		return exitUsage
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		usage(e.stdout)
+		return exitOK
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(e.stderr, "cpc: unknown command %q\n", args[0])
+		usage(e.stderr)
+		return exitUsage
+	}
+	return cmd.run(e, args[1:])
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: cpc <command> [flags] [file ...]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-6s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'cpc <command> -h' for the flags of a command.")
+	fmt.Fprintln(w, "Without file arguments, or with '-', the source is read from standard input.")
+}
+
+// source 一个待编译的源程序
+type source struct {
+	name string
+	data []byte
+}
+
+// readSources 读取文件参数指定的源程序
+func readSources(e *env, args []string) ([]source, error) {
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+	sources := make([]source, 0, len(args))
+	for _, name := range args {
+		var data []byte
+		var err error
+		if name == "-" {
+			name = "<stdin>"
+			data, err = io.ReadAll(e.stdin)
+		} else {
+			data, err = os.ReadFile(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source{name: name, data: data})
+	}
+	return sources, nil
+}
+
+// output 打开输出，filename为空时输出到标准输出
+func output(e *env, filename string) (io.Writer, func() error, error) {
+	if filename == "" {
+		return e.stdout, func() error { return nil }, nil
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
+}
+
+// header 有多个文件时在每个文件的输出前打印文件名
+func header(w io.Writer, sources []source, s source) {
+	if len(sources) > 1 {
+		fmt.Fprintf(w, "==> %s <==\n", s.name)
+	}
+}
+
+// oneOf 检查选项的取值
+func oneOf(e *env, flagName, value string, valid ...string) bool {
+	for _, v := range valid {
+		if v == value {
+			return true
+		}
+	}
+	fmt.Fprintf(e.stderr, "cpc: invalid -%s %q, must be one of %s\n", flagName, value, strings.Join(valid, ", "))
+	return false
+}
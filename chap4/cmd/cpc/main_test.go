@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain 设置了CPC_TEST_MAIN时测试程序本身作为cpc运行，供TestExitStatus以子进程执行
+func TestMain(m *testing.M) {
+	if os.Getenv("CPC_TEST_MAIN") == "1" {
+		main()
+	}
+	os.Exit(m.Run())
+}
+
+// cpc 以stdin为标准输入运行一条命令，返回退出码、标准输出与标准错误
+func cpc(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(&env{stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &stderr}, args)
+	return code, stdout.String(), stderr.String()
+}
+
+// TestExitCodes 用法错误为2，编译错误为1，运行时错误与读写失败为3；check的诊断信息是它的输出，
+// 其它命令的诊断信息输出到标准错误
+func TestExitCodes(t *testing.T) {
+	tests := []struct {
+		stdin  string
+		args   []string
+		code   int
+		output string
+	}{
+		{"", nil, exitUsage, "usage: cpc <command>"},
+		{"", []string{"help"}, exitOK, ""},
+		{"", []string{"compile"}, exitUsage, `unknown command "compile"`},
+		{"", []string{"lex", "-bogus"}, exitUsage, "flag provided but not defined: -bogus"},
+		{"", []string{"lex", "-format", "xml"}, exitUsage, "xml"},
+		{"", []string{"run", "-engine", "jit"}, exitUsage, "jit"},
+		{"", []string{"build", "-target", "c", "a.txt", "b.txt"}, exitUsage, ""},
+		{"{ int a; a = ; }", []string{"check"}, exitCompile, `<stdin>:1:14: error[E0201]: unexpected ";"`},
+		{"{ int a; a = @; }", []string{"lex", "-"}, exitCompile, "<stdin>:1:14: error[E0101]"},
+		{"{ int a; b = 1; }", []string{"run"}, exitCompile, "<stdin>:1:10: error[E0301]: b is not declared"},
+		{"{ int a; a = 0; a = 1 / a; }", []string{"run"}, exitRuntime, "runtime error: division by zero"},
+		{"{ int a; a = 0; a = 1 / a; }", []string{"run", "-engine", "vm"}, exitRuntime, "division by zero"},
+		{"", []string{"check", "missing.txt"}, exitRuntime, "missing.txt"},
+		{"{ int a; read a; write a; }", []string{"run", "-input", "missing.txt"}, exitRuntime, "missing.txt"},
+		//警告不影响退出码
+		{"{ int a; }", []string{"check"}, exitOK, "warning[W0301]"},
+	}
+	for _, test := range tests {
+		code, stdout, stderr := cpc(test.stdin, test.args...)
+		if code != test.code || !strings.Contains(stdout+stderr, test.output) {
+			t.Errorf("cpc %s: exit %d, output %q, want %d, %q", strings.Join(test.args, " "), code, stdout+stderr, test.code, test.output)
+		}
+	}
+}
+
+// TestExitStatus main以退出码结束进程，源程序从真正的标准输入读取
+func TestExitStatus(t *testing.T) {
+	tests := []struct {
+		stdin string
+		args  []string
+		code  int
+	}{
+		{"{ int a; a = 1; write a; }", []string{"run", "-"}, exitOK},
+		{"{ int a; a = ; }", []string{"check", "-"}, exitCompile},
+		{"", []string{"lex", "-format", "xml"}, exitUsage},
+		{"{ int a; a = 0; a = 1 / a; }", []string{"run"}, exitRuntime},
+	}
+	for _, test := range tests {
+		cmd := exec.Command(os.Args[0], test.args...)
+		cmd.Env = append(os.Environ(), "CPC_TEST_MAIN=1")
+		cmd.Stdin = strings.NewReader(test.stdin)
+		err := cmd.Run()
+		code := 0
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.ExitCode()
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if code != test.code {
+			t.Errorf("cpc %s: exit status %d, want %d", strings.Join(test.args, " "), code, test.code)
+		}
+	}
+}
+
+// TestStdin 没有文件参数与文件名为"-"时都从标准输入读取，诊断信息中的文件名为<stdin>
+func TestStdin(t *testing.T) {
+	src := "{ int a; a = 3; write a; }"
+	for _, args := range [][]string{{"run"}, {"run", "-"}} {
+		if code, stdout, stderr := cpc(src, args...); code != exitOK || stdout != "3\n" {
+			t.Errorf("cpc %s: exit %d, output %q, stderr %q", strings.Join(args, " "), code, stdout, stderr)
+		}
+	}
+	code, stdout, _ := cpc(src, "lex", "-")
+	if code != exitOK || !strings.HasPrefix(stdout, "1:1      Separator  {\n") {
+		t.Errorf("lex -: exit %d, output %q", code, stdout)
+	}
+}
+
+// TestOutputFile -o将结果写入文件，标准输出为空；出错时诊断信息仍然输出到标准错误
+func TestOutputFile(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.ir")
+	code, stdout, stderr := cpc("{ int a; a = 3; write a; }", "ir", "-o", out)
+	if code != exitOK || stdout != "" {
+		t.Fatalf("ir -o: exit %d, output %q, stderr %q", code, stdout, stderr)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "(=, 3, _, a)") {
+		t.Errorf("%s = %q", out, data)
+	}
+	out = filepath.Join(dir, "out.txt")
+	if code, _, _ := cpc("{ int a; a = 3; write a; }", "run", "-o", out); code != exitOK {
+		t.Errorf("run -o: exit %d", code)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "3\n" {
+		t.Errorf("run -o: %s = %q", out, data)
+	}
+	if code, _, stderr := cpc("{ int a; a = ; }", "ir", "-o", filepath.Join(dir, "bad.ir")); code != exitCompile || !strings.Contains(stderr, "E0201") {
+		t.Errorf("ir -o with a syntax error: exit %d, stderr %q", code, stderr)
+	}
+	if code, _, _ := cpc("{ int a; a = 3; write a; }", "ir", "-o", filepath.Join(dir, "missing", "out.ir")); code != exitRuntime {
+		t.Errorf("ir -o into a missing directory: exit %d", code)
+	}
+}
+
+// TestFormats lex、check、parse的json格式可以解析，parse的dot格式是一个有向图
+func TestFormats(t *testing.T) {
+	src := "{ int a; a = 3; write a; }"
+	var tokens struct {
+		File   string
+		Tokens []tokenJSON
+	}
+	_, stdout, _ := cpc(src, "lex", "-format", "json")
+	if err := json.Unmarshal([]byte(stdout), &tokens); err != nil || tokens.File != "<stdin>" || len(tokens.Tokens) != 12 {
+		t.Errorf("lex -format json: %v, %+v", err, tokens)
+	} else if token := tokens.Tokens[3]; token.Class != "Separator" || token.Value != ";" || token.Pos.Column != 8 {
+		t.Errorf("lex -format json: token 3 = %+v", token)
+	}
+
+	var check struct {
+		Diagnostics []struct {
+			Phase, Severity, Code string
+			Pos                   struct{ Line, Column int }
+		}
+	}
+	code, stdout, _ := cpc("{ int a; a = ; }", "check", "-format", "json")
+	if err := json.Unmarshal([]byte(stdout), &check); err != nil || code != exitCompile || len(check.Diagnostics) != 1 {
+		t.Errorf("check -format json: exit %d, %v, %q", code, err, stdout)
+	} else if d := check.Diagnostics[0]; d.Phase != "parse" || d.Severity != "error" || d.Code != "E0201" || d.Pos.Line != 1 || d.Pos.Column != 14 {
+		t.Errorf("check -format json: %+v", d)
+	}
+	//没有诊断信息时是空数组而不是null
+	if _, stdout, _ := cpc(src, "check", "-format", "json"); !strings.Contains(stdout, `"diagnostics": []`) {
+		t.Errorf("check -format json without diagnostics: %q", stdout)
+	}
+
+	var tree struct {
+		Tree struct{ Symbol string }
+	}
+	_, stdout, _ = cpc(src, "parse", "-format", "json")
+	if err := json.Unmarshal([]byte(stdout), &tree); err != nil || tree.Tree.Symbol != "<PROG>" {
+		t.Errorf("parse -format json: %v, %q", err, stdout)
+	}
+	_, stdout, _ = cpc(src, "parse", "-format", "dot")
+	if !strings.HasPrefix(stdout, "digraph tree {\n") || !strings.HasSuffix(stdout, "}\n") || !strings.Contains(stdout, `n0 [label="<PROG>"];`) {
+		t.Errorf("parse -format dot: %q", stdout)
+	}
+}
+
+// TestRunBytecode build -target bytecode生成的文件可以直接用run -engine vm执行
+func TestRunBytecode(t *testing.T) {
+	qbc := filepath.Join(t.TempDir(), "countdown.qbc")
+	src := "{ int a; bool c; read a; c := a > 0; while c do { a = a - 1; write a; c := a > 0; } }"
+	if code, _, stderr := cpc(src, "build", "-target", "bytecode", "-o", qbc); code != exitOK {
+		t.Fatalf("build: exit %d: %s", code, stderr)
+	}
+	input := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(input, []byte("3\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	code, stdout, stderr := cpc("", "run", "-engine", "vm", "-input", input, qbc)
+	if code != exitOK || stdout != "2\n1\n0\n" {
+		t.Errorf("run -engine vm %s: exit %d, output %q, stderr %q", qbc, code, stdout, stderr)
+	}
+	if code, _, stderr := cpc("", "run", qbc); code != exitUsage || !strings.Contains(stderr, "requires -engine vm") {
+		t.Errorf("run %s: exit %d, stderr %q", qbc, code, stderr)
+	}
+	//文件头中的常量个数远大于文件本身
+	bad := filepath.Join(t.TempDir(), "bad.qbc")
+	header := []byte("CPBC\x01\x00\x00\x00\x00\x00\x00\x00\xff\xff\xff\x7f\x00\x00\x00\x00\x00\x00\x00\x00")
+	if err := os.WriteFile(bad, header, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, stderr := cpc("", "run", "-engine", "vm", bad); code != exitRuntime || !strings.Contains(stderr, "invalid bytecode") {
+		t.Errorf("run -engine vm %s: exit %d, stderr %q", bad, code, stderr)
+	}
+}
+
+// TestBuildAlloc -alloc将寄存器分配的结果输出到标准错误，不影响生成的汇编代码
+func TestBuildAlloc(t *testing.T) {
+	src := "{ int a, b; read a; b = a * 2; write b; }"
+	code, stdout, stderr := cpc(src, "build", "-target", "asm", "-regs", "1", "-alloc")
+	if code != exitOK || !strings.Contains(stdout, "_start:") || !strings.HasPrefix(stderr, "function main: 1 registers") {
+		t.Errorf("build -alloc: exit %d, stderr %q", code, stderr)
+	}
+	if code, _, stderr := cpc(src, "build", "-target", "c", "-alloc"); code != exitUsage || !strings.Contains(stderr, "-alloc requires -target asm") {
+		t.Errorf("build -target c -alloc: exit %d, stderr %q", code, stderr)
+	}
+}
+
+// TestDebugScript -x读取命令文件时回显命令，不打印提示符
+func TestDebugScript(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "run.cpdb")
+	if err := os.WriteFile(script, []byte("run\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	code, stdout, stderr := cpc("", "debug", "-x", script, filepath.Join("..", "..", "text", "source.txt"))
+	want := "run\n10\n1\nProgram exited normally after 74 steps\n"
+	if code != exitOK || stdout != want {
+		t.Errorf("debug -x: exit %d, output %q, stderr %q, want %q", code, stdout, stderr, want)
+	}
+}
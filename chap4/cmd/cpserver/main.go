@@ -0,0 +1,19 @@
+// Command cpserver 编译服务，以HTTP接口提供编译的各个阶段，供网站的编译器练习场使用
+//
+//	cpserver [-addr :8082] [-max-steps n] [-timeout d]
+package main
+
+import (
+	"chap4/service"
+	"flag"
+	"log"
+)
+
+func main() {
+	limits := service.DefaultLimits
+	addr := flag.String("addr", ":8082", "listen address")
+	flag.IntVar(&limits.MaxSteps, "max-steps", limits.MaxSteps, "maximum number of quadruples executed by /api/run")
+	flag.DurationVar(&limits.Timeout, "timeout", limits.Timeout, "maximum execution time of /api/run")
+	flag.Parse()
+	log.Fatal(service.NewService(limits).Router().Run(*addr))
+}
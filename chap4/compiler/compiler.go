@@ -0,0 +1,262 @@
+// Package compiler 将词法分析、语法分析与语义分析串联为一个可以嵌入其它程序的编译接口
+//
+// Compile不会退出进程，所有错误（包括各阶段内部的panic）都以Diagnostic的形式返回。
+// lexer与analyzer使用包级别的表，因此Compile内部串行执行，可以被多个goroutine同时调用。
+package compiler
+
+import (
+	"chap4/analyzer"
+	"chap4/lexer"
+	"chap4/semantic"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+var mu sync.Mutex
+
+// initLexer 初始化词法分析器的表，测试中替换它来模拟内部的panic
+var initLexer = lexer.InitLexer
+
+// Options 编译选项
+type Options struct {
+	StopAfter Phase  // 完成该阶段后停止，零值表示完整编译
+	Filename  string // 诊断信息中使用的文件名
+	Trace     bool   // 记录语法分析的过程，结果在Result.Trace中
+}
+
+// Result 编译结果，出错时包含出错之前各阶段的结果
+type Result struct {
+	Tokens   []*lexer.Token
+	Tree     *analyzer.Node
+	Symbols  map[string]*lexer.Symbol // 符号表，包括声明的变量与生成的临时变量
+	IR       []*semantic.Quadruple
+	Semantic *semantic.Semantic // 语义分析器，供各后端使用
+	Trace    *analyzer.Trace    // 语法分析的跟踪结果，只在Options.Trace时有
+	Value    string             // 表达式的值所在的变量、临时变量或常数，只在CompileExpr时有
+}
+
+// CompileFile 读取并编译文件
+func CompileFile(filename string, opts Options) (*Result, []Diagnostic) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return &Result{}, []Diagnostic{{
+			File:     filename,
+			Phase:    PhaseLex,
+			Severity: SeverityError,
+			Code:     CodeInternal,
+			Message:  err.Error(),
+		}}
+	}
+	if opts.Filename == "" {
+		opts.Filename = filename
+	}
+	return Compile(src, opts)
+}
+
+// Compile 编译源程序
+func Compile(src []byte, opts Options) (*Result, []Diagnostic) {
+	mu.Lock()
+	defer mu.Unlock()
+	c := &compilation{opts: opts, result: &Result{}}
+	c.run(src)
+	return c.result, c.diagnostics
+}
+
+// CompileExpr 把源程序作为一个算术表达式编译，语法树的根为<EXPR>，vars中的变量声明为int；
+// 生成的四元式依次计算表达式，最后的值在Result.Value中
+func CompileExpr(src []byte, vars []string, opts Options) (*Result, []Diagnostic) {
+	mu.Lock()
+	defer mu.Unlock()
+	c := &compilation{opts: opts, result: &Result{}, expr: true, vars: vars}
+	c.run(src)
+	return c.result, c.diagnostics
+}
+
+// compilation 一次编译的状态，expr为true时编译的是一个算术表达式
+type compilation struct {
+	opts        Options
+	result      *Result
+	diagnostics []Diagnostic
+	phase       Phase
+	expr        bool
+	vars        []string
+}
+
+// report 添加一条诊断信息
+func (c *compilation) report(severity Severity, pos lexer.Position, code, message string) {
+	c.diagnostics = append(c.diagnostics, Diagnostic{
+		File:     c.opts.Filename,
+		Phase:    c.phase,
+		Severity: severity,
+		Pos:      pos,
+		Code:     code,
+		Message:  message,
+	})
+}
+
+func (c *compilation) run(src []byte) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.report(SeverityError, lexer.Position{}, CodeInternal, fmt.Sprintf("internal error: %v", r))
+		}
+	}()
+	if !c.lex(src) || c.opts.StopAfter == PhaseLex {
+		return
+	}
+	if !c.parse() || c.opts.StopAfter == PhaseParse {
+		return
+	}
+	c.check()
+}
+
+// lex 词法分析
+func (c *compilation) lex(src []byte) bool {
+	c.phase = PhaseLex
+	if err := initLexer(); err != nil {
+		c.report(SeverityError, lexer.Position{}, CodeInternal, err.Error())
+		return false
+	}
+	l := lexer.NewLexer()
+	l.ReadFromBytes(src)
+	l.Run()
+	c.result.Tokens = l.Target()
+	c.result.Symbols = lexer.SymbolTable
+	err := l.Err()
+	if err == nil {
+		return true
+	}
+	var pos lexer.Position
+	var lexErr *lexer.Error
+	if errors.As(err, &lexErr) {
+		pos = lexErr.Pos
+	}
+	code := CodeLex
+	switch {
+	case errors.Is(err, lexer.InvalidCharacter):
+		code = CodeInvalidChar
+	case errors.Is(err, lexer.IdentifierTooLongErr):
+		code = CodeIdentTooLong
+	case errors.Is(err, lexer.NumberTooLongErr):
+		code = CodeNumberTooLong
+	case errors.Is(err, lexer.NumberStartWithZeroErr):
+		code = CodeLeadingZero
+	case errors.Is(err, lexer.InvalidOperatorErr):
+		code = CodeInvalidOperator
+	}
+	c.report(SeverityError, pos, code, err.Error())
+	return false
+}
+
+// parse 语法分析
+func (c *compilation) parse() bool {
+	c.phase = PhaseParse
+	analyzer.InitAnalyzer()
+	a := analyzer.NewAnalyzer(c.result.Tokens)
+	if c.opts.Trace {
+		a.EnableTrace()
+	}
+	if c.expr {
+		a.AnalyseExpr()
+	} else {
+		a.Analyse()
+	}
+	c.result.Tree = a.GetRoot()
+	c.result.Trace = a.Trace()
+	err := a.Err()
+	if err == nil {
+		return true
+	}
+	var syntaxErr *analyzer.SyntaxError
+	switch {
+	case errors.As(err, &syntaxErr) && syntaxErr.Token != nil:
+		token := syntaxErr.Token
+		c.report(SeverityError, token.Pos, CodeUnexpectedToken, fmt.Sprintf("unexpected %q", token.Value))
+	default:
+		c.report(SeverityError, c.endPosition(), CodeUnexpectedEOF, "unexpected end of input")
+	}
+	return false
+}
+
+// endPosition 最后一个单词之后的位置
+func (c *compilation) endPosition() lexer.Position {
+	tokens := c.result.Tokens
+	if len(tokens) == 0 {
+		return lexer.Position{Line: 1, Column: 1}
+	}
+	last := tokens[len(tokens)-1]
+	return lexer.Position{Line: last.Pos.Line, Column: last.Pos.Column + len(last.Value)}
+}
+
+// check 语义分析并生成四元式
+func (c *compilation) check() {
+	c.phase = PhaseSemantic
+	s := semantic.NewSemanticAnalyzer(c.result.Tree)
+	if c.expr {
+		for _, id := range c.vars {
+			s.Declare(id, "int")
+		}
+		c.result.Value = s.RunExpr()
+	} else {
+		s.Run()
+	}
+	c.result.Semantic = s
+	c.result.Symbols = s.SymbolTable
+	if err := s.Err(); err != nil {
+		var pos lexer.Position
+		var semanticErr *semantic.Error
+		if errors.As(err, &semanticErr) && semanticErr.Token != nil {
+			pos = semanticErr.Token.Pos
+		}
+		code := CodeSemantic
+		switch {
+		case errors.Is(err, semantic.UndeclaredErr):
+			code = CodeUndeclared
+		case errors.Is(err, semantic.RedeclaredErr):
+			code = CodeRedeclared
+		case errors.Is(err, semantic.TypeMismatchErr):
+			code = CodeTypeMismatch
+		}
+		c.report(SeverityError, pos, code, strings.TrimPrefix(err.Error(), "error: "))
+		return
+	}
+	c.result.IR = s.QuadrupleList()
+	if !c.expr {
+		c.checkUnused()
+	}
+}
+
+// checkUnused 对声明后从未使用的变量给出警告
+func (c *compilation) checkUnused() {
+	used := make(map[string]bool)
+	for _, q := range c.result.IR {
+		used[q.Arg1()] = true
+		used[q.Arg2()] = true
+		used[q.Result()] = true
+	}
+	for _, token := range Declarations(c.result.Tree) {
+		if !used[token.Value] {
+			c.report(SeverityWarning, token.Pos, CodeUnusedVariable, fmt.Sprintf("%s is declared but never used", token.Value))
+		}
+	}
+}
+
+// Declarations 按声明顺序返回语法树中声明变量的单词
+func Declarations(root *analyzer.Node) []*lexer.Token {
+	tokens := make([]*lexer.Token, 0)
+	var walk func(node *analyzer.Node)
+	walk = func(node *analyzer.Node) {
+		for ; node != nil; node = node.RightBro {
+			if node.Class == analyzer.NAME && node.LeftChild != nil && node.LeftChild.Token != nil {
+				tokens = append(tokens, node.LeftChild.Token)
+			}
+			if node.Class != analyzer.STMTS {
+				walk(node.LeftChild)
+			}
+		}
+	}
+	walk(root)
+	return tokens
+}
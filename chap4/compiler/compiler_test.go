@@ -0,0 +1,125 @@
+package compiler
+
+import (
+	"chap4/lexer"
+	"errors"
+	"testing"
+)
+
+// TestDiagnostics 每个阶段的错误都给出对应的错误码、阶段、严重程度与位置，出错后不再进行之后的阶段
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		src      string
+		code     string
+		phase    Phase
+		severity Severity
+		line     int
+		column   int
+	}{
+		{"{ int a; a = @; }", CodeInvalidChar, PhaseLex, SeverityError, 1, 14},
+		{"{ int abcdefghi; }", CodeIdentTooLong, PhaseLex, SeverityError, 1, 7},
+		{"{ int a; a = 123456789; }", CodeNumberTooLong, PhaseLex, SeverityError, 1, 14},
+		{"{ int a; a = 0123; }", CodeLeadingZero, PhaseLex, SeverityError, 1, 14},
+		{"{ int a; a = 1;", CodeUnexpectedEOF, PhaseParse, SeverityError, 1, 16},
+		{"", CodeUnexpectedEOF, PhaseParse, SeverityError, 1, 1},
+		//回溯之后报告读到的最远单词
+		{"{ int a; a = ; }", CodeUnexpectedToken, PhaseParse, SeverityError, 1, 14},
+		{"{ int a; a = 1 }", CodeUnexpectedToken, PhaseParse, SeverityError, 1, 16},
+		{"{ int a; a = 1 ! 2; }", CodeUnexpectedToken, PhaseParse, SeverityError, 1, 16},
+		{"{ int a; bool b; while b do a = (1; }", CodeUnexpectedToken, PhaseParse, SeverityError, 1, 35},
+		{"{ int a; write a; } }", CodeUnexpectedToken, PhaseParse, SeverityError, 1, 21},
+		{"{ int a;\n  b = 1;\n}", CodeUndeclared, PhaseSemantic, SeverityError, 2, 3},
+		{"{ int a; int a; }", CodeRedeclared, PhaseSemantic, SeverityError, 1, 14},
+		{"{ int a; bool b; a = b; }", CodeTypeMismatch, PhaseSemantic, SeverityError, 1, 22},
+		{"{ int a; }", CodeUnusedVariable, PhaseSemantic, SeverityWarning, 1, 7},
+	}
+	for _, test := range tests {
+		result, diagnostics := Compile([]byte(test.src), Options{Filename: "test.txt"})
+		if len(diagnostics) != 1 {
+			t.Errorf("Compile(%q): %v, want one diagnostic", test.src, diagnostics)
+			continue
+		}
+		d := diagnostics[0]
+		want := Diagnostic{
+			File:     "test.txt",
+			Phase:    test.phase,
+			Severity: test.severity,
+			Pos:      lexer.Position{Line: test.line, Column: test.column},
+			Code:     test.code,
+			Message:  d.Message,
+		}
+		if d != want {
+			t.Errorf("Compile(%q) = %s (phase %s), want %s (phase %s)", test.src, d, d.Phase, want, want.Phase)
+		}
+		if HasErrors(diagnostics) != (test.severity == SeverityError) {
+			t.Errorf("Compile(%q): HasErrors = %v", test.src, HasErrors(diagnostics))
+		}
+		//出错的阶段之后没有结果
+		if (result.Tree != nil) != (test.phase != PhaseLex && test.phase != PhaseParse) {
+			t.Errorf("Compile(%q): tree %v after a %s error", test.src, result.Tree != nil, test.phase)
+		}
+		if (result.IR != nil) != (test.severity == SeverityWarning) {
+			t.Errorf("Compile(%q): %d quadruples after a %s error", test.src, len(result.IR), test.phase)
+		}
+	}
+}
+
+func TestStopAfter(t *testing.T) {
+	src := []byte("{ int a; a = 1; write a; }")
+	tests := []struct {
+		phase            Phase
+		tokens, tree, ir bool
+	}{
+		{PhaseLex, true, false, false},
+		{PhaseParse, true, true, false},
+		{PhaseSemantic, true, true, true},
+		{"", true, true, true},
+	}
+	for _, test := range tests {
+		result, diagnostics := Compile(src, Options{StopAfter: test.phase})
+		if len(diagnostics) != 0 {
+			t.Errorf("StopAfter %q: %v", test.phase, diagnostics)
+		}
+		if (len(result.Tokens) != 0) != test.tokens || (result.Tree != nil) != test.tree || (result.IR != nil) != test.ir {
+			t.Errorf("StopAfter %q: %d tokens, tree %v, %d quadruples", test.phase, len(result.Tokens), result.Tree != nil, len(result.IR))
+		}
+	}
+	//在词法分析后停止时，语法错误不会被发现
+	if _, diagnostics := Compile([]byte("{ int a; a = ; }"), Options{StopAfter: PhaseLex}); len(diagnostics) != 0 {
+		t.Errorf("StopAfter lex: %v", diagnostics)
+	}
+}
+
+// TestRecover 各阶段内部的panic转为E0000，之后的编译不受影响
+func TestRecover(t *testing.T) {
+	initLexer = func() error { panic("boom") }
+	_, diagnostics := Compile([]byte("{ int a; }"), Options{Filename: "test.txt"})
+	initLexer = lexer.InitLexer
+	want := Diagnostic{File: "test.txt", Phase: PhaseLex, Severity: SeverityError, Code: CodeInternal, Message: "internal error: boom"}
+	if len(diagnostics) != 1 || diagnostics[0] != want {
+		t.Fatalf("panic: %v, want %v", diagnostics, want)
+	}
+	if diagnostics[0].String() != "test.txt: error[E0000]: internal error: boom" {
+		t.Errorf("String() = %q", diagnostics[0].String())
+	}
+	initLexer = func() error { return errors.New("table missing") }
+	_, diagnostics = Compile([]byte("{ int a; }"), Options{})
+	initLexer = lexer.InitLexer
+	if len(diagnostics) != 1 || diagnostics[0].Code != CodeInternal || diagnostics[0].Message != "table missing" {
+		t.Errorf("init error: %v", diagnostics)
+	}
+	if _, diagnostics := Compile([]byte("{ int a; write a; }"), Options{}); len(diagnostics) != 0 {
+		t.Errorf("after recovering: %v", diagnostics)
+	}
+}
+
+func TestCompileFile(t *testing.T) {
+	result, diagnostics := CompileFile("../text/source.txt", Options{})
+	if HasErrors(diagnostics) || len(result.IR) == 0 {
+		t.Errorf("CompileFile(source.txt): %v", diagnostics)
+	}
+	_, diagnostics = CompileFile("missing.txt", Options{})
+	if len(diagnostics) != 1 || diagnostics[0].Code != CodeInternal || diagnostics[0].File != "missing.txt" {
+		t.Errorf("CompileFile(missing.txt): %v", diagnostics)
+	}
+}
@@ -0,0 +1,76 @@
+package compiler
+
+import (
+	"chap4/lexer"
+	"fmt"
+)
+
+// Phase 编译阶段
+type Phase string
+
+const (
+	PhaseLex      Phase = "lex"      // 词法分析
+	PhaseParse    Phase = "parse"    // 语法分析
+	PhaseSemantic Phase = "semantic" // 语义分析与中间代码生成
+)
+
+// Severity 诊断信息的严重程度
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// 诊断信息的错误码，E开头为错误，W开头为警告，百位表示阶段
+const (
+	CodeInternal        = "E0000" // 编译器内部错误
+	CodeInvalidChar     = "E0101" // 非法字符
+	CodeIdentTooLong    = "E0102" // 标识符过长
+	CodeNumberTooLong   = "E0103" // 数字过长
+	CodeLeadingZero     = "E0104" // 数字以0开头
+	CodeInvalidOperator = "E0105" // 非法运算符
+	CodeLex             = "E0100" // 其它词法错误
+	CodeUnexpectedToken = "E0201" // 意外的单词
+	CodeUnexpectedEOF   = "E0202" // 意外的程序结尾
+	CodeSemantic        = "E0300" // 其它语义错误
+	CodeUndeclared      = "E0301" // 变量未声明
+	CodeRedeclared      = "E0302" // 变量重复声明
+	CodeTypeMismatch    = "E0303" // 类型不匹配
+	CodeUnusedVariable  = "W0301" // 变量声明后未使用
+)
+
+// Diagnostic 诊断信息
+type Diagnostic struct {
+	File     string         `json:"file,omitempty"`
+	Phase    Phase          `json:"phase"`
+	Severity Severity       `json:"severity"`
+	Pos      lexer.Position `json:"pos"`
+	Code     string         `json:"code"`
+	Message  string         `json:"message"`
+}
+
+// String 将诊断信息转换为"文件:行:列: 严重程度[错误码]: 信息"的形式
+func (d Diagnostic) String() string {
+	prefix := d.File
+	if d.Pos.IsValid() {
+		if prefix != "" {
+			prefix += ":"
+		}
+		prefix += d.Pos.String()
+	}
+	if prefix != "" {
+		prefix += ": "
+	}
+	return fmt.Sprintf("%s%s[%s]: %s", prefix, d.Severity, d.Code, d.Message)
+}
+
+// HasErrors 判断诊断信息中是否有错误
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,285 @@
+// Package csource 由四元式生成可以用任意C编译器编译的C源程序
+//
+// 变量用long long表示，至少64位，与解释器、汇编后端的结果相同
+package csource
+
+import (
+	"chap4/lexer"
+	"chap4/semantic"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	EmptyProgramErr = errors.New("error: no quadruple to generate")
+	UnknownOpErr    = errors.New("error: unknown quadruple op")
+)
+
+// reservedWords C语言的关键字以及生成代码中用到的函数名，同名的变量需要改名
+var reservedWords = map[string]bool{
+	"auto": true, "break": true, "case": true, "char": true, "const": true, "continue": true,
+	"default": true, "do": true, "double": true, "else": true, "enum": true, "extern": true,
+	"float": true, "for": true, "goto": true, "if": true, "inline": true, "int": true,
+	"long": true, "register": true, "restrict": true, "return": true, "short": true,
+	"signed": true, "sizeof": true, "static": true, "struct": true, "switch": true,
+	"typedef": true, "union": true, "unsigned": true, "void": true, "volatile": true,
+	"while": true, "main": true, "printf": true, "scanf": true, "fprintf": true,
+	"stderr": true, "exit": true, "read_int": true, "check_div": true,
+}
+
+// relationMap 条件跳转四元式对应的C关系运算符
+var relationMap = map[string]string{
+	"j>":  ">",
+	"j>=": ">=",
+	"j<":  "<",
+	"j<=": "<=",
+	"j==": "==",
+	"j!=": "!=",
+}
+
+// prelude 生成代码的头部，read、write以及除零检查的实现与四元式解释器保持一致
+const prelude = `#include <stdio.h>
+#include <stdlib.h>
+
+static inline long long read_int(void)
+{
+    long long v;
+    if (scanf("%lld", &v) != 1) {
+        fprintf(stderr, "runtime error: cannot read an integer\n");
+        exit(1);
+    }
+    return v;
+}
+
+static inline long long check_div(long long v)
+{
+    if (v == 0) {
+        fprintf(stderr, "runtime error: division by zero\n");
+        exit(1);
+    }
+    return v;
+}
+`
+
+// Generator C源程序生成器
+type Generator struct {
+	quadrupleList []*semantic.Quadruple
+	symbolTable   map[string]*lexer.Symbol
+	vars          []string
+	names         map[string]string // 变量名到C标识符的映射
+	labels        map[int]bool
+	lines         []string
+}
+
+// NewGenerator 创建一个C源程序生成器实例
+func NewGenerator(s *semantic.Semantic) *Generator {
+	return &Generator{
+		quadrupleList: s.QuadrupleList(),
+		symbolTable:   s.SymbolTable,
+		vars:          s.VarList(),
+		names:         make(map[string]string),
+		labels:        make(map[int]bool),
+		lines:         make([]string, 0),
+	}
+}
+
+// Generate 生成C源程序
+func (g *Generator) Generate() (string, error) {
+	if len(g.quadrupleList) == 0 {
+		return "", EmptyProgramErr
+	}
+	g.lines = g.lines[:0]
+	g.mangleNames()
+	if err := g.collectLabels(); err != nil {
+		return "", err
+	}
+	g.lines = append(g.lines, prelude)
+	g.lines = append(g.lines, "int main(void)", "{")
+	g.emitDeclarations()
+	for index, q := range g.quadrupleList {
+		if g.labels[index] {
+			g.lines = append(g.lines, labelName(index)+":")
+		}
+		if err := g.emitQuadruple(q); err != nil {
+			return "", fmt.Errorf("%w : %d: %s", err, index, q)
+		}
+	}
+	if g.labels[len(g.quadrupleList)] {
+		g.lines = append(g.lines, labelName(len(g.quadrupleList))+":")
+		g.emit("return 0;")
+	} else if g.quadrupleList[len(g.quadrupleList)-1].Op() != "quit" {
+		g.emit("return 0;")
+	}
+	g.lines = append(g.lines, "}")
+	return strings.Join(g.lines, "\n") + "\n", nil
+}
+
+// PrintToFile 将C源程序写入文件
+func (g *Generator) PrintToFile(filename string) error {
+	code, err := g.Generate()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, []byte(code), 0666)
+}
+
+// mangleNames 与C关键字或库函数同名的变量在名字后追加下划线，直到不与其它变量重名
+func (g *Generator) mangleNames() {
+	used := make(map[string]bool)
+	for _, name := range g.vars {
+		used[name] = true
+	}
+	for _, name := range g.vars {
+		mangled := name
+		if reservedWords[name] {
+			for used[mangled] || reservedWords[mangled] {
+				mangled += "_"
+			}
+			used[mangled] = true
+		}
+		g.names[name] = mangled
+	}
+}
+
+// collectLabels 收集所有跳转目标
+func (g *Generator) collectLabels() error {
+	for index, q := range g.quadrupleList {
+		if !q.IsJump() {
+			continue
+		}
+		target, err := q.JumpTarget()
+		if err != nil {
+			return err
+		}
+		if target < 0 || target > len(g.quadrupleList) {
+			return fmt.Errorf("error: jump target %d out of range at %d", target, index)
+		}
+		g.labels[target] = true
+	}
+	return nil
+}
+
+// labelName 生成四元式下标对应的标号
+func labelName(index int) string {
+	return fmt.Sprintf("L%d", index)
+}
+
+// emitDeclarations 按符号表中的类型声明变量，bool与int一样用long long表示，取值为1或0
+func (g *Generator) emitDeclarations() {
+	names := make([]string, 0, len(g.vars))
+	temps := make([]string, 0, len(g.vars))
+	for _, name := range g.vars {
+		if g.symbolTable[name].Class == 0 {
+			temps = append(temps, name)
+		} else {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		g.emit("long long %s = 0; /* %s */", g.names[name], g.symbolTable[name].Type)
+	}
+	for _, name := range temps {
+		g.emit("long long %s = 0; /* temp */", g.names[name])
+	}
+}
+
+func (g *Generator) emit(format string, a ...any) {
+	g.lines = append(g.lines, "    "+fmt.Sprintf(format, a...))
+}
+
+// operand 将四元式的操作数转换为C表达式
+func (g *Generator) operand(arg string) (string, error) {
+	if semantic.IsConst(arg) {
+		if strings.HasPrefix(arg, "-") {
+			return "(" + arg + "LL)", nil
+		}
+		return arg + "LL", nil
+	}
+	name, ok := g.names[arg]
+	if !ok {
+		return "", fmt.Errorf("error: %s is not declared", arg)
+	}
+	return name, nil
+}
+
+// operands 转换多个操作数
+func (g *Generator) operands(args ...string) ([]string, error) {
+	res := make([]string, len(args))
+	for i, arg := range args {
+		v, err := g.operand(arg)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = v
+	}
+	return res, nil
+}
+
+// emitQuadruple 将一条四元式翻译为C语句
+func (g *Generator) emitQuadruple(q *semantic.Quadruple) error {
+	switch q.Op() {
+	case "+", "-", "*":
+		args, err := g.operands(q.Arg1(), q.Arg2(), q.Result())
+		if err != nil {
+			return err
+		}
+		g.emit("%s = %s %s %s;", args[2], args[0], q.Op(), args[1])
+	case "/":
+		args, err := g.operands(q.Arg1(), q.Arg2(), q.Result())
+		if err != nil {
+			return err
+		}
+		g.emit("%s = %s / check_div(%s);", args[2], args[0], args[1])
+	case "=", ":=":
+		args, err := g.operands(q.Arg1(), q.Result())
+		if err != nil {
+			return err
+		}
+		g.emit("%s = %s;", args[1], args[0])
+	case "j":
+		target, err := q.JumpTarget()
+		if err != nil {
+			return err
+		}
+		g.emit("goto %s;", labelName(target))
+	case "jnz":
+		target, err := q.JumpTarget()
+		if err != nil {
+			return err
+		}
+		arg, err := g.operand(q.Arg1())
+		if err != nil {
+			return err
+		}
+		g.emit("if (%s != 0) goto %s;", arg, labelName(target))
+	case "j>", "j>=", "j<", "j<=", "j==", "j!=":
+		target, err := q.JumpTarget()
+		if err != nil {
+			return err
+		}
+		args, err := g.operands(q.Arg1(), q.Arg2())
+		if err != nil {
+			return err
+		}
+		g.emit("if (%s %s %s) goto %s;", args[0], relationMap[q.Op()], args[1], labelName(target))
+	case "read":
+		arg, err := g.operand(q.Arg1())
+		if err != nil {
+			return err
+		}
+		g.emit("%s = read_int();", arg)
+	case "write":
+		arg, err := g.operand(q.Arg1())
+		if err != nil {
+			return err
+		}
+		g.emit(`printf("%%lld\n", %s);`, arg)
+	case "quit":
+		g.emit("return 0;")
+	default:
+		return UnknownOpErr
+	}
+	return nil
+}
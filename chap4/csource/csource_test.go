@@ -0,0 +1,58 @@
+package csource
+
+import (
+	"bytes"
+	"chap4/compiler"
+	"chap4/internal/corpus"
+	"chap4/interpreter"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRoundTrip 用cc编译每个样例程序生成的C源程序，运行结果应与四元式解释器相同；没有cc时跳过
+func TestRoundTrip(t *testing.T) {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("cc not found")
+	}
+	programs, err := corpus.Programs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range programs {
+		p := p
+		t.Run(p.Name, func(t *testing.T) {
+			result, diagnostics := compiler.CompileFile(p.Path, compiler.Options{})
+			if compiler.HasErrors(diagnostics) {
+				t.Skipf("%s does not compile: %v", p.Path, diagnostics[0])
+			}
+			var want bytes.Buffer
+			runErr := interpreter.NewInterpreter(result.Semantic, strings.NewReader(corpus.Input), &want).Run()
+			src, err := NewGenerator(result.Semantic).Generate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "main.c"), []byte(src), 0666); err != nil {
+				t.Fatal(err)
+			}
+			build := exec.Command(cc, "-std=c99", "-o", "main", "main.c")
+			build.Dir = dir
+			if out, err := build.CombinedOutput(); err != nil {
+				t.Fatalf("cc: %v\n%s\n%s", err, out, src)
+			}
+			run := exec.Command(filepath.Join(dir, "main"))
+			run.Stdin = strings.NewReader(corpus.Input)
+			got, err := run.Output()
+			if (err != nil) != (runErr != nil) {
+				t.Fatalf("C program error = %v, interpreter error = %v", err, runErr)
+			}
+			if string(got) != want.String() {
+				t.Errorf("C program output = %q, interpreter output = %q", got, want.String())
+			}
+		})
+	}
+}
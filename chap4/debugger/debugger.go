@@ -0,0 +1,596 @@
+// Package debugger 四元式解释器的源程序级调试器
+//
+// 断点可以设在源程序的行上，也可以设在四元式的下标上（break *下标）；
+// 程序停下时显示当前的源程序行、前后几条四元式以及所有监视表达式的值。
+// 命令从reader中逐行读取，既可以交互使用，也可以从命令文件中读取用于自动化测试。
+// 没有通过SetInput给出程序的输入时，程序中的read从命令流中读取。
+package debugger
+
+import (
+	"bufio"
+	"bytes"
+	"chap4/interpreter"
+	"chap4/lexer"
+	"chap4/semantic"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	prompt = "(cpdb) "
+	around = 3 // 当前四元式前后各显示的条数
+	window = 5 // list前后各显示的行数
+)
+
+var (
+	NotRunningErr = errors.New("the program is not being run")
+	NoCodeErr     = errors.New("no code at or after this line")
+	BadIndexErr   = errors.New("no such quadruple")
+	NoSuchIDErr   = errors.New("no such breakpoint or watch")
+)
+
+// breakpoint 断点，line为0表示按下标设置的断点
+type breakpoint struct {
+	id   int
+	pc   int
+	line int
+}
+
+// watch 监视表达式，value为上一次显示的值
+type watch struct {
+	id    int
+	expr  *expr
+	value string
+}
+
+// Debugger 调试会话
+type Debugger struct {
+	sem         *semantic.Semantic
+	quadruples  []*semantic.Quadruple
+	lines       []string // 源程序的各行
+	reader      *bufio.Reader
+	out         io.Writer
+	input       []byte // 程序的输入，nil表示从命令流中读取
+	interp      *interpreter.Interpreter
+	running     bool // 程序已经开始并且没有结束
+	breakpoints []*breakpoint
+	watches     []*watch
+	nextBreak   int
+	nextWatch   int
+	prompt      bool
+	echo        bool
+	last        string // 上一条执行命令，空行时重复
+	pending     bool   // 程序从命令流中读取过，命令流中还剩下该行的换行
+}
+
+// New 创建一个调试会话，s为语义分析的结果，src为源程序，命令从in中读取，调试信息与程序的输出都写到out
+func New(s *semantic.Semantic, src []byte, in io.Reader, out io.Writer) *Debugger {
+	d := &Debugger{
+		sem:        s,
+		quadruples: s.QuadrupleList(),
+		lines:      strings.Split(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n"),
+		reader:     bufio.NewReader(in),
+		out:        out,
+		prompt:     true,
+	}
+	d.reset()
+	return d
+}
+
+// SetInput 设置程序的输入，每次run或start都从头读取
+func (d *Debugger) SetInput(input []byte) {
+	d.input = input
+}
+
+// SetPrompt 设置是否打印提示符
+func (d *Debugger) SetPrompt(prompt bool) {
+	d.prompt = prompt
+}
+
+// SetEcho 设置是否回显读入的命令，从命令文件中读取时使输出与交互时一样
+func (d *Debugger) SetEcho(echo bool) {
+	d.echo = echo
+}
+
+// reset 创建新的解释器，变量都回到0
+func (d *Debugger) reset() {
+	var in io.Reader = d.reader
+	if d.input != nil {
+		in = bytes.NewReader(d.input)
+	}
+	d.interp = interpreter.NewInterpreter(d.sem, in, d.out)
+	d.running = false
+}
+
+// Run 逐行读取并执行命令，直到输入结束或quit
+func (d *Debugger) Run() error {
+	for {
+		if d.pending {
+			//read只读走了整数，丢弃同一行剩下的部分
+			d.pending = false
+			if _, err := d.reader.ReadString('\n'); err != nil {
+				return ignoreEOF(err)
+			}
+		}
+		if d.prompt {
+			fmt.Fprint(d.out, prompt)
+		}
+		line, err := d.reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if d.prompt && err == io.EOF {
+				fmt.Fprintln(d.out)
+			}
+			return ignoreEOF(err)
+		}
+		if d.echo {
+			fmt.Fprintln(d.out, strings.TrimRight(line, "\r\n"))
+		}
+		if d.Exec(line) {
+			return nil
+		}
+	}
+}
+
+func ignoreEOF(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// Exec 执行一条命令，返回是否退出，空行重复上一条执行命令
+func (d *Debugger) Exec(line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		line = d.last
+	}
+	cmd, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	var err error
+	switch cmd {
+	case "":
+	case "quit", "q":
+		return true
+	case "help", "h":
+		d.help()
+	case "break", "b":
+		err = d.setBreakpoint(arg)
+	case "delete", "d":
+		err = d.deleteBreakpoint(arg)
+	case "watch":
+		err = d.addWatch(arg)
+	case "unwatch":
+		err = d.deleteWatch(arg)
+	case "info", "i":
+		err = d.info(arg)
+	case "print", "p":
+		err = d.print(arg)
+	case "list", "l":
+		err = d.list(arg)
+	case "context":
+		err = d.context()
+	case "run", "r":
+		d.start(false)
+	case "start":
+		d.start(true)
+	case "continue", "c":
+		err = d.resume(func() bool { return false })
+	case "stepi", "si":
+		err = d.resume(func() bool { return true })
+	case "step", "s":
+		err = d.step()
+	case "next", "n":
+		err = d.next()
+	default:
+		err = fmt.Errorf("unknown command %q, type help for help", cmd)
+	}
+	switch cmd {
+	case "continue", "c", "stepi", "si", "step", "s", "next", "n":
+		d.last = line
+	default:
+		d.last = ""
+	}
+	if err != nil {
+		fmt.Fprintln(d.out, err)
+	}
+	return false
+}
+
+func (d *Debugger) help() {
+	fmt.Fprintln(d.out, `  break LINE | *INDEX   set a breakpoint on a source line or a quadruple
+  delete [N]            delete breakpoint N, or all breakpoints
+  watch EXPR            stop whenever the value of EXPR changes
+  unwatch N             delete watch N
+  info breakpoints      list breakpoints
+  info watch            list watches and their values
+  info locals           show the declared variables
+  info temps            show the temporaries
+  print EXPR            evaluate an expression with the current values
+  list [LINE]           show the source around the current (or given) line
+  context               show the current quadruple and its neighbours
+  run                   start the program and run to the first stop
+  start                 start the program and stop before the first quadruple
+  continue              run to the next breakpoint or watch change
+  step                  run until the source line changes
+  next                  like step, but run over a whole if or while statement
+  stepi                 execute one quadruple
+  quit                  exit
+an empty line repeats the last continue, step, next or stepi`)
+}
+
+// line 返回第pc条四元式所在的源程序行，没有时返回0
+func (d *Debugger) line(pc int) int {
+	if pc < 0 || pc >= len(d.quadruples) {
+		return 0
+	}
+	return d.quadruples[pc].Span().Start.Line
+}
+
+// setBreakpoint 在行上设置断点时，断在该行（或之后第一个有代码的行）的第一条四元式上
+func (d *Debugger) setBreakpoint(arg string) error {
+	bp := &breakpoint{}
+	if strings.HasPrefix(arg, "*") {
+		pc, err := strconv.Atoi(arg[1:])
+		if err != nil || pc < 0 || pc >= len(d.quadruples) {
+			return fmt.Errorf("%w: %s", BadIndexErr, arg[1:])
+		}
+		bp.pc = pc
+	} else {
+		line, err := strconv.Atoi(arg)
+		if err != nil {
+			return errors.New("usage: break LINE | *INDEX")
+		}
+		bp.pc = -1
+		for pc := range d.quadruples {
+			if l := d.line(pc); l >= line && (bp.pc < 0 || l < bp.line) {
+				bp.pc, bp.line = pc, l
+			}
+		}
+		if bp.pc < 0 {
+			return fmt.Errorf("%w: %d", NoCodeErr, line)
+		}
+	}
+	d.nextBreak++
+	bp.id = d.nextBreak
+	d.breakpoints = append(d.breakpoints, bp)
+	fmt.Fprintf(d.out, "Breakpoint %d at %s\n", bp.id, d.where(bp))
+	return nil
+}
+
+func (d *Debugger) where(bp *breakpoint) string {
+	if bp.line == 0 {
+		return fmt.Sprintf("quadruple %d", bp.pc)
+	}
+	return fmt.Sprintf("line %d, quadruple %d", bp.line, bp.pc)
+}
+
+func (d *Debugger) deleteBreakpoint(arg string) error {
+	if arg == "" {
+		d.breakpoints = nil
+		fmt.Fprintln(d.out, "All breakpoints deleted")
+		return nil
+	}
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		return errors.New("usage: delete [N]")
+	}
+	for i, bp := range d.breakpoints {
+		if bp.id == id {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %d", NoSuchIDErr, id)
+}
+
+// breakpointAt 返回设在第pc条四元式上的断点
+func (d *Debugger) breakpointAt(pc int) *breakpoint {
+	for _, bp := range d.breakpoints {
+		if bp.pc == pc {
+			return bp
+		}
+	}
+	return nil
+}
+
+func (d *Debugger) addWatch(arg string) error {
+	if arg == "" {
+		return errors.New("usage: watch EXPR")
+	}
+	e, err := parseExpr(arg)
+	if err != nil {
+		return err
+	}
+	d.nextWatch++
+	w := &watch{id: d.nextWatch, expr: e}
+	w.value = d.show(e)
+	d.watches = append(d.watches, w)
+	fmt.Fprintf(d.out, "Watch %d: %s = %s\n", w.id, arg, w.value)
+	return nil
+}
+
+func (d *Debugger) deleteWatch(arg string) error {
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		return errors.New("usage: unwatch N")
+	}
+	for i, w := range d.watches {
+		if w.id == id {
+			d.watches = append(d.watches[:i], d.watches[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %d", NoSuchIDErr, id)
+}
+
+// show 对表达式求值并转换为显示的文本，出错时显示错误
+func (d *Debugger) show(e *expr) string {
+	v, err := e.eval(d)
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return v.String()
+}
+
+// changed 重新计算所有监视表达式，打印值发生变化的，返回是否有变化
+func (d *Debugger) changed() bool {
+	changed := false
+	for _, w := range d.watches {
+		value := d.show(w.expr)
+		if value != w.value {
+			fmt.Fprintf(d.out, "Watch %d: %s\nOld value = %s\nNew value = %s\n", w.id, w.expr.source, w.value, value)
+			w.value = value
+			changed = true
+		}
+	}
+	return changed
+}
+
+// variable 读取变量或临时变量的值，类型来自符号表
+func (d *Debugger) variable(name string) (value, error) {
+	symbol, ok := d.sem.SymbolTable[name]
+	if !ok || symbol.Type == "" {
+		return value{}, fmt.Errorf("%w: %s", UnknownVarErr, name)
+	}
+	return value{d.interp.Memory()[name], symbol.Type}, nil
+}
+
+// isTemp 临时变量由语义分析器加入符号表，不是词法分析得到的标识符
+func isTemp(symbol *lexer.Symbol) bool {
+	return symbol.Class != lexer.Identifier
+}
+
+func (d *Debugger) info(arg string) error {
+	switch arg {
+	case "breakpoints", "b":
+		if len(d.breakpoints) == 0 {
+			fmt.Fprintln(d.out, "No breakpoints")
+		}
+		for _, bp := range d.breakpoints {
+			fmt.Fprintf(d.out, "%-3d %s\n", bp.id, d.where(bp))
+		}
+	case "watch", "w":
+		if len(d.watches) == 0 {
+			fmt.Fprintln(d.out, "No watches")
+		}
+		for _, w := range d.watches {
+			fmt.Fprintf(d.out, "%-3d %s = %s\n", w.id, w.expr.source, d.show(w.expr))
+		}
+	case "locals", "temps":
+		names := make([]string, 0)
+		for _, name := range d.sem.VarList() {
+			if isTemp(d.sem.SymbolTable[name]) == (arg == "temps") {
+				names = append(names, name)
+			}
+		}
+		if arg == "temps" {
+			//t2排在t10之前
+			sort.Slice(names, func(i, j int) bool {
+				return len(names[i]) < len(names[j]) || len(names[i]) == len(names[j]) && names[i] < names[j]
+			})
+		}
+		if len(names) == 0 {
+			fmt.Fprintf(d.out, "No %s\n", arg)
+		}
+		for _, name := range names {
+			v, _ := d.variable(name)
+			fmt.Fprintf(d.out, "%-8s %-4s %s\n", name, v.typ, v)
+		}
+	default:
+		return errors.New("usage: info breakpoints|watch|locals|temps")
+	}
+	return nil
+}
+
+func (d *Debugger) print(arg string) error {
+	if arg == "" {
+		return errors.New("usage: print EXPR")
+	}
+	e, err := parseExpr(arg)
+	if err != nil {
+		return err
+	}
+	v, err := e.eval(d)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(d.out, "%s = %s\n", arg, v)
+	return nil
+}
+
+// list 显示源程序的一段，=>标出当前行，*标出有断点的行
+func (d *Debugger) list(arg string) error {
+	center := d.line(d.interp.PC())
+	if arg != "" {
+		line, err := strconv.Atoi(arg)
+		if err != nil {
+			return errors.New("usage: list [LINE]")
+		}
+		center = line
+	}
+	if center == 0 {
+		center = 1
+	}
+	current := 0
+	if d.running {
+		current = d.line(d.interp.PC())
+	}
+	marked := make(map[int]bool)
+	for _, bp := range d.breakpoints {
+		marked[d.line(bp.pc)] = true
+	}
+	width := len(fmt.Sprint(len(d.lines)))
+	for line := center - window; line <= center+window; line++ {
+		if line < 1 || line > len(d.lines) {
+			continue
+		}
+		arrow, mark := "  ", " "
+		if line == current {
+			arrow = "=>"
+		}
+		if marked[line] {
+			mark = "*"
+		}
+		fmt.Fprintf(d.out, "%s%s%*d | %s\n", arrow, mark, width, line, strings.TrimRight(d.lines[line-1], " \t"))
+	}
+	return nil
+}
+
+// context 显示当前的源程序行，当前四元式及其前后各around条，以及监视表达式的值
+func (d *Debugger) context() error {
+	if !d.running {
+		return NotRunningErr
+	}
+	pc := d.interp.PC()
+	if line := d.line(pc); line > 0 && line <= len(d.lines) {
+		fmt.Fprintf(d.out, "line %d: %s\n", line, strings.TrimSpace(d.lines[line-1]))
+	}
+	width := len(fmt.Sprint(len(d.quadruples) - 1))
+	for index := pc - around; index <= pc+around; index++ {
+		if index < 0 || index >= len(d.quadruples) {
+			continue
+		}
+		arrow := "  "
+		if index == pc {
+			arrow = "=>"
+		}
+		fmt.Fprintf(d.out, "%s %*d: %s\n", arrow, width, index, d.quadruples[index])
+	}
+	for _, w := range d.watches {
+		w.value = d.show(w.expr)
+		fmt.Fprintf(d.out, "watch %d: %s = %s\n", w.id, w.expr.source, w.value)
+	}
+	return nil
+}
+
+// start 从头开始执行程序，stop为true时停在第一条四元式之前，否则运行到第一个停止的位置
+func (d *Debugger) start(stop bool) {
+	d.reset()
+	d.running = true
+	for _, w := range d.watches {
+		w.value = d.show(w.expr)
+	}
+	if bp := d.breakpointAt(0); bp != nil && !stop {
+		fmt.Fprintf(d.out, "Breakpoint %d, %s\n", bp.id, d.where(bp))
+		d.context()
+		return
+	}
+	if d.interp.Done() {
+		d.running = false
+		fmt.Fprintln(d.out, "Program exited normally after 0 steps")
+		return
+	}
+	if stop {
+		d.context()
+		return
+	}
+	d.resume(func() bool { return false })
+}
+
+// resume 逐条执行四元式，每条之后检查程序是否结束、监视表达式是否变化、是否遇到断点，
+// 最后由until决定是否停下
+func (d *Debugger) resume(until func() bool) error {
+	if !d.running {
+		return NotRunningErr
+	}
+	for {
+		pc := d.interp.PC()
+		_, err := d.interp.Step()
+		if d.input == nil && d.quadruples[pc].Op() == "read" {
+			d.pending = true
+		}
+		if err != nil {
+			d.running = false
+			fmt.Fprintf(d.out, "Program terminated: %v\n", err)
+			return nil
+		}
+		if d.interp.Done() {
+			d.running = false
+			fmt.Fprintf(d.out, "Program exited normally after %d steps\n", d.interp.Steps())
+			return nil
+		}
+		stop := d.changed()
+		if bp := d.breakpointAt(d.interp.PC()); bp != nil {
+			fmt.Fprintf(d.out, "Breakpoint %d, %s\n", bp.id, d.where(bp))
+			stop = true
+		}
+		if stop || until() {
+			return d.context()
+		}
+	}
+}
+
+// step 执行到源程序的行发生变化，或者向回跳转（循环体在同一行时）
+func (d *Debugger) step() error {
+	from := d.interp.PC()
+	line := d.line(from)
+	return d.resume(func() bool {
+		pc := d.interp.PC()
+		return pc <= from || d.line(pc) != line
+	})
+}
+
+// next 当前是if或while的条件时执行完整个语句，否则与step相同
+func (d *Debugger) next() error {
+	from := d.interp.PC()
+	end := d.statementEnd(from)
+	if end < 0 {
+		return d.step()
+	}
+	return d.resume(func() bool {
+		pc := d.interp.PC()
+		return pc < from || pc >= end
+	})
+}
+
+// statementEnd 第pc条四元式开始的是if或while的条件时，返回整个语句之后的第一条四元式的下标，否则返回-1
+//
+// 条件部分以(jnz, ...)与(j, _, _, E)结尾，二者的范围相同；E为假出口，即else部分或循环之后。
+// E之前的一条是向前的j时，它是then部分末尾跳过else的跳转，其目标才是if语句之后。
+func (d *Debugger) statementEnd(pc int) int {
+	if pc < 0 || pc >= len(d.quadruples) {
+		return -1
+	}
+	span := d.quadruples[pc].Span()
+	last := pc
+	for last+1 < len(d.quadruples) && d.quadruples[last+1].Span() == span {
+		last++
+	}
+	if last == pc || d.quadruples[last].Op() != "j" || d.quadruples[last-1].Op() == "j" || !d.quadruples[last-1].IsJump() {
+		return -1
+	}
+	end, err := d.quadruples[last].JumpTarget()
+	if err != nil || end <= last {
+		return -1
+	}
+	if q := d.quadruples[end-1]; end-1 > last && q.Op() == "j" {
+		if target, err := q.JumpTarget(); err == nil && target >= end {
+			end = target
+		}
+	}
+	return end
+}
@@ -0,0 +1,49 @@
+package debugger
+
+import (
+	"bytes"
+	"chap4/compiler"
+	"golden"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestScript 用testdata下的命令文件调试text/source.txt，回显命令、不打印提示符，
+// 输出与同名的.golden文件比较；go test -update改为重写golden文件
+func TestScript(t *testing.T) {
+	scripts, err := filepath.Glob("testdata/*.cpdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scripts) == 0 {
+		t.Fatal("no command scripts found in testdata")
+	}
+	source := filepath.Join("..", "text", "source.txt")
+	src, err := os.ReadFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, diagnostics := compiler.Compile(src, compiler.Options{Filename: source})
+	if compiler.HasErrors(diagnostics) {
+		t.Fatal(diagnostics)
+	}
+	for _, script := range scripts {
+		script := script
+		t.Run(filepath.Base(script), func(t *testing.T) {
+			commands, err := os.ReadFile(script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			d := New(result.Semantic, src, bytes.NewReader(commands), &out)
+			d.SetEcho(true)
+			d.SetPrompt(false)
+			if err := d.Run(); err != nil {
+				t.Fatal(err)
+			}
+			golden.Check(t, strings.TrimSuffix(script, ".cpdb")+".golden", out.Bytes())
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package debugger
+
+import (
+	"chap4/compiler"
+	"chap4/interpreter"
+	"chap4/lexer"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var (
+	ExprSyntaxErr = errors.New("syntax error in expression")
+	UnknownVarErr = errors.New("no such variable")
+)
+
+// value 表达式的值，typ为int或bool
+type value struct {
+	v   int
+	typ string
+}
+
+func (v value) String() string {
+	return format(v.v, v.typ)
+}
+
+// format 按类型格式化值
+func format(v int, typ string) string {
+	if typ == "bool" {
+		return fmt.Sprint(v != 0)
+	}
+	return fmt.Sprint(v)
+}
+
+// expr 监视与打印使用的表达式，语法与源程序中的表达式相同：
+// 整数、true/false、变量与临时变量，+ - * / 与一元-，关系运算，&& || !，以及括号
+type expr struct {
+	source string
+	tokens []*lexer.Token
+}
+
+// parseExpr 用源程序的词法分析器切分表达式，语法在求值时检查
+func parseExpr(source string) (*expr, error) {
+	result, diagnostics := compiler.Compile([]byte(source), compiler.Options{StopAfter: compiler.PhaseLex})
+	for _, d := range diagnostics {
+		if d.Severity == compiler.SeverityError {
+			return nil, errors.New(d.Message)
+		}
+	}
+	if len(result.Tokens) == 0 {
+		return nil, fmt.Errorf("%w: empty expression", ExprSyntaxErr)
+	}
+	return &expr{source: source, tokens: result.Tokens}, nil
+}
+
+// evaluator 对表达式的一次求值，按优先级递归下降
+type evaluator struct {
+	tokens []*lexer.Token
+	index  int
+	d      *Debugger
+}
+
+// eval 用调试器当前的变量值对表达式求值
+func (e *expr) eval(d *Debugger) (value, error) {
+	ev := &evaluator{tokens: e.tokens, d: d}
+	v, err := ev.or()
+	if err != nil {
+		return value{}, err
+	}
+	if ev.index < len(ev.tokens) {
+		return value{}, ev.unexpected()
+	}
+	return v, nil
+}
+
+func (ev *evaluator) peek() string {
+	if ev.index < len(ev.tokens) {
+		return ev.tokens[ev.index].Value
+	}
+	return ""
+}
+
+func (ev *evaluator) unexpected() error {
+	if ev.index < len(ev.tokens) {
+		return fmt.Errorf("%w: unexpected %q", ExprSyntaxErr, ev.tokens[ev.index].Value)
+	}
+	return fmt.Errorf("%w: unexpected end", ExprSyntaxErr)
+}
+
+// operand 检查运算数的类型
+func operand(op string, v value, typ string) error {
+	if v.typ != typ {
+		return fmt.Errorf("operand of %s must be %s", op, typ)
+	}
+	return nil
+}
+
+func (ev *evaluator) or() (value, error) {
+	left, err := ev.and()
+	for err == nil && ev.peek() == "||" {
+		ev.index++
+		var right value
+		if right, err = ev.and(); err != nil {
+			break
+		}
+		if err = operand("||", left, "bool"); err == nil {
+			err = operand("||", right, "bool")
+		}
+		left = boolValue(left.v != 0 || right.v != 0)
+	}
+	return left, err
+}
+
+func (ev *evaluator) and() (value, error) {
+	left, err := ev.not()
+	for err == nil && ev.peek() == "&&" {
+		ev.index++
+		var right value
+		if right, err = ev.not(); err != nil {
+			break
+		}
+		if err = operand("&&", left, "bool"); err == nil {
+			err = operand("&&", right, "bool")
+		}
+		left = boolValue(left.v != 0 && right.v != 0)
+	}
+	return left, err
+}
+
+func (ev *evaluator) not() (value, error) {
+	if ev.peek() != "!" {
+		return ev.rel()
+	}
+	ev.index++
+	v, err := ev.not()
+	if err == nil {
+		err = operand("!", v, "bool")
+	}
+	return boolValue(v.v == 0), err
+}
+
+func (ev *evaluator) rel() (value, error) {
+	left, err := ev.add()
+	if err != nil {
+		return left, err
+	}
+	op := ev.peek()
+	switch op {
+	case ">", ">=", "<", "<=", "==", "!=":
+	default:
+		return left, nil
+	}
+	ev.index++
+	right, err := ev.add()
+	if err != nil {
+		return right, err
+	}
+	if err := operand(op, left, "int"); err != nil {
+		return value{}, err
+	}
+	if err := operand(op, right, "int"); err != nil {
+		return value{}, err
+	}
+	var b bool
+	switch op {
+	case ">":
+		b = left.v > right.v
+	case ">=":
+		b = left.v >= right.v
+	case "<":
+		b = left.v < right.v
+	case "<=":
+		b = left.v <= right.v
+	case "==":
+		b = left.v == right.v
+	case "!=":
+		b = left.v != right.v
+	}
+	return boolValue(b), nil
+}
+
+func (ev *evaluator) add() (value, error) {
+	left, err := ev.mul()
+	for err == nil && (ev.peek() == "+" || ev.peek() == "-") {
+		op := ev.peek()
+		ev.index++
+		var right value
+		if right, err = ev.mul(); err != nil {
+			break
+		}
+		if err = operand(op, left, "int"); err == nil {
+			err = operand(op, right, "int")
+		}
+		if op == "+" {
+			left.v += right.v
+		} else {
+			left.v -= right.v
+		}
+	}
+	return left, err
+}
+
+func (ev *evaluator) mul() (value, error) {
+	left, err := ev.unary()
+	for err == nil && (ev.peek() == "*" || ev.peek() == "/") {
+		op := ev.peek()
+		ev.index++
+		var right value
+		if right, err = ev.unary(); err != nil {
+			break
+		}
+		if err = operand(op, left, "int"); err == nil {
+			err = operand(op, right, "int")
+		}
+		if err != nil {
+			break
+		}
+		if op == "*" {
+			left.v *= right.v
+		} else if right.v == 0 {
+			err = interpreter.DivisionByZeroErr
+		} else {
+			left.v /= right.v
+		}
+	}
+	return left, err
+}
+
+func (ev *evaluator) unary() (value, error) {
+	if ev.peek() != "-" {
+		return ev.primary()
+	}
+	ev.index++
+	v, err := ev.unary()
+	if err == nil {
+		err = operand("-", v, "int")
+	}
+	v.v = -v.v
+	return v, err
+}
+
+func (ev *evaluator) primary() (value, error) {
+	if ev.index >= len(ev.tokens) {
+		return value{}, ev.unexpected()
+	}
+	token := ev.tokens[ev.index]
+	switch {
+	case token.Value == "(":
+		ev.index++
+		v, err := ev.or()
+		if err != nil {
+			return v, err
+		}
+		if ev.peek() != ")" {
+			return value{}, ev.unexpected()
+		}
+		ev.index++
+		return v, nil
+	case token.Class == lexer.IntConst:
+		ev.index++
+		n, err := strconv.Atoi(token.Value)
+		return value{n, "int"}, err
+	case token.Class == lexer.BoolConst:
+		ev.index++
+		return boolValue(token.Value == "true"), nil
+	case token.Class == lexer.Identifier:
+		ev.index++
+		return ev.d.variable(token.Value)
+	}
+	return value{}, ev.unexpected()
+}
+
+func boolValue(b bool) value {
+	if b {
+		return value{1, "bool"}
+	}
+	return value{0, "bool"}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"chap4/analyzer"
+	"chap4/compiler"
+	"chap4/internal/corpus"
+	"chap4/interpreter"
+	"chap4/lexer"
+	"fmt"
+	"golden"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// phase 一个被比较的阶段，ext为golden文件的扩展名
+type phase struct {
+	ext string
+	run func(t *testing.T, source string, result *compiler.Result) []byte
+}
+
+var phases = []phase{
+	{"tokens", goldenTokens},
+	{"tree", goldenTree},
+	{"ir", goldenIR},
+	{"out", goldenOutput},
+}
+
+// TestGolden 编译corpus中的每个样例程序（chap4/text与chap3/test下的source*.txt，不含用于性能测试的bench），
+// 将单词、语法树、四元式与运行结果分别与text/golden下的文件比较；不能编译的程序只比较诊断信息
+//
+// 程序运行时的输入取自与源程序同名的.in文件，没有该文件时使用corpus.Input。
+func TestGolden(t *testing.T) {
+	programs, err := corpus.Programs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(programs) == 0 {
+		t.Fatal("no source files found")
+	}
+	for _, program := range programs {
+		program := program
+		if program.Name == "bench" {
+			continue
+		}
+		t.Run(program.Name, func(t *testing.T) {
+			result, diagnostics := compiler.CompileFile(program.Path, compiler.Options{})
+			if compiler.HasErrors(diagnostics) {
+				var b bytes.Buffer
+				for _, d := range diagnostics {
+					//诊断信息中的路径与工作目录有关，只保留文件名
+					fmt.Fprintln(&b, strings.Replace(d.String(), program.Path, filepath.Base(program.Path), 1))
+				}
+				golden.Check(t, filepath.Join("text", "golden", program.Name+".diag"), b.Bytes())
+				return
+			}
+			for _, p := range phases {
+				p := p
+				t.Run(p.ext, func(t *testing.T) {
+					golden.Check(t, filepath.Join("text", "golden", program.Name+"."+p.ext), p.run(t, program.Path, result))
+				})
+			}
+		})
+	}
+}
+
+func goldenTokens(t *testing.T, source string, result *compiler.Result) []byte {
+	var b bytes.Buffer
+	for _, token := range result.Tokens {
+		fmt.Fprintf(&b, "%-8s %-10s %s\n", token.Pos, lexer.ClassName(token.Class), token.Value)
+	}
+	return b.Bytes()
+}
+
+func goldenTree(t *testing.T, source string, result *compiler.Result) []byte {
+	return []byte(analyzer.FormatTree(result.Tree))
+}
+
+func goldenIR(t *testing.T, source string, result *compiler.Result) []byte {
+	var b bytes.Buffer
+	for index, q := range result.IR {
+		fmt.Fprintf(&b, "%d: %s\n", index, q)
+	}
+	return b.Bytes()
+}
+
+func goldenOutput(t *testing.T, source string, result *compiler.Result) []byte {
+	input, err := os.ReadFile(strings.TrimSuffix(source, ".txt") + ".in")
+	if os.IsNotExist(err) {
+		input, err = []byte(corpus.Input), nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := interpreter.NewInterpreter(result.Semantic, bytes.NewReader(input), &out).Run(); err != nil {
+		fmt.Fprintf(&out, "error: %v\n", err)
+	}
+	return out.Bytes()
+}
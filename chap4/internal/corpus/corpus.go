@@ -0,0 +1,39 @@
+// Package corpus 列出各后端测试共用的样例程序：chap3/test下的source*.txt与chap4/text下的程序
+package corpus
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Input 读入整数的程序在测试中使用的标准输入
+const Input = "7 3 5\n"
+
+// Program 一个样例程序，Name为不带扩展名的文件名，chap3的程序以chap3-开头
+type Program struct {
+	Name string
+	Path string
+}
+
+// Programs 返回所有样例程序，路径与调用者的工作目录无关
+func Programs() ([]Program, error) {
+	_, file, _, _ := runtime.Caller(0)
+	chap4 := filepath.Join(filepath.Dir(file), "..", "..")
+	var programs []Program
+	for _, group := range []struct{ prefix, pattern string }{
+		{"chap3-", filepath.Join(chap4, "..", "chap3", "test", "source*.txt")},
+		{"", filepath.Join(chap4, "text", "source*.txt")},
+		{"", filepath.Join(chap4, "text", "bench.txt")},
+	} {
+		files, err := filepath.Glob(group.pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range files {
+			name := group.prefix + strings.TrimSuffix(filepath.Base(path), ".txt")
+			programs = append(programs, Program{Name: name, Path: path})
+		}
+	}
+	return programs, nil
+}
@@ -0,0 +1,257 @@
+// Package interpreter 直接解释执行四元式
+package interpreter
+
+import (
+	"bufio"
+	"chap4/semantic"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	DivisionByZeroErr = errors.New("runtime error: division by zero")
+	ReadErr           = errors.New("runtime error: cannot read an integer")
+	UnknownOpErr      = errors.New("runtime error: unknown quadruple op")
+	StepLimitErr      = errors.New("runtime error: step limit exceeded")
+	TimeLimitErr      = errors.New("runtime error: time limit exceeded")
+)
+
+// Error 运行时错误，Err为DivisionByZeroErr等错误，Quadruple为出错的四元式，PC为它的下标
+type Error struct {
+	Err       error
+	PC        int
+	Quadruple *semantic.Quadruple
+}
+
+// Error 错误信息中包括出错的四元式，以及生成它的语句所在的源程序行
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%v : %d: %s", e.Err, e.PC, e.Quadruple)
+	if span := e.Quadruple.Span(); span.IsValid() {
+		msg += fmt.Sprintf(" (line %d)", span.Start.Line)
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Interpreter 四元式解释器
+type Interpreter struct {
+	quadrupleList []*semantic.Quadruple
+	memory        map[string]int // 变量及临时变量的值
+	pc            int            // 下一条要执行的四元式下标
+	reader        *bufio.Reader
+	writer        io.Writer
+	steps         int       // 已执行的四元式条数
+	maxSteps      int       // 最多执行的四元式条数，0表示不限制
+	deadline      time.Time // 执行的截止时间，零值表示不限制
+	counts        []int     // 每条四元式执行的次数，nil表示没有开启统计
+}
+
+// NewInterpreter 创建一个四元式解释器实例，read从in中读取，write输出到out
+func NewInterpreter(s *semantic.Semantic, in io.Reader, out io.Writer) *Interpreter {
+	return &Interpreter{
+		quadrupleList: s.QuadrupleList(),
+		memory:        make(map[string]int),
+		reader:        bufio.NewReader(in),
+		writer:        out,
+	}
+}
+
+// Memory 返回变量当前的值
+func (i *Interpreter) Memory() map[string]int {
+	return i.memory
+}
+
+// Set 设置变量的值，在Run之前调用可以给出变量的初值
+func (i *Interpreter) Set(name string, v int) {
+	i.memory[name] = v
+}
+
+// SetMaxSteps 设置最多执行的四元式条数，超过时Run返回StepLimitErr，n为0表示不限制
+func (i *Interpreter) SetMaxSteps(n int) {
+	i.maxSteps = n
+}
+
+// SetDeadline 设置执行的截止时间，超过时Run返回TimeLimitErr
+func (i *Interpreter) SetDeadline(t time.Time) {
+	i.deadline = t
+}
+
+// Steps 返回已执行的四元式条数
+func (i *Interpreter) Steps() int {
+	return i.steps
+}
+
+// EnableProfile 开启统计，记录每条四元式执行的次数，需要在Run之前调用
+func (i *Interpreter) EnableProfile() {
+	i.counts = make([]int, len(i.quadrupleList))
+}
+
+// Counts 返回每条四元式执行的次数，没有开启统计时返回nil
+func (i *Interpreter) Counts() []int {
+	return i.counts
+}
+
+// LineProfile 源程序中一行的执行统计，Count为该行的语句生成的四元式被执行的总次数
+type LineProfile struct {
+	Line  int `json:"line"`
+	Count int `json:"count"`
+}
+
+// Profile 将四元式的执行次数按源程序的行汇总，按行号排序，只包括执行过的行
+func (i *Interpreter) Profile() []LineProfile {
+	byLine := make(map[int]int)
+	for pc, count := range i.counts {
+		if span := i.quadrupleList[pc].Span(); span.IsValid() && count > 0 {
+			byLine[span.Start.Line] += count
+		}
+	}
+	profile := make([]LineProfile, 0, len(byLine))
+	for line, count := range byLine {
+		profile = append(profile, LineProfile{Line: line, Count: count})
+	}
+	sort.Slice(profile, func(a, b int) bool {
+		return profile[a].Line < profile[b].Line
+	})
+	return profile
+}
+
+// Run 从第一条四元式开始执行，直到quit或越过最后一条四元式
+func (i *Interpreter) Run() error {
+	i.Reset()
+	for {
+		done, err := i.Step()
+		if done || err != nil {
+			return err
+		}
+	}
+}
+
+// Reset 回到第一条四元式，已执行的条数清零，变量的值保留
+func (i *Interpreter) Reset() {
+	i.pc = 0
+	i.steps = 0
+}
+
+// PC 返回下一条要执行的四元式下标
+func (i *Interpreter) PC() int {
+	return i.pc
+}
+
+// Done 程序是否已经结束，即下一条是quit或已越过最后一条四元式
+func (i *Interpreter) Done() bool {
+	return i.pc < 0 || i.pc >= len(i.quadrupleList) || i.quadrupleList[i.pc].Op() == "quit"
+}
+
+// Step 执行下一条四元式，程序已经结束时返回done为true，出错时pc停在出错的四元式上
+func (i *Interpreter) Step() (done bool, err error) {
+	if i.Done() {
+		return true, nil
+	}
+	q := i.quadrupleList[i.pc]
+	if i.maxSteps > 0 && i.steps >= i.maxSteps {
+		return false, &Error{Err: StepLimitErr, PC: i.pc, Quadruple: q}
+	}
+	//每执行一定条数检查一次时间，避免每一步都读取时钟
+	if !i.deadline.IsZero() && i.steps%1024 == 0 && time.Now().After(i.deadline) {
+		return false, &Error{Err: TimeLimitErr, PC: i.pc, Quadruple: q}
+	}
+	i.steps++
+	if i.counts != nil {
+		i.counts[i.pc]++
+	}
+	if err := i.step(q); err != nil {
+		return false, &Error{Err: err, PC: i.pc, Quadruple: q}
+	}
+	return false, nil
+}
+
+// value 取操作数的值，常数直接转换，变量从内存中读取
+func (i *Interpreter) value(arg string) int {
+	if v, err := strconv.Atoi(arg); err == nil {
+		return v
+	}
+	return i.memory[arg]
+}
+
+// step 执行一条四元式并更新pc
+func (i *Interpreter) step(q *semantic.Quadruple) error {
+	next := i.pc + 1
+	switch q.Op() {
+	case "+":
+		i.memory[q.Result()] = i.value(q.Arg1()) + i.value(q.Arg2())
+	case "-":
+		i.memory[q.Result()] = i.value(q.Arg1()) - i.value(q.Arg2())
+	case "*":
+		i.memory[q.Result()] = i.value(q.Arg1()) * i.value(q.Arg2())
+	case "/":
+		divisor := i.value(q.Arg2())
+		if divisor == 0 {
+			return DivisionByZeroErr
+		}
+		i.memory[q.Result()] = i.value(q.Arg1()) / divisor
+	case "=", ":=":
+		i.memory[q.Result()] = i.value(q.Arg1())
+	case "j":
+		target, err := q.JumpTarget()
+		if err != nil {
+			return err
+		}
+		next = target
+	case "jnz":
+		if i.value(q.Arg1()) != 0 {
+			target, err := q.JumpTarget()
+			if err != nil {
+				return err
+			}
+			next = target
+		}
+	case "j>", "j>=", "j<", "j<=", "j==", "j!=":
+		if compare(q.Op(), i.value(q.Arg1()), i.value(q.Arg2())) {
+			target, err := q.JumpTarget()
+			if err != nil {
+				return err
+			}
+			next = target
+		}
+	case "read":
+		var v int
+		if _, err := fmt.Fscan(i.reader, &v); err != nil {
+			return ReadErr
+		}
+		i.memory[q.Arg1()] = v
+	case "write":
+		if _, err := fmt.Fprintln(i.writer, i.value(q.Arg1())); err != nil {
+			return err
+		}
+	default:
+		return UnknownOpErr
+	}
+	i.pc = next
+	return nil
+}
+
+// compare 计算关系运算
+func compare(op string, a, b int) bool {
+	switch op {
+	case "j>":
+		return a > b
+	case "j>=":
+		return a >= b
+	case "j<":
+		return a < b
+	case "j<=":
+		return a <= b
+	case "j==":
+		return a == b
+	case "j!=":
+		return a != b
+	}
+	return false
+}
@@ -3,14 +3,20 @@ package lexer
 
 import (
 	"bufio"
+	"embed"
 	"errors"
 	"fmt"
-	"log"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 )
 
+// initFS 词法分析器的初始化文件，编译进程序中，与工作目录无关
+//
+//go:embed init/*.txt
+var initFS embed.FS
+
 const (
 	Identifier = iota + 1 //标识符
 	IntConst              //整常数
@@ -25,6 +31,7 @@ const (
 	newLine    = byte(10)
 	slash      = byte(47)
 	star       = byte(42)
+	slashT     = byte(9)
 	singleLine = 1
 	multiLine  = 2
 )
@@ -77,36 +84,86 @@ type Symbol struct {
 }
 
 type Lexer struct {
-	source []byte
-	target []*Token
-	err    error
+	source    []byte
+	target    []*Token
+	err       error
+	positions []int // clean后每个字节在原始源程序中的偏移
+	lines     []int // 原始源程序每一行的起始偏移
 }
 type Token struct {
-	Class int
-	Value string
+	Class int      `json:"class"`
+	Value string   `json:"value"`
+	Pos   Position `json:"pos"` // 单词在源程序中的位置
+}
+
+// Position 源程序中的位置，行号与列号均从1开始，列号按字节计算
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// String 将位置转换为"行:列"
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// IsValid 判断位置是否有效
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// Span 源程序中的一段，End为最后一个字符之后的位置
+type Span struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// String 将范围转换为"行:列-行:列"
+func (s Span) String() string {
+	return fmt.Sprintf("%s-%s", s.Start, s.End)
+}
+
+// IsValid 判断范围是否有效
+func (s Span) IsValid() bool {
+	return s.Start.IsValid()
+}
+
+// Span 单词在源程序中的范围
+func (t *Token) Span() Span {
+	return Span{Start: t.Pos, End: Position{Line: t.Pos.Line, Column: t.Pos.Column + len(t.Value)}}
+}
+
+// Error 带位置的词法错误，Unwrap得到IdentifierTooLongErr等错误
+type Error struct {
+	Err error
+	Pos Position
+	msg string
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
 }
 
 func InitLexer() error {
-	initPrefix, _ := os.Getwd()
-	keywords, err := os.ReadFile(initPrefix + "/lexer/init/Keyword.txt")
+	keywords, err := initFS.ReadFile("init/keyword.txt")
 	if err != nil {
-		log.Fatal("cannot read source code from file: ", "Keyword.txt")
 		return err
 	}
 	keywordList = strings.Split(string(keywords), ",")
-	operatorList, err = os.ReadFile(initPrefix + "/lexer/init/Operator.txt")
+	operatorList, err = initFS.ReadFile("init/operator.txt")
 	if err != nil {
-		log.Fatal("cannot read source code from file: ", "Operator.txt")
 		return err
 	}
-	separatorList, err = os.ReadFile(initPrefix + "/lexer/init/Separator.txt")
+	separatorList, err = initFS.ReadFile("init/separator.txt")
 	if err != nil {
-		log.Fatal("cannot read source code from file: ", "Separator.txt")
 		return err
 	}
-	data, err := os.ReadFile(initPrefix + "/lexer/init/validOperator.txt")
+	data, err := initFS.ReadFile("init/validOperator.txt")
 	if err != nil {
-		log.Fatal("cannot read source code from file: ", "validOperator.txt")
 		return err
 	}
 	validOperators = strings.Split(string(data), ",")
@@ -120,6 +177,17 @@ func InitLexer() error {
 	SymbolTable = make(map[string]*Symbol)
 	return nil
 }
+
+// Keywords 返回所有关键字，需要先调用InitLexer
+func Keywords() []string {
+	return append([]string(nil), keywordList...)
+}
+
+// ClassName 返回种别的名字，如Identifier
+func ClassName(class int) string {
+	return classMap[class]
+}
+
 func NewLexer() *Lexer {
 	return &Lexer{}
 }
@@ -127,19 +195,23 @@ func NewLexer() *Lexer {
 func (l *Lexer) ReadFromFile(filename string) error {
 	bytes, err := os.ReadFile(filename)
 	if err != nil {
-		log.Fatal("cannot read source code from file: ", filename)
-		return err
+		return fmt.Errorf("cannot read source code from file: %w", err)
 	}
 	l.source = bytes
 	return nil
 }
+
+// ReadFromBytes 从内存中读取源程序
+func (l *Lexer) ReadFromBytes(src []byte) {
+	l.source = src
+}
+
 func (l *Lexer) WriteToFile(filename string) error {
 	file, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
-	defer file.Close()
 	if err != nil {
-		log.Fatal("cannot open target  file: ", filename)
-		return err
+		return fmt.Errorf("cannot open target file: %w", err)
 	}
+	defer file.Close()
 	writer := bufio.NewWriter(file)
 	for i, token := range l.target {
 		var item string
@@ -169,11 +241,37 @@ func (l *Lexer) clean() error {
 	var cleanAnnotation bool
 	var cleanAnnotationType int
 	var cleanTarget []byte
-	for _, b := range l.source {
+	var slashAt int
+	l.positions = l.positions[:0]
+	l.lines = append(l.lines[:0], 0)
+	//emit 输出一个字节，同时记录它在原始源程序中的偏移
+	emit := func(b byte, at int) {
+		cleanTarget = append(cleanTarget, b)
+		l.positions = append(l.positions, at)
+	}
+	//flushSlash 上一个字符为单独的'/'时，说明它是除号而不是注释的开始，需要补回
+	flushSlash := func() {
+		if pre == slash && !cleanAnnotation {
+			emit(slash, slashAt)
+			pre = 0
+		}
+	}
+	for i, b := range l.source {
 		switch b {
 		case enter:
+			flushSlash()
 			pre = enter
+		case slashT:
+			flushSlash()
+			if cleanAnnotation {
+				continue
+			}
+			if !cleanSpace {
+				emit(space, i)
+			}
 		case newLine:
+			flushSlash()
+			l.lines = append(l.lines, i+1)
 			if cleanAnnotation {
 				if cleanAnnotationType == multiLine {
 					continue
@@ -184,31 +282,35 @@ func (l *Lexer) clean() error {
 					return errors.New("cleanAnnotationType is invalid: " + strconv.Itoa(cleanAnnotationType))
 				}
 			}
-			//if pre == enter {
+			//换行视为空白，防止相邻两行的单词粘连
+			if !cleanSpace {
+				emit(space, i)
+			}
 			cleanSpace = true
-			//} else {
-			//	return errors.New("after enter is not a newline")
-			//}
+			pre = 0
 		case space:
+			flushSlash()
 			if cleanAnnotation {
 				continue
 			}
 			if !cleanSpace {
-				cleanTarget = append(cleanTarget, space)
+				emit(space, i)
 			}
 		case slash:
-			if pre == slash {
+			if pre == slash && !cleanAnnotation {
 				cleanAnnotation = true
 				cleanAnnotationType = singleLine
 				pre = 0
-			} else if pre == star {
+			} else if pre == star && cleanAnnotationType == multiLine {
 				cleanAnnotation = false
 				cleanAnnotationType = 0
+				pre = 0
 			} else {
 				pre = slash
+				slashAt = i
 			}
 		case star:
-			if pre == slash {
+			if pre == slash && !cleanAnnotation {
 				cleanAnnotation = true
 				cleanAnnotationType = multiLine
 				pre = 0
@@ -216,20 +318,23 @@ func (l *Lexer) clean() error {
 				if cleanAnnotation {
 					pre = star
 				} else {
-					cleanTarget = append(cleanTarget, star)
+					emit(star, i)
 				}
 			}
 		default:
+			flushSlash()
 			if cleanAnnotation {
+				pre = 0
 				continue
 			}
-			cleanTarget = append(cleanTarget, b)
+			emit(b, i)
 			if cleanSpace {
 				cleanSpace = false
 				pre = 0
 			}
 		}
 	}
+	flushSlash()
 	l.source = cleanTarget
 	//fmt.Printf("%s\n", l.source)
 	return nil
@@ -237,17 +342,19 @@ func (l *Lexer) clean() error {
 
 // Run 进行词法分析
 func (l *Lexer) Run() {
+	l.target = nil
+	l.err = nil
 	err := l.clean()
 	if err != nil {
 		l.err = err
-		log.Println(err)
 		return
 	}
-	err = l.parse()
-	if err != nil {
-		l.err = err
-		log.Println(err)
-	}
+	l.err = l.parse()
+}
+
+// Err 返回词法分析过程中出现的错误，可以通过errors.As得到带位置的*Error
+func (l *Lexer) Err() error {
+	return l.err
 }
 func (l *Lexer) Print() {
 	for _, token := range l.target {
@@ -266,6 +373,7 @@ func (l *Lexer) parse() error {
 	var tokenList []*Token
 	var state int
 	var symbol *Symbol
+	var begin int
 	for i := 0; i < len(l.source) || (i == len(l.source) && state != InitState); {
 		b := byte(' ')
 		if i != len(l.source) {
@@ -276,6 +384,7 @@ func (l *Lexer) parse() error {
 			symbol = &Symbol{
 				Name: []byte{},
 			}
+			begin = i
 			if isLetter(b) {
 				state = IDState
 				symbol.Name = append(symbol.Name, b)
@@ -312,18 +421,20 @@ func (l *Lexer) parse() error {
 				}
 				if len(symbol.Name) > 8 {
 					l.target = tokenList
-					return fmt.Errorf("%w : %s", IdentifierTooLongErr, string(symbol.Name))
+					return l.errorAt(begin, IdentifierTooLongErr, string(symbol.Name))
 				}
 				if v, ok := SymbolTable[string(symbol.Name)]; !ok {
 					SymbolTable[string(symbol.Name)] = symbol
 					tokenList = append(tokenList, &Token{
 						Class: symbol.Class,
 						Value: string(symbol.Name),
+						Pos:   l.position(begin),
 					})
 				} else {
 					tokenList = append(tokenList, &Token{
 						Class: v.Class,
 						Value: string(v.Name),
+						Pos:   l.position(begin),
 					})
 				}
 				state = InitState
@@ -335,22 +446,24 @@ func (l *Lexer) parse() error {
 			} else {
 				if len(symbol.Name) > 1 && symbol.Name[0] == 48 {
 					l.target = tokenList
-					return fmt.Errorf("%w : %s", NumberStartWithZeroErr, string(symbol.Name))
+					return l.errorAt(begin, NumberStartWithZeroErr, string(symbol.Name))
 				}
 				if len(symbol.Name) > 8 {
 					l.target = tokenList
-					return fmt.Errorf("%w : %s", NumberTooLongErr, string(symbol.Name))
+					return l.errorAt(begin, NumberTooLongErr, string(symbol.Name))
 				}
 				if v, ok := SymbolTable[string(symbol.Name)]; !ok {
 					SymbolTable[string(symbol.Name)] = symbol
 					tokenList = append(tokenList, &Token{
 						Class: symbol.Class,
 						Value: string(symbol.Name),
+						Pos:   l.position(begin),
 					})
 				} else {
 					tokenList = append(tokenList, &Token{
 						Class: v.Class,
 						Value: string(v.Name),
+						Pos:   l.position(begin),
 					})
 				}
 				state = InitState
@@ -361,11 +474,13 @@ func (l *Lexer) parse() error {
 				tokenList = append(tokenList, &Token{
 					Class: symbol.Class,
 					Value: string(symbol.Name),
+					Pos:   l.position(begin),
 				})
 			} else {
 				tokenList = append(tokenList, &Token{
 					Class: v.Class,
 					Value: string(v.Name),
+					Pos:   l.position(begin),
 				})
 			}
 			state = InitState
@@ -376,30 +491,57 @@ func (l *Lexer) parse() error {
 			} else {
 				if !isValidOperator(symbol.Name) {
 					l.target = tokenList
-					return fmt.Errorf("%w : %s", InvalidOperatorErr, string(symbol.Name))
+					return l.errorAt(begin, InvalidOperatorErr, string(symbol.Name))
 				}
 				if v, ok := SymbolTable[string(symbol.Name)]; !ok {
 					SymbolTable[string(symbol.Name)] = symbol
 					tokenList = append(tokenList, &Token{
 						Class: symbol.Class,
 						Value: string(symbol.Name),
+						Pos:   l.position(begin),
 					})
 				} else {
 					tokenList = append(tokenList, &Token{
 						Class: v.Class,
 						Value: string(v.Name),
+						Pos:   l.position(begin),
 					})
 				}
 				state = InitState
 			}
 		case ErrState:
 			l.target = tokenList
-			return fmt.Errorf("%w : %v", InvalidCharacter, b)
+			return l.errorAt(begin, InvalidCharacter, fmt.Sprintf("%q", l.source[begin]))
 		}
 	}
 	l.target = tokenList
 	return nil
 }
+
+// position 将clean后的下标转换为原始源程序中的行列
+func (l *Lexer) position(index int) Position {
+	if len(l.positions) == 0 {
+		return Position{Line: 1, Column: 1}
+	}
+	if index >= len(l.positions) {
+		index = len(l.positions) - 1
+	}
+	offset := l.positions[index]
+	line := sort.Search(len(l.lines), func(i int) bool {
+		return l.lines[i] > offset
+	})
+	return Position{Line: line, Column: offset - l.lines[line-1] + 1}
+}
+
+// errorAt 生成clean后下标index处的词法错误
+func (l *Lexer) errorAt(index int, err error, detail string) error {
+	return &Error{
+		Err: err,
+		Pos: l.position(index),
+		msg: fmt.Sprintf("%s : %s", err, detail),
+	}
+}
+
 func isValidOperator(b []byte) bool {
 	s := string(b)
 	for _, op := range validOperators {
@@ -0,0 +1,82 @@
+package lexer
+
+import (
+	"strings"
+	"testing"
+)
+
+// tokens 对src做词法分析，返回以空格分隔的单词
+func tokens(t *testing.T, src string) string {
+	t.Helper()
+	l := NewLexer()
+	l.ReadFromBytes([]byte(src))
+	l.Run()
+	if err := l.Err(); err != nil {
+		t.Fatalf("%q: %v", src, err)
+	}
+	values := make([]string, 0, len(l.Target()))
+	for _, token := range l.Target() {
+		values = append(values, token.Value)
+	}
+	return strings.Join(values, " ")
+}
+
+// TestInitLexer 初始化文件以小写命名，InitLexer应能全部读到
+func TestInitLexer(t *testing.T) {
+	if err := InitLexer(); err != nil {
+		t.Fatal(err)
+	}
+	if len(Keywords()) == 0 || len(operatorList) == 0 || len(separatorList) == 0 || len(validOperators) == 0 {
+		t.Errorf("InitLexer left a table empty")
+	}
+}
+
+func TestClean(t *testing.T) {
+	if err := InitLexer(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, src, want string
+	}{
+		{"tab", "int\ta;", "int a ;"},
+		{"tabs only", "\t\tint a;", "int a ;"},
+		{"newline", "int\na;", "int a ;"},
+		{"crlf", "int\r\na;\r\n", "int a ;"},
+		{"division", "a = b / c;", "a = b / c ;"},
+		{"division without spaces", "a=b/c;", "a = b / c ;"},
+		{"division before newline", "a = b /\nc;", "a = b / c ;"},
+		{"division before tab", "a = b /\tc;", "a = b / c ;"},
+		{"division at end", "a = b /", "a = b /"},
+		{"line comment", "a = 1; // b = 2 / 3\nc = 4;", "a = 1 ; c = 4 ;"},
+		{"line comment at end", "a = 1; // b", "a = 1 ;"},
+		{"block comment", "a /* b * c / d */ = 1;", "a = 1 ;"},
+		{"block comment across lines", "a = 1;/* b\n\tc = 2;\n*/d = 3;", "a = 1 ; d = 3 ;"},
+		{"slash inside block comment", "a /* // */ = 1;", "a = 1 ;"},
+		{"star outside comment", "a = b * c;", "a = b * c ;"},
+		{"star slash outside comment", "a = b * c / d;", "a = b * c / d ;"},
+	}
+	for _, test := range tests {
+		if got := tokens(t, test.src); got != test.want {
+			t.Errorf("%s: tokens(%q) = %q, want %q", test.name, test.src, got, test.want)
+		}
+	}
+}
+
+// TestCleanPosition 补回的除号与tab之后的单词位置指向原始源程序
+func TestCleanPosition(t *testing.T) {
+	if err := InitLexer(); err != nil {
+		t.Fatal(err)
+	}
+	l := NewLexer()
+	l.ReadFromBytes([]byte("a = b /\n\tc;"))
+	l.Run()
+	if err := l.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Position{"/": {1, 7}, "c": {2, 2}}
+	for _, token := range l.Target() {
+		if pos, ok := want[token.Value]; ok && token.Pos != pos {
+			t.Errorf("%s at %s, want %s", token.Value, token.Pos, pos)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+// Package llvm 由四元式生成LLVM IR文本(.ll)
+//
+// 每个变量（包括临时变量）在入口块中用alloca分配，读写都经过load/store，
+// 交给mem2reg提升为SSA；int对应i32，bool对应i1。与WAT后端一样是32位，
+// 而解释器、字节码虚拟机、汇编与C后端使用64位整数，溢出i32的程序结果会不同。
+// read、write以及除零处理声明为外部运行时函数，实现见Runtime：
+//
+//	clang -O2 target.ll runtime.c -o target
+//
+// 指针一律写作不透明指针ptr，需要LLVM 15及以上；LLVM 14需要显式打开不透明指针，
+// 如llc -opaque-pointers、clang -Xclang -opaque-pointers。
+package llvm
+
+import (
+	"chap4/cfg"
+	"chap4/lexer"
+	"chap4/semantic"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	EmptyProgramErr = errors.New("error: no quadruple to generate")
+	UnknownOpErr    = errors.New("error: unknown quadruple op")
+)
+
+// relationMap 条件跳转四元式对应的icmp谓词
+var relationMap = map[string]string{
+	"j>":  "sgt",
+	"j>=": "sge",
+	"j<":  "slt",
+	"j<=": "sle",
+	"j==": "eq",
+	"j!=": "ne",
+}
+
+// arithMap 算术四元式对应的LLVM指令
+var arithMap = map[string]string{
+	"+": "add",
+	"-": "sub",
+	"*": "mul",
+	"/": "sdiv",
+}
+
+// Runtime 运行时函数的C实现，与四元式解释器的行为保持一致
+const Runtime = `#include <stdio.h>
+#include <stdlib.h>
+
+int read_int(void)
+{
+    int v;
+    if (scanf("%d", &v) != 1) {
+        fprintf(stderr, "runtime error: cannot read an integer\n");
+        exit(1);
+    }
+    return v;
+}
+
+void write_int(int v)
+{
+    printf("%d\n", v);
+}
+
+void div_by_zero(void)
+{
+    fprintf(stderr, "runtime error: division by zero\n");
+    exit(1);
+}
+`
+
+// Generator LLVM IR生成器
+type Generator struct {
+	quadrupleList []*semantic.Quadruple
+	symbolTable   map[string]*lexer.Symbol
+	vars          []string
+	graph         *cfg.Graph
+	lines         []string
+	values        int  // 已使用的SSA值编号
+	divZero       bool // 是否需要生成除零处理块
+}
+
+// NewGenerator 创建一个LLVM IR生成器实例
+func NewGenerator(s *semantic.Semantic) *Generator {
+	return &Generator{
+		quadrupleList: s.QuadrupleList(),
+		symbolTable:   s.SymbolTable,
+		vars:          s.VarList(),
+		lines:         make([]string, 0),
+	}
+}
+
+// Generate 生成LLVM IR，生成后进行结构校验
+func (g *Generator) Generate() (string, error) {
+	if len(g.quadrupleList) == 0 {
+		return "", EmptyProgramErr
+	}
+	graph, err := cfg.Build(g.quadrupleList)
+	if err != nil {
+		return "", err
+	}
+	g.graph = graph
+	g.lines = g.lines[:0]
+	g.values = 0
+	g.divZero = false
+	g.lines = append(g.lines,
+		"; generated from quadruples",
+		"declare i32 @read_int()",
+		"declare void @write_int(i32)",
+		"declare void @div_by_zero()",
+		"",
+		"define i32 @main() {",
+		"entry:",
+	)
+	for _, name := range g.vars {
+		g.emit("%s = alloca %s", addr(name), g.typeOf(name))
+	}
+	for _, name := range g.vars {
+		zero, _ := g.operand("0", g.typeOf(name))
+		g.emit("store %s %s, ptr %s", g.typeOf(name), zero, addr(name))
+	}
+	g.emit("br label %%%s", g.label(0))
+	for _, block := range graph.Blocks {
+		g.lines = append(g.lines, g.label(block.Start)+":")
+		if err := g.emitBlock(block); err != nil {
+			return "", err
+		}
+	}
+	g.lines = append(g.lines, "exit:")
+	g.emit("ret i32 0")
+	if g.divZero {
+		g.lines = append(g.lines, "div.zero:")
+		g.emit("call void @div_by_zero()")
+		g.emit("unreachable")
+	}
+	g.lines = append(g.lines, "}")
+	ir := strings.Join(g.lines, "\n") + "\n"
+	if err := Verify(ir); err != nil {
+		return "", err
+	}
+	return ir, nil
+}
+
+// PrintToFile 将LLVM IR写入文件
+func (g *Generator) PrintToFile(filename string) error {
+	ir, err := g.Generate()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, []byte(ir), 0666)
+}
+
+func (g *Generator) emit(format string, a ...any) {
+	g.lines = append(g.lines, "  "+fmt.Sprintf(format, a...))
+}
+
+// value 分配一个新的SSA值
+func (g *Generator) value() string {
+	g.values++
+	return fmt.Sprintf("%%v%d", g.values)
+}
+
+// addr 变量对应的alloca
+func addr(name string) string {
+	return "%" + name + ".addr"
+}
+
+// label 以四元式下标start为首指令的基本块的标号，越过末尾的跳转目标为exit
+func (g *Generator) label(start int) string {
+	if start >= len(g.quadrupleList) {
+		return "exit"
+	}
+	return fmt.Sprintf("q%d", start)
+}
+
+// typeOf 变量的LLVM类型，bool为i1，其余为i32
+func (g *Generator) typeOf(name string) string {
+	if symbol, ok := g.symbolTable[name]; ok && symbol.Type == "bool" {
+		return "i1"
+	}
+	return "i32"
+}
+
+// operand 将操作数转换为指定类型的值，变量先load，类型不同时进行转换
+func (g *Generator) operand(arg, typ string) (string, error) {
+	if semantic.IsConst(arg) {
+		if typ == "i1" {
+			if arg == "0" {
+				return "false", nil
+			}
+			return "true", nil
+		}
+		return arg, nil
+	}
+	if _, ok := g.symbolTable[arg]; !ok {
+		return "", fmt.Errorf("error: %s is not declared", arg)
+	}
+	from := g.typeOf(arg)
+	v := g.value()
+	g.emit("%s = load %s, ptr %s", v, from, addr(arg))
+	return g.convert(v, from, typ), nil
+}
+
+// convert 在i1与i32之间转换
+func (g *Generator) convert(v, from, to string) string {
+	if from == to {
+		return v
+	}
+	res := g.value()
+	if to == "i1" {
+		g.emit("%s = icmp ne i32 %s, 0", res, v)
+	} else {
+		g.emit("%s = zext i1 %s to i32", res, v)
+	}
+	return res
+}
+
+// store 将类型为typ的值v存入变量name
+func (g *Generator) store(v, typ, name string) error {
+	if _, ok := g.symbolTable[name]; !ok {
+		return fmt.Errorf("error: %s is not declared", name)
+	}
+	to := g.typeOf(name)
+	g.emit("store %s %s, ptr %s", to, g.convert(v, typ, to), addr(name))
+	return nil
+}
+
+// emitBlock 翻译一个基本块，并生成其末尾的终结指令
+func (g *Generator) emitBlock(block *cfg.Block) error {
+	for index := block.Start; index < block.End; index++ {
+		q := g.quadrupleList[index]
+		if err := g.emitQuadruple(index, q); err != nil {
+			return fmt.Errorf("%w : %d: %s", err, index, q)
+		}
+	}
+	last := g.quadrupleList[block.Last()]
+	if !last.IsJump() && last.Op() != "quit" {
+		g.emit("br label %%%s", g.label(block.End))
+	}
+	return nil
+}
+
+// emitQuadruple 将一条四元式翻译为LLVM指令
+func (g *Generator) emitQuadruple(index int, q *semantic.Quadruple) error {
+	switch q.Op() {
+	case "+", "-", "*", "/":
+		a, err := g.operand(q.Arg1(), "i32")
+		if err != nil {
+			return err
+		}
+		b, err := g.operand(q.Arg2(), "i32")
+		if err != nil {
+			return err
+		}
+		if q.Op() == "/" {
+			g.divZero = true
+			zero := g.value()
+			g.emit("%s = icmp eq i32 %s, 0", zero, b)
+			g.emit("br i1 %s, label %%div.zero, label %%q%d.div", zero, index)
+			g.lines = append(g.lines, fmt.Sprintf("q%d.div:", index))
+		}
+		v := g.value()
+		g.emit("%s = %s i32 %s, %s", v, arithMap[q.Op()], a, b)
+		return g.store(v, "i32", q.Result())
+	case "=", ":=":
+		typ := g.typeOf(q.Result())
+		v, err := g.operand(q.Arg1(), typ)
+		if err != nil {
+			return err
+		}
+		return g.store(v, typ, q.Result())
+	case "j":
+		target, err := q.JumpTarget()
+		if err != nil {
+			return err
+		}
+		g.emit("br label %%%s", g.label(target))
+	case "jnz", "j>", "j>=", "j<", "j<=", "j==", "j!=":
+		target, err := q.JumpTarget()
+		if err != nil {
+			return err
+		}
+		var cond string
+		if q.Op() == "jnz" {
+			cond, err = g.operand(q.Arg1(), "i1")
+			if err != nil {
+				return err
+			}
+		} else {
+			a, err := g.operand(q.Arg1(), "i32")
+			if err != nil {
+				return err
+			}
+			b, err := g.operand(q.Arg2(), "i32")
+			if err != nil {
+				return err
+			}
+			cond = g.value()
+			g.emit("%s = icmp %s i32 %s, %s", cond, relationMap[q.Op()], a, b)
+		}
+		g.emit("br i1 %s, label %%%s, label %%%s", cond, g.label(target), g.label(index+1))
+	case "read":
+		v := g.value()
+		g.emit("%s = call i32 @read_int()", v)
+		return g.store(v, "i32", q.Arg1())
+	case "write":
+		v, err := g.operand(q.Arg1(), "i32")
+		if err != nil {
+			return err
+		}
+		g.emit("call void @write_int(i32 %s)", v)
+	case "quit":
+		g.emit("ret i32 0")
+	default:
+		return UnknownOpErr
+	}
+	return nil
+}
@@ -0,0 +1,463 @@
+package llvm
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var InvalidIRErr = errors.New("error: invalid llvm ir")
+
+// signature 函数签名
+type signature struct {
+	ret    string
+	params []string
+}
+
+// use 对SSA值的一次使用，函数结束后统一检查，因为定值可能出现在文本中更靠后的基本块
+type use struct {
+	name string
+	typ  string
+	line int
+}
+
+// target 跳转目标
+type target struct {
+	label string
+	line  int
+}
+
+// function 正在校验的函数体
+type function struct {
+	sig        *signature
+	entry      string
+	labels     map[string]bool
+	defs       map[string]string // SSA值到其类型的映射
+	uses       []use
+	targets    []target
+	inBlock    bool // 当前是否处于一个尚未终结的基本块中
+	hasBlock   bool
+	blockStart int
+}
+
+// verifier LLVM IR结构校验器，只支持本包生成的指令子集
+type verifier struct {
+	funcs map[string]*signature
+	fn    *function
+	line  int
+}
+
+// Verify 不依赖LLVM对IR文本做结构校验：
+// 函数先声明后调用且实参与形参类型一致；每个基本块以唯一的终结指令结尾；
+// 标号唯一、跳转目标存在且入口块不能作为跳转目标；SSA值只定值一次、使用的值都有定值且类型一致
+func Verify(ir string) error {
+	v := &verifier{funcs: make(map[string]*signature)}
+	lines := strings.Split(ir, "\n")
+	//第一遍收集所有函数签名
+	for i, raw := range lines {
+		v.line = i + 1
+		line := stripComment(raw)
+		for _, prefix := range []string{"declare ", "define "} {
+			if !strings.HasPrefix(line, prefix) {
+				continue
+			}
+			name, sig, err := v.parseSignature(strings.TrimSuffix(strings.TrimPrefix(line, prefix), "{"))
+			if err != nil {
+				return err
+			}
+			if _, ok := v.funcs[name]; ok {
+				return v.errorf("function @%s redefined", name)
+			}
+			v.funcs[name] = sig
+		}
+	}
+	for i, raw := range lines {
+		v.line = i + 1
+		line := stripComment(raw)
+		if line == "" {
+			continue
+		}
+		if err := v.checkLine(line); err != nil {
+			return err
+		}
+	}
+	if v.fn != nil {
+		return v.errorf("function is not closed")
+	}
+	return nil
+}
+
+func (v *verifier) errorf(format string, a ...any) error {
+	return fmt.Errorf("%w : line %d: %s", InvalidIRErr, v.line, fmt.Sprintf(format, a...))
+}
+
+// stripComment 去掉注释与首尾空白
+func stripComment(line string) string {
+	if i := strings.IndexByte(line, ';'); i >= 0 {
+		line = line[:i]
+	}
+	return strings.TrimSpace(line)
+}
+
+// parseSignature 解析"ret @name(params)"，参数可以只有类型也可以带名字
+func (v *verifier) parseSignature(s string) (string, *signature, error) {
+	s = strings.TrimSpace(s)
+	at := strings.IndexByte(s, '@')
+	open := strings.IndexByte(s, '(')
+	if at <= 0 || open < at || !strings.HasSuffix(s, ")") {
+		return "", nil, v.errorf("bad function signature %q", s)
+	}
+	ret := strings.TrimSpace(s[:at])
+	if !isType(ret) && ret != "void" {
+		return "", nil, v.errorf("bad return type %q", ret)
+	}
+	sig := &signature{ret: ret, params: make([]string, 0)}
+	for _, param := range splitArgs(s[open+1 : len(s)-1]) {
+		typ := strings.Fields(param)[0]
+		if !isType(typ) {
+			return "", nil, v.errorf("bad parameter type %q", typ)
+		}
+		sig.params = append(sig.params, typ)
+	}
+	return s[at+1 : open], sig, nil
+}
+
+// splitArgs 按逗号分割参数列表
+func splitArgs(s string) []string {
+	res := make([]string, 0)
+	for _, arg := range strings.Split(s, ",") {
+		if arg = strings.TrimSpace(arg); arg != "" {
+			res = append(res, arg)
+		}
+	}
+	return res
+}
+
+// isType 判断是否为支持的一等类型
+func isType(typ string) bool {
+	if typ == "ptr" {
+		return true
+	}
+	if !strings.HasPrefix(typ, "i") {
+		return false
+	}
+	bits, err := strconv.Atoi(typ[1:])
+	return err == nil && bits > 0
+}
+
+// checkLine 校验一行
+func (v *verifier) checkLine(line string) error {
+	switch {
+	case strings.HasPrefix(line, "declare "):
+		if v.fn != nil {
+			return v.errorf("declare inside a function")
+		}
+		return nil
+	case strings.HasPrefix(line, "define "):
+		if v.fn != nil {
+			return v.errorf("nested function definition")
+		}
+		if !strings.HasSuffix(line, "{") {
+			return v.errorf("function body must start with {")
+		}
+		name, _, _ := v.parseSignature(strings.TrimSuffix(strings.TrimPrefix(line, "define "), "{"))
+		v.fn = &function{
+			sig:    v.funcs[name],
+			labels: make(map[string]bool),
+			defs:   make(map[string]string),
+		}
+		return nil
+	case line == "}":
+		return v.endFunction()
+	}
+	if v.fn == nil {
+		return v.errorf("instruction outside a function")
+	}
+	if strings.HasSuffix(line, ":") {
+		return v.beginBlock(strings.TrimSuffix(line, ":"))
+	}
+	if !v.fn.inBlock {
+		if v.fn.hasBlock {
+			return v.errorf("instruction after terminator")
+		}
+		//函数的第一条指令前可以省略入口块的标号
+		if err := v.beginBlock(""); err != nil {
+			return err
+		}
+	}
+	return v.checkInstruction(line)
+}
+
+// beginBlock 开始一个新的基本块
+func (v *verifier) beginBlock(label string) error {
+	if v.fn.inBlock {
+		return v.errorf("block %s begins before the previous block is terminated", label)
+	}
+	if label != "" {
+		if v.fn.labels[label] {
+			return v.errorf("label %s redefined", label)
+		}
+		v.fn.labels[label] = true
+	}
+	if !v.fn.hasBlock {
+		v.fn.entry = label
+	}
+	v.fn.inBlock = true
+	v.fn.hasBlock = true
+	v.fn.blockStart = v.line
+	return nil
+}
+
+// endFunction 函数结束时检查跳转目标与值的使用
+func (v *verifier) endFunction() error {
+	fn := v.fn
+	if fn == nil {
+		return v.errorf("unexpected }")
+	}
+	if !fn.hasBlock {
+		return v.errorf("function has no basic block")
+	}
+	if fn.inBlock {
+		return v.errorf("block beginning at line %d is not terminated", fn.blockStart)
+	}
+	for _, t := range fn.targets {
+		if !fn.labels[t.label] {
+			return fmt.Errorf("%w : line %d: undefined label %%%s", InvalidIRErr, t.line, t.label)
+		}
+		if t.label == fn.entry {
+			return fmt.Errorf("%w : line %d: entry block %%%s cannot be a branch target", InvalidIRErr, t.line, t.label)
+		}
+	}
+	for _, u := range fn.uses {
+		typ, ok := fn.defs[u.name]
+		if !ok {
+			return fmt.Errorf("%w : line %d: use of undefined value %s", InvalidIRErr, u.line, u.name)
+		}
+		if typ != u.typ {
+			return fmt.Errorf("%w : line %d: %s has type %s, expected %s", InvalidIRErr, u.line, u.name, typ, u.typ)
+		}
+	}
+	v.fn = nil
+	return nil
+}
+
+// define 记录一个SSA值的定值
+func (v *verifier) define(name, typ string) error {
+	if !strings.HasPrefix(name, "%") || len(name) == 1 {
+		return v.errorf("bad value name %q", name)
+	}
+	if _, ok := v.fn.defs[name]; ok {
+		return v.errorf("value %s redefined", name)
+	}
+	v.fn.defs[name] = typ
+	return nil
+}
+
+// operand 检查类型为typ的操作数，常量直接检查，SSA值推迟到函数结束时检查
+func (v *verifier) operand(typ, val string) error {
+	if !isType(typ) {
+		return v.errorf("bad type %q", typ)
+	}
+	if strings.HasPrefix(val, "%") {
+		v.fn.uses = append(v.fn.uses, use{name: val, typ: typ, line: v.line})
+		return nil
+	}
+	if typ == "ptr" {
+		if val != "null" {
+			return v.errorf("bad pointer constant %q", val)
+		}
+		return nil
+	}
+	if typ == "i1" && (val == "true" || val == "false") {
+		return nil
+	}
+	if _, err := strconv.ParseInt(val, 10, 64); err != nil {
+		return v.errorf("bad %s constant %q", typ, val)
+	}
+	return nil
+}
+
+// typedOperand 检查"type value"形式的操作数
+func (v *verifier) typedOperand(s, want string) error {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return v.errorf("bad operand %q", s)
+	}
+	if want != "" && fields[0] != want {
+		return v.errorf("operand %q should have type %s", s, want)
+	}
+	return v.operand(fields[0], fields[1])
+}
+
+// branchTarget 检查"label %name"形式的跳转目标
+func (v *verifier) branchTarget(s string) error {
+	fields := strings.Fields(s)
+	if len(fields) != 2 || fields[0] != "label" || !strings.HasPrefix(fields[1], "%") {
+		return v.errorf("bad branch target %q", s)
+	}
+	v.fn.targets = append(v.fn.targets, target{label: fields[1][1:], line: v.line})
+	return nil
+}
+
+// checkInstruction 校验一条指令
+func (v *verifier) checkInstruction(line string) error {
+	result := ""
+	if strings.HasPrefix(line, "%") {
+		eq := strings.Index(line, " = ")
+		if eq < 0 {
+			return v.errorf("bad instruction %q", line)
+		}
+		result, line = line[:eq], line[eq+3:]
+	}
+	op, rest, _ := strings.Cut(line, " ")
+	args := splitArgs(rest)
+	switch op {
+	case "alloca":
+		if len(args) != 1 || !isType(args[0]) {
+			return v.errorf("bad alloca %q", line)
+		}
+		return v.defineResult(result, "ptr")
+	case "load":
+		if len(args) != 2 || !isType(args[0]) {
+			return v.errorf("bad load %q", line)
+		}
+		if err := v.typedOperand(args[1], "ptr"); err != nil {
+			return err
+		}
+		return v.defineResult(result, args[0])
+	case "store":
+		if len(args) != 2 {
+			return v.errorf("bad store %q", line)
+		}
+		if err := v.typedOperand(args[0], ""); err != nil {
+			return err
+		}
+		if err := v.typedOperand(args[1], "ptr"); err != nil {
+			return err
+		}
+	case "add", "sub", "mul", "sdiv", "srem", "and", "or", "xor":
+		fields := strings.Fields(rest)
+		if len(args) != 2 || len(fields) != 3 {
+			return v.errorf("bad %s %q", op, line)
+		}
+		typ := fields[0]
+		if err := v.operand(typ, strings.TrimSuffix(fields[1], ",")); err != nil {
+			return err
+		}
+		if err := v.operand(typ, fields[2]); err != nil {
+			return err
+		}
+		return v.defineResult(result, typ)
+	case "icmp":
+		fields := strings.Fields(rest)
+		if len(args) != 2 || len(fields) != 4 {
+			return v.errorf("bad icmp %q", line)
+		}
+		switch fields[0] {
+		case "eq", "ne", "sgt", "sge", "slt", "sle", "ugt", "uge", "ult", "ule":
+		default:
+			return v.errorf("bad icmp predicate %q", fields[0])
+		}
+		if err := v.operand(fields[1], strings.TrimSuffix(fields[2], ",")); err != nil {
+			return err
+		}
+		if err := v.operand(fields[1], fields[3]); err != nil {
+			return err
+		}
+		return v.defineResult(result, "i1")
+	case "zext", "sext", "trunc":
+		fields := strings.Fields(rest)
+		if len(fields) != 4 || fields[2] != "to" || !isType(fields[3]) {
+			return v.errorf("bad %s %q", op, line)
+		}
+		if err := v.operand(fields[0], fields[1]); err != nil {
+			return err
+		}
+		return v.defineResult(result, fields[3])
+	case "call":
+		return v.checkCall(result, rest)
+	case "br":
+		switch len(args) {
+		case 1:
+			if err := v.branchTarget(args[0]); err != nil {
+				return err
+			}
+		case 3:
+			if err := v.typedOperand(args[0], "i1"); err != nil {
+				return err
+			}
+			if err := v.branchTarget(args[1]); err != nil {
+				return err
+			}
+			if err := v.branchTarget(args[2]); err != nil {
+				return err
+			}
+		default:
+			return v.errorf("bad br %q", line)
+		}
+		v.fn.inBlock = false
+	case "ret":
+		if rest == "void" {
+			if v.fn.sig.ret != "void" {
+				return v.errorf("ret void in a function returning %s", v.fn.sig.ret)
+			}
+		} else if err := v.typedOperand(rest, v.fn.sig.ret); err != nil {
+			return err
+		}
+		v.fn.inBlock = false
+	case "unreachable":
+		v.fn.inBlock = false
+	default:
+		return v.errorf("unknown instruction %q", op)
+	}
+	if result != "" {
+		return v.errorf("%s does not produce a value", op)
+	}
+	return nil
+}
+
+// defineResult 定义有返回值的指令的结果
+func (v *verifier) defineResult(result, typ string) error {
+	if result == "" {
+		return v.errorf("result of the instruction is not assigned")
+	}
+	return v.define(result, typ)
+}
+
+// checkCall 校验"ret @name(args)"形式的调用
+func (v *verifier) checkCall(result, s string) error {
+	at := strings.IndexByte(s, '@')
+	open := strings.IndexByte(s, '(')
+	if at <= 0 || open < at || !strings.HasSuffix(s, ")") {
+		return v.errorf("bad call %q", s)
+	}
+	ret := strings.TrimSpace(s[:at])
+	name := s[at+1 : open]
+	sig, ok := v.funcs[name]
+	if !ok {
+		return v.errorf("call to undeclared function @%s", name)
+	}
+	if ret != sig.ret {
+		return v.errorf("@%s returns %s, not %s", name, sig.ret, ret)
+	}
+	args := splitArgs(s[open+1 : len(s)-1])
+	if len(args) != len(sig.params) {
+		return v.errorf("@%s expects %d arguments, got %d", name, len(sig.params), len(args))
+	}
+	for i, arg := range args {
+		if err := v.typedOperand(arg, sig.params[i]); err != nil {
+			return err
+		}
+	}
+	if ret == "void" {
+		if result != "" {
+			return v.errorf("void call result cannot be assigned")
+		}
+		return nil
+	}
+	if result == "" {
+		return nil
+	}
+	return v.define(result, ret)
+}
@@ -0,0 +1,103 @@
+package llvm
+
+import (
+	"chap4/compiler"
+	"chap4/internal/corpus"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestVerifyCorpus 每个样例程序生成的IR都应通过Verify；有llc时再交给llc编译，
+// LLVM 14的llc需要-opaque-pointers才能读取ptr
+func TestVerifyCorpus(t *testing.T) {
+	programs, err := corpus.Programs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	llc, _ := exec.LookPath("llc")
+	for _, p := range programs {
+		p := p
+		t.Run(p.Name, func(t *testing.T) {
+			result, diagnostics := compiler.CompileFile(p.Path, compiler.Options{})
+			if compiler.HasErrors(diagnostics) {
+				t.Skipf("%s does not compile: %v", p.Path, diagnostics[0])
+			}
+			ir, err := NewGenerator(result.Semantic).Generate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := Verify(ir); err != nil {
+				t.Fatalf("Verify: %v\n%s", err, ir)
+			}
+			if llc == "" {
+				return
+			}
+			file := filepath.Join(t.TempDir(), "target.ll")
+			if err := os.WriteFile(file, []byte(ir), 0666); err != nil {
+				t.Fatal(err)
+			}
+			out, err := exec.Command(llc, "-filetype=obj", "-o", os.DevNull, file).CombinedOutput()
+			if err != nil {
+				out, err = exec.Command(llc, "-opaque-pointers", "-filetype=obj", "-o", os.DevNull, file).CombinedOutput()
+			}
+			if err != nil {
+				t.Errorf("llc: %v\n%s", err, out)
+			}
+		})
+	}
+}
+
+// validIR 一个合法的函数，TestVerifyInvalid在它的基础上逐处破坏
+const validIR = `declare void @write_int(i32)
+
+define i32 @main() {
+entry:
+  %x.addr = alloca i32
+  store i32 1, ptr %x.addr
+  br label %loop
+loop:
+  %v1 = load i32, ptr %x.addr
+  %v2 = add i32 %v1, 1
+  %v3 = icmp slt i32 %v2, 10
+  call void @write_int(i32 %v2)
+  br i1 %v3, label %loop, label %done
+done:
+  ret i32 0
+}
+`
+
+func TestVerifyInvalid(t *testing.T) {
+	if err := Verify(validIR); err != nil {
+		t.Fatalf("Verify(validIR) = %v", err)
+	}
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{"undefined value", "add i32 %v1, 1", "add i32 %v9, 1", "use of undefined value %v9"},
+		{"missing terminator", "  br label %loop\n", "", "begins before the previous block is terminated"},
+		{"missing ret", "  ret i32 0\n", "", "block beginning at line 14 is not terminated"},
+		{"type mismatch", "icmp slt i32 %v2, 10", "icmp slt i1 %v2, 10", "%v2 has type i32, expected i1"},
+		{"branch on int", "br i1 %v3", "br i32 %v3", "should have type i1"},
+		{"undefined label", "label %done", "label %exit", "undefined label %exit"},
+		{"entry as target", "br label %loop\nloop:", "br label %entry\nloop:", "entry block %entry cannot be a branch target"},
+		{"value redefined", "%v2 = add", "%v1 = add", "value %v1 redefined"},
+		{"undeclared function", "@write_int(i32 %v2)", "@print(i32 %v2)", "call to undeclared function @print"},
+		{"wrong return type", "ret i32 0", "ret i1 false", "should have type i32"},
+	}
+	for _, test := range tests {
+		ir := strings.Replace(validIR, test.old, test.new, 1)
+		if ir == validIR {
+			t.Fatalf("%s: %q not found in validIR", test.name, test.old)
+		}
+		err := Verify(ir)
+		if !errors.Is(err, InvalidIRErr) || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: Verify = %v, want an error containing %q", test.name, err, test.want)
+		}
+	}
+}
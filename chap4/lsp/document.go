@@ -0,0 +1,168 @@
+package lsp
+
+import (
+	"chap4/compiler"
+	"chap4/lexer"
+	"strings"
+	"unicode/utf8"
+)
+
+// declaration 一个变量的声明
+type declaration struct {
+	token *lexer.Token
+	typ   string
+}
+
+// document 一个打开的文档及其分析结果
+type document struct {
+	uri          string
+	lines        []string
+	tokens       []*lexer.Token
+	diagnostics  []compiler.Diagnostic
+	declarations []declaration
+	declared     map[string]declaration
+	symbols      map[string]*lexer.Symbol
+}
+
+// newDocument 编译文档并记录分析结果
+func newDocument(uri, text string) *document {
+	d := &document{
+		uri:      uri,
+		lines:    strings.Split(text, "\n"),
+		declared: make(map[string]declaration),
+	}
+	result, diagnostics := compiler.Compile([]byte(text), compiler.Options{})
+	d.tokens = result.Tokens
+	d.diagnostics = diagnostics
+	d.symbols = result.Symbols
+	for _, decl := range scanDeclarations(d.tokens) {
+		if _, ok := d.declared[decl.token.Value]; ok {
+			continue
+		}
+		d.declared[decl.token.Value] = decl
+		d.declarations = append(d.declarations, decl)
+	}
+	return d
+}
+
+// scanDeclarations 从单词序列中找出程序开头的声明
+//
+// 语法分析出错时没有语法树，所以直接扫描单词，使正在编辑的程序也能得到声明。
+func scanDeclarations(tokens []*lexer.Token) []declaration {
+	decls := make([]declaration, 0)
+	if len(tokens) == 0 || tokens[0].Value != "{" {
+		return decls
+	}
+	for i := 1; i < len(tokens); {
+		typ := tokens[i].Value
+		if tokens[i].Class != lexer.Keyword || (typ != "int" && typ != "bool") {
+			break
+		}
+		for i++; i < len(tokens) && tokens[i].Value != ";"; i++ {
+			if tokens[i].Class == lexer.Identifier {
+				decls = append(decls, declaration{token: tokens[i], typ: typ})
+			}
+		}
+		i++
+	}
+	return decls
+}
+
+// typeOf 变量的类型，优先使用语义分析得到的符号表
+func (d *document) typeOf(name string) string {
+	if symbol, ok := d.symbols[name]; ok && symbol.Type != "" {
+		return symbol.Type
+	}
+	return d.declared[name].typ
+}
+
+// identifierAt 返回光标所在的标识符，光标位于标识符末尾时也算在内
+func (d *document) identifierAt(pos Position) *lexer.Token {
+	line, column := d.fromLSP(pos)
+	for _, token := range d.tokens {
+		if token.Class != lexer.Identifier || token.Pos.Line != line {
+			continue
+		}
+		if column >= token.Pos.Column && column <= token.Pos.Column+len(token.Value) {
+			return token
+		}
+	}
+	return nil
+}
+
+// references 返回所有与name同名的标识符
+func (d *document) references(name string) []*lexer.Token {
+	res := make([]*lexer.Token, 0)
+	for _, token := range d.tokens {
+		if token.Class == lexer.Identifier && token.Value == name {
+			res = append(res, token)
+		}
+	}
+	return res
+}
+
+// tokenRange 单词在文档中的范围
+func (d *document) tokenRange(token *lexer.Token) Range {
+	start := d.toLSP(token.Pos)
+	end := d.toLSP(lexer.Position{Line: token.Pos.Line, Column: token.Pos.Column + len(token.Value)})
+	return Range{Start: start, End: end}
+}
+
+// diagnosticRange 诊断的范围，覆盖该位置上的单词，没有单词时覆盖一个字符
+func (d *document) diagnosticRange(pos lexer.Position) Range {
+	if !pos.IsValid() {
+		return Range{}
+	}
+	for _, token := range d.tokens {
+		if token.Pos == pos {
+			return d.tokenRange(token)
+		}
+	}
+	start := d.toLSP(pos)
+	return Range{Start: start, End: Position{Line: start.Line, Character: start.Character + 1}}
+}
+
+// toLSP 将从1开始、以字节计的行列换算为LSP的位置
+func (d *document) toLSP(pos lexer.Position) Position {
+	line := pos.Line - 1
+	if line < 0 || line >= len(d.lines) {
+		return Position{Line: line}
+	}
+	text := d.lines[line]
+	n := pos.Column - 1
+	if n > len(text) {
+		n = len(text)
+	}
+	return Position{Line: line, Character: utf16Len(text[:n])}
+}
+
+// fromLSP 将LSP的位置换算为从1开始、以字节计的行列
+func (d *document) fromLSP(pos Position) (int, int) {
+	if pos.Line < 0 || pos.Line >= len(d.lines) {
+		return pos.Line + 1, pos.Character + 1
+	}
+	text := d.lines[pos.Line]
+	units := 0
+	for i, r := range text {
+		if units >= pos.Character {
+			return pos.Line + 1, i + 1
+		}
+		units += utf16RuneLen(r)
+	}
+	return pos.Line + 1, len(text) + 1
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16RuneLen(r)
+	}
+	return n
+}
+
+func utf16RuneLen(r rune) int {
+	if r >= 0x10000 && r <= utf8.MaxRune {
+		return 2
+	}
+	return 1
+}
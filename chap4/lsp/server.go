@@ -0,0 +1,310 @@
+// Package lsp 基于词法、语法与语义分析的语言服务器，通过标准输入输出与编辑器通信
+//
+// 支持的功能：编辑时发布诊断信息、悬停显示变量的类型、跳转到定义、查找引用、
+// 列出文档中声明的变量，以及关键字与变量名的补全。文档采用全量同步。
+//
+// 在VS Code中可以用任意通用的LSP客户端扩展，将服务器命令配置为`cpc lsp`。
+package lsp
+
+import (
+	"bufio"
+	"chap4/compiler"
+	"chap4/lexer"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Server 语言服务器
+type Server struct {
+	reader   *bufio.Reader
+	out      io.Writer
+	docs     map[string]*document
+	shutdown bool
+}
+
+// NewServer 创建一个从in读取请求、向out写出响应的语言服务器
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		reader: bufio.NewReader(in),
+		out:    out,
+		docs:   make(map[string]*document),
+	}
+}
+
+// Run 处理消息直到收到exit通知或输入结束
+func (s *Server) Run() error {
+	for {
+		body, err := readMessage(s.reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			if err := s.replyError(nil, codeParseError, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return ExitWithoutShutdownErr
+			}
+			return nil
+		}
+		if err := s.handle(&msg); err != nil {
+			return err
+		}
+	}
+}
+
+// handler 处理一个请求，返回响应的结果
+type handler func(s *Server, params json.RawMessage) (interface{}, error)
+
+var handlers = map[string]handler{
+	"initialize":                  (*Server).initialize,
+	"shutdown":                    (*Server).shutdownRequest,
+	"textDocument/hover":          (*Server).hover,
+	"textDocument/definition":     (*Server).definition,
+	"textDocument/references":     (*Server).references,
+	"textDocument/documentSymbol": (*Server).documentSymbol,
+	"textDocument/completion":     (*Server).completion,
+}
+
+// notificationHandler 处理一个通知
+type notificationHandler func(s *Server, params json.RawMessage) error
+
+var notificationHandlers = map[string]notificationHandler{
+	"textDocument/didOpen":   (*Server).didOpen,
+	"textDocument/didChange": (*Server).didChange,
+	"textDocument/didClose":  (*Server).didClose,
+}
+
+// paramsError 请求参数无法解析
+type paramsError struct {
+	err error
+}
+
+func (e *paramsError) Error() string {
+	return e.err.Error()
+}
+
+func decode(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &paramsError{err}
+	}
+	return nil
+}
+
+func (s *Server) handle(msg *message) error {
+	if msg.ID == nil {
+		//未知的通知直接忽略，参数错误的通知也没有办法回复
+		if h, ok := notificationHandlers[msg.Method]; ok {
+			if err := h(s, msg.Params); err != nil {
+				if _, ok := err.(*paramsError); !ok {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	h, ok := handlers[msg.Method]
+	if !ok {
+		return s.replyError(msg.ID, codeMethodNotFound, fmt.Sprintf("method not found: %s", msg.Method))
+	}
+	result, err := h(s, msg.Params)
+	if err != nil {
+		return s.replyError(msg.ID, codeInvalidParams, err.Error())
+	}
+	return writeMessage(s.out, response{JSONRPC: "2.0", ID: msg.ID, Result: result})
+}
+
+func (s *Server) replyError(id json.RawMessage, code int, msg string) error {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return writeMessage(s.out, errorResponse{JSONRPC: "2.0", ID: id, Error: responseError{Code: code, Message: msg}})
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	return writeMessage(s.out, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) initialize(json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync":       1,
+			"hoverProvider":          true,
+			"definitionProvider":     true,
+			"referencesProvider":     true,
+			"documentSymbolProvider": true,
+			"completionProvider":     map[string]interface{}{},
+		},
+		"serverInfo": map[string]string{"name": "cpc"},
+	}, nil
+}
+
+func (s *Server) shutdownRequest(json.RawMessage) (interface{}, error) {
+	s.shutdown = true
+	return nil, nil
+}
+
+func (s *Server) didOpen(params json.RawMessage) error {
+	var p DidOpenTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return err
+	}
+	return s.update(p.TextDocument.URI, p.TextDocument.Text)
+}
+
+func (s *Server) didChange(params json.RawMessage) error {
+	var p DidChangeTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return err
+	}
+	if len(p.ContentChanges) == 0 {
+		return nil
+	}
+	return s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+}
+
+func (s *Server) didClose(params json.RawMessage) error {
+	var p DidCloseTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return err
+	}
+	delete(s.docs, p.TextDocument.URI)
+	//关闭后清除编辑器中的诊断信息
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+}
+
+// update 重新分析文档并发布诊断信息
+func (s *Server) update(uri, text string) error {
+	d := newDocument(uri, text)
+	s.docs[uri] = d
+	diagnostics := make([]Diagnostic, 0, len(d.diagnostics))
+	for _, diag := range d.diagnostics {
+		severity := SeverityError
+		if diag.Severity == compiler.SeverityWarning {
+			severity = SeverityWarning
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    d.diagnosticRange(diag.Pos),
+			Severity: severity,
+			Code:     diag.Code,
+			Source:   "cpc",
+			Message:  diag.Message,
+		})
+	}
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
+
+// lookup 找到请求所指的文档与光标处的标识符
+func (s *Server) lookup(params TextDocumentPositionParams) (*document, *lexer.Token) {
+	d, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil, nil
+	}
+	return d, d.identifierAt(params.Position)
+}
+
+func (s *Server) hover(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	d, token := s.lookup(p)
+	if token == nil {
+		return nil, nil
+	}
+	typ := d.typeOf(token.Value)
+	if typ == "" {
+		return nil, nil
+	}
+	return Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: fmt.Sprintf("```\n%s %s\n```", typ, token.Value)},
+		Range:    d.tokenRange(token),
+	}, nil
+}
+
+func (s *Server) definition(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	d, token := s.lookup(p)
+	if token == nil {
+		return nil, nil
+	}
+	decl, ok := d.declared[token.Value]
+	if !ok {
+		return nil, nil
+	}
+	return Location{URI: d.uri, Range: d.tokenRange(decl.token)}, nil
+}
+
+func (s *Server) references(params json.RawMessage) (interface{}, error) {
+	var p ReferenceParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	d, token := s.lookup(p.TextDocumentPositionParams)
+	if token == nil {
+		return nil, nil
+	}
+	decl, declared := d.declared[token.Value]
+	locations := make([]Location, 0)
+	for _, ref := range d.references(token.Value) {
+		if declared && ref == decl.token && !p.Context.IncludeDeclaration {
+			continue
+		}
+		locations = append(locations, Location{URI: d.uri, Range: d.tokenRange(ref)})
+	}
+	return locations, nil
+}
+
+func (s *Server) documentSymbol(params json.RawMessage) (interface{}, error) {
+	var p DocumentSymbolParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	d, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return nil, nil
+	}
+	symbols := make([]DocumentSymbol, 0, len(d.declarations))
+	for _, decl := range d.declarations {
+		r := d.tokenRange(decl.token)
+		symbols = append(symbols, DocumentSymbol{
+			Name:           decl.token.Value,
+			Detail:         decl.typ,
+			Kind:           SymbolKindVariable,
+			Range:          r,
+			SelectionRange: r,
+		})
+	}
+	return symbols, nil
+}
+
+func (s *Server) completion(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	items := make([]CompletionItem, 0)
+	keywords := append(lexer.Keywords(), "true", "false")
+	sort.Strings(keywords)
+	for _, keyword := range keywords {
+		items = append(items, CompletionItem{Label: keyword, Kind: CompletionKindKeyword})
+	}
+	if d, ok := s.docs[p.TextDocument.URI]; ok {
+		for _, decl := range d.declarations {
+			items = append(items, CompletionItem{Label: decl.token.Value, Kind: CompletionKindVariable, Detail: decl.typ})
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,214 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// client 通过管道与Server通信的测试客户端
+type client struct {
+	t      *testing.T
+	in     *io.PipeWriter
+	out    *bufio.Reader
+	done   chan error
+	nextID int
+}
+
+func newClient(t *testing.T) *client {
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+	c := &client{t: t, in: inWriter, out: bufio.NewReader(outReader), done: make(chan error, 1)}
+	go func() {
+		err := NewServer(inReader, outWriter).Run()
+		outWriter.Close()
+		c.done <- err
+	}()
+	return c
+}
+
+// send 发送一条消息，id为nil时是通知
+func (c *client) send(id interface{}, method string, params interface{}) {
+	c.t.Helper()
+	msg := map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+	if id != nil {
+		msg["id"] = id
+	}
+	if err := writeMessage(c.in, msg); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// receive 读取服务器发出的下一条消息
+func (c *client) receive() map[string]json.RawMessage {
+	c.t.Helper()
+	body, err := readMessage(c.out)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	var msg map[string]json.RawMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		c.t.Fatal(err)
+	}
+	return msg
+}
+
+// request 发送请求，将响应的result解析到result中
+func (c *client) request(method string, params, result interface{}) {
+	c.t.Helper()
+	c.nextID++
+	c.send(c.nextID, method, params)
+	msg := c.receive()
+	if id := string(msg["id"]); id != strconv.Itoa(c.nextID) {
+		c.t.Fatalf("%s: response id %s, want %d", method, id, c.nextID)
+	}
+	if e, ok := msg["error"]; ok {
+		c.t.Fatalf("%s: %s", method, e)
+	}
+	if err := json.Unmarshal(msg["result"], result); err != nil {
+		c.t.Fatalf("%s: %v in %s", method, err, msg["result"])
+	}
+}
+
+// diagnostics 读取一条publishDiagnostics通知
+func (c *client) diagnostics() PublishDiagnosticsParams {
+	c.t.Helper()
+	msg := c.receive()
+	var params PublishDiagnosticsParams
+	if method := string(msg["method"]); method != `"textDocument/publishDiagnostics"` {
+		c.t.Fatalf("method %s, want textDocument/publishDiagnostics", method)
+	}
+	if err := json.Unmarshal(msg["params"], &params); err != nil {
+		c.t.Fatal(err)
+	}
+	return params
+}
+
+func at(line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: Position{Line: line, Character: character}}
+}
+
+// span 第line行从character开始、长为n的范围
+func span(line, character, n int) Range {
+	return Range{Start: Position{Line: line, Character: character}, End: Position{Line: line, Character: character + n}}
+}
+
+const uri = "file:///test.txt"
+
+func TestSession(t *testing.T) {
+	c := newClient(t)
+	var initialize struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+	}
+	c.request("initialize", map[string]interface{}{}, &initialize)
+	for _, capability := range []string{"hoverProvider", "definitionProvider", "referencesProvider"} {
+		if initialize.Capabilities[capability] != true {
+			t.Errorf("capability %s = %v", capability, initialize.Capabilities[capability])
+		}
+	}
+
+	text := "{ int a;\n  a = 1;\n  write a;\n}"
+	c.send(nil, "textDocument/didOpen", DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, Version: 1, Text: text}})
+	if d := c.diagnostics(); d.URI != uri || len(d.Diagnostics) != 0 {
+		t.Errorf("didOpen: diagnostics %+v", d)
+	}
+
+	var hover Hover
+	c.request("textDocument/hover", at(1, 2), &hover)
+	if hover.Contents.Value != "```\nint a\n```" || hover.Range != span(1, 2, 1) {
+		t.Errorf("hover: %+v", hover)
+	}
+
+	var definition Location
+	c.request("textDocument/definition", at(2, 8), &definition)
+	if definition != (Location{URI: uri, Range: span(0, 6, 1)}) {
+		t.Errorf("definition: %+v", definition)
+	}
+
+	var references []Location
+	params := ReferenceParams{TextDocumentPositionParams: at(1, 2)}
+	params.Context.IncludeDeclaration = true
+	c.request("textDocument/references", params, &references)
+	want := []Location{{uri, span(0, 6, 1)}, {uri, span(1, 2, 1)}, {uri, span(2, 8, 1)}}
+	if !reflect.DeepEqual(references, want) {
+		t.Errorf("references: %+v, want %+v", references, want)
+	}
+	params.Context.IncludeDeclaration = false
+	c.request("textDocument/references", params, &references)
+	if !reflect.DeepEqual(references, want[1:]) {
+		t.Errorf("references without declaration: %+v, want %+v", references, want[1:])
+	}
+
+	//修改后出现语法错误，诊断信息指向出错的单词
+	change := DidChangeTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}}
+	change.ContentChanges = append(change.ContentChanges, struct {
+		Text string `json:"text"`
+	}{"{ int a;\n  a = ;\n}"})
+	c.send(nil, "textDocument/didChange", change)
+	d := c.diagnostics()
+	if len(d.Diagnostics) == 0 || d.Diagnostics[0].Code != "E0201" || d.Diagnostics[0].Severity != SeverityError || d.Diagnostics[0].Range.Start.Line != 1 {
+		t.Errorf("didChange: diagnostics %+v", d)
+	}
+	//悬停在空白处没有结果
+	var empty *Hover
+	c.request("textDocument/hover", at(1, 0), &empty)
+	if empty != nil {
+		t.Errorf("hover on whitespace: %+v", empty)
+	}
+
+	var result interface{}
+	c.request("shutdown", nil, &result)
+	if result != nil {
+		t.Errorf("shutdown: %v", result)
+	}
+	c.send(nil, "exit", nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("Run: %v", err)
+	}
+}
+
+// TestErrors 未知方法与无法解析的消息回复错误，不结束会话；没有shutdown就exit时Run返回错误
+func TestErrors(t *testing.T) {
+	c := newClient(t)
+	c.send(1, "textDocument/unknown", nil)
+	if msg := c.receive(); !strings.Contains(string(msg["error"]), "-32601") {
+		t.Errorf("unknown method: %v", msg)
+	}
+	if _, err := io.WriteString(c.in, "Content-Length: 1\r\n\r\n{"); err != nil {
+		t.Fatal(err)
+	}
+	if msg := c.receive(); !strings.Contains(string(msg["error"]), "-32700") || string(msg["id"]) != "null" {
+		t.Errorf("parse error: %v", msg)
+	}
+	c.send(nil, "exit", nil)
+	if err := <-c.done; !errors.Is(err, ExitWithoutShutdownErr) {
+		t.Errorf("exit without shutdown: %v", err)
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		input string
+		body  string
+		err   error
+	}{
+		{"Content-Length: 2\r\n\r\n{}", "{}", nil},
+		{"Content-Type: application/vscode-jsonrpc; charset=utf-8\r\nContent-Length: 2\r\n\r\n{}", "{}", nil},
+		{"", "", io.EOF},
+		{"Content-Length: x\r\n\r\n", "", HeaderErr},
+		{"Content-Length: -1\r\n\r\n", "", HeaderErr},
+		{"Content-Length: 1099511627776\r\n\r\n", "", HeaderErr},
+		{"Content-Length: 10\r\n\r\n{}", "", io.ErrUnexpectedEOF},
+	}
+	for _, test := range tests {
+		body, err := readMessage(bufio.NewReader(strings.NewReader(test.input)))
+		if string(body) != test.body || !errors.Is(err, test.err) {
+			t.Errorf("readMessage(%q) = %q, %v, want %q, %v", test.input, body, err, test.body, test.err)
+		}
+	}
+}
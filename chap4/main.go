@@ -2,33 +2,131 @@
 package main
 
 import (
-	"chap4/analyzer"
-	"chap4/lexer"
-	"chap4/semantic"
+	"chap4/assembly"
+	"chap4/bytecode"
+	"chap4/compiler"
+	"chap4/csource"
+	"chap4/llvm"
+	"chap4/wat"
+	"fmt"
+	"os"
+	"path/filepath"
 )
 
+// outDir 各后端生成的文件所在的目录，不纳入版本管理
+const outDir = "out"
+
 func main() {
 	source := "text/source.txt"
 	target := "text/target.txt"
 	Run(source, target)
+	if err := os.MkdirAll(outDir, 0777); err != nil {
+		fmt.Println(err)
+		return
+	}
+	RunAssembly(source, filepath.Join(outDir, "target.s"))
+	RunBytecode(source, filepath.Join(outDir, "target.qbc"))
+	RunC(source, filepath.Join(outDir, "target.c"))
+	RunWat(source, filepath.Join(outDir, "target.wat"))
+	RunLLVM(source, filepath.Join(outDir, "target.ll"))
 }
 func Run(readFile, writeFile string) {
-	if err := lexer.InitLexer(); err != nil {
+	result, err := compile(readFile)
+	if err != nil {
+		return
+	}
+	if err := result.Semantic.PrintToFile(writeFile); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// compile 依次进行词法分析、语法分析和语义分析，并打印诊断信息
+func compile(readFile string) (*compiler.Result, error) {
+	result, diagnostics := compiler.CompileFile(readFile, compiler.Options{})
+	for _, d := range diagnostics {
+		fmt.Println(d)
+	}
+	if compiler.HasErrors(diagnostics) {
+		return nil, fmt.Errorf("%s: compilation failed", readFile)
+	}
+	return result, nil
+}
+
+func RunAssembly(readFile, writeFile string) {
+	result, err := compile(readFile)
+	if err != nil {
+		return
+	}
+	generator := assembly.NewGenerator(result.Semantic)
+	generator.SetRegisterCount(assembly.MaxRegisters)
+	if err := generator.PrintToFile(writeFile); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Print(generator.Allocation())
+}
+
+// RunBytecode 将程序编译为字节码文件，再从文件中加载并打印反汇编的结果；
+// 在虚拟机上执行用cpc run -engine vm
+func RunBytecode(readFile, writeFile string) {
+	result, err := compile(readFile)
+	if err != nil {
+		return
+	}
+	program, err := bytecode.Compile(result.Tree)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := program.WriteFile(writeFile); err != nil {
+		fmt.Println(err)
+		return
+	}
+	program, err = bytecode.ReadFile(writeFile)
+	if err != nil {
+		fmt.Println(err)
 		return
 	}
+	fmt.Print(bytecode.Disassemble(program))
+}
 
-	lexer := lexer.NewLexer()
-	if err := lexer.ReadFromFile(readFile); err != nil {
+// RunC 将程序翻译为C源程序
+func RunC(readFile, writeFile string) {
+	result, err := compile(readFile)
+	if err != nil {
 		return
 	}
-	lexer.Run()
-	//lexer.Print()
-	analyzer.InitAnalyzer()
-	analyzer := analyzer.NewAnalyzer(lexer.Target())
-	analyzer.Analyse()
-	//analyzer.PrintTree()
-	//analyzer.PrintToFile(writeFile)
-	semanticAnalyzer := semantic.NewSemanticAnalyzer(analyzer.GetRoot())
-	semanticAnalyzer.Run()
-	semanticAnalyzer.PrintToFile(writeFile)
+	generator := csource.NewGenerator(result.Semantic)
+	if err := generator.PrintToFile(writeFile); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// RunWat 将程序翻译为WebAssembly文本格式模块
+func RunWat(readFile, writeFile string) {
+	result, err := compile(readFile)
+	if err != nil {
+		return
+	}
+	generator := wat.NewGenerator(result.Semantic)
+	if err := generator.PrintToFile(writeFile); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// RunLLVM 将程序翻译为LLVM IR，运行时函数写入同目录下的runtime.c
+func RunLLVM(readFile, writeFile string) {
+	result, err := compile(readFile)
+	if err != nil {
+		return
+	}
+	generator := llvm.NewGenerator(result.Semantic)
+	if err := generator.PrintToFile(writeFile); err != nil {
+		fmt.Println(err)
+		return
+	}
+	runtime := filepath.Join(filepath.Dir(writeFile), "runtime.c")
+	if err := os.WriteFile(runtime, []byte(llvm.Runtime), 0666); err != nil {
+		fmt.Println(err)
+	}
 }
@@ -0,0 +1,436 @@
+// Package repl 交互式解释器，声明的变量及其值在整个会话中保留
+//
+// 每次输入都与会话中已有的声明拼成一个完整的程序再编译执行：
+//
+//	{ int a; bool b;      第1行为会话中的声明
+//	<输入>                第2行开始为本次输入
+//	}
+//
+// 以;或}结尾的输入作为声明和语句执行，其它输入作为表达式求值，依次尝试int与bool：
+// 输入前加上"it = "（或"it := "）、后加上";"作为赋值语句编译，报告错误与显示单词时去掉这些添加的部分。
+// 输入中的{多于}，或者以then、else、do结尾时继续读入下一行。
+package repl
+
+import (
+	"bufio"
+	"chap4/analyzer"
+	"chap4/compiler"
+	"chap4/interpreter"
+	"chap4/lexer"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	prompt         = "> "
+	continuePrompt = "... "
+)
+
+// REPL 交互式解释器
+type REPL struct {
+	reader *bufio.Reader
+	out    io.Writer
+	types  map[string]string // 会话中声明的变量及其类型
+	order  []string          // 变量的声明顺序
+	values map[string]int    // 变量当前的值
+	last   *compiler.Result  // 最近一次编译的结果，供:tokens、:tree、:ir使用
+	prefix int               // 最近一次编译时输入第一行之前添加的字符数，表达式为"it = "的长度，语句为0
+	end    lexer.Position    // 表达式之后添加的";"在输入中的位置，语句为无效位置
+	prompt bool
+}
+
+// New 创建一个交互式解释器，程序中的read也从in中读取
+func New(in io.Reader, out io.Writer) *REPL {
+	r := &REPL{
+		reader: bufio.NewReader(in),
+		out:    out,
+		prompt: true,
+	}
+	r.Reset()
+	return r
+}
+
+// SetPrompt 设置是否打印提示符
+func (r *REPL) SetPrompt(prompt bool) {
+	r.prompt = prompt
+}
+
+// Reset 清空会话
+func (r *REPL) Reset() {
+	r.types = make(map[string]string)
+	r.order = make([]string, 0)
+	r.values = make(map[string]int)
+	r.last = nil
+	r.prefix, r.end = 0, lexer.Position{}
+}
+
+// Run 逐行读取输入并执行，直到输入结束或:quit
+func (r *REPL) Run() error {
+	var buf strings.Builder
+	for {
+		if r.prompt {
+			if buf.Len() == 0 {
+				fmt.Fprint(r.out, prompt)
+			} else {
+				fmt.Fprint(r.out, continuePrompt)
+			}
+		}
+		line, err := r.reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if line == "" && err == io.EOF {
+			if buf.Len() > 0 {
+				r.Eval(buf.String())
+			}
+			return nil
+		}
+		if buf.Len() == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if quit := r.meta(strings.TrimSpace(line)); quit {
+				return nil
+			}
+			continue
+		}
+		buf.WriteString(line)
+		if incomplete(buf.String()) {
+			continue
+		}
+		r.Eval(buf.String())
+		buf.Reset()
+	}
+}
+
+// incomplete 判断输入是否还没有结束：有未闭合的{，或者最后一个词是then、else、do
+func incomplete(input string) bool {
+	if strings.Count(input, "{") > strings.Count(input, "}") {
+		return true
+	}
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return false
+	}
+	switch fields[len(fields)-1] {
+	case "then", "else", "do":
+		return true
+	}
+	return false
+}
+
+// Eval 执行一次输入
+func (r *REPL) Eval(input string) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return
+	}
+	if strings.HasSuffix(input, ";") || strings.HasSuffix(input, "}") {
+		r.exec(input)
+	} else {
+		r.evalExpr(input)
+	}
+}
+
+// program 将会话中的声明与输入拼成一个完整的程序
+func (r *REPL) program(decls, input string) []byte {
+	var b strings.Builder
+	b.WriteString("{")
+	for _, name := range r.order {
+		b.WriteString(fmt.Sprintf(" %s %s;", r.types[name], name))
+	}
+	b.WriteString(decls)
+	b.WriteString("\n")
+	b.WriteString(input)
+	b.WriteString("\n}")
+	return []byte(b.String())
+}
+
+// report 打印诊断信息，位置换算为输入中的行列号；出错处在添加的"it ="上时，
+// 说明输入不能作为表达式，报告在输入的开头
+func (r *REPL) report(diagnostics []compiler.Diagnostic) {
+	for _, d := range diagnostics {
+		d.File = ""
+		pos, synthetic := r.inputPosition(d.Pos)
+		d.Pos = pos
+		if synthetic {
+			d.Message = "invalid expression"
+		}
+		//语法分析读到了添加的";"，说明表达式不完整
+		if !synthetic && pos == r.end && d.Code == compiler.CodeUnexpectedToken {
+			d.Code, d.Message = compiler.CodeUnexpectedEOF, "unexpected end of input"
+		}
+		fmt.Fprintln(r.out, d)
+	}
+}
+
+// inputPosition 将拼接后的程序中的位置换算为输入中的位置，会话中的声明所在的第1行换算为无效位置；
+// synthetic表示该位置在输入之前添加的部分上
+func (r *REPL) inputPosition(pos lexer.Position) (lexer.Position, bool) {
+	if pos.Line <= 1 {
+		return lexer.Position{}, false
+	}
+	pos.Line--
+	if pos.Line == 1 && r.prefix > 0 {
+		if pos.Column <= r.prefix {
+			return lexer.Position{Line: 1, Column: 1}, true
+		}
+		pos.Column -= r.prefix
+	}
+	return pos, false
+}
+
+// run 用会话中变量的值执行编译结果，返回执行后变量的值
+func (r *REPL) run(result *compiler.Result) (map[string]int, error) {
+	in := interpreter.NewInterpreter(result.Semantic, r.reader, r.out)
+	for name, v := range r.values {
+		in.Set(name, v)
+	}
+	err := in.Run()
+	//四元式与行号对应的是拼接后的程序，对用户没有意义，只保留错误本身
+	var runtimeErr *interpreter.Error
+	if errors.As(err, &runtimeErr) {
+		err = runtimeErr.Err
+	}
+	return in.Memory(), err
+}
+
+// exec 执行声明与语句，新声明的变量加入会话
+func (r *REPL) exec(input string) {
+	result, diagnostics := compiler.Compile(r.program("", input), compiler.Options{})
+	r.last, r.prefix, r.end = result, 0, lexer.Position{}
+	//新声明的变量尚未使用是正常的，不需要警告
+	errs := make([]compiler.Diagnostic, 0, len(diagnostics))
+	for _, d := range diagnostics {
+		if d.Code != compiler.CodeUnusedVariable {
+			errs = append(errs, d)
+		}
+	}
+	r.report(errs)
+	if compiler.HasErrors(diagnostics) {
+		return
+	}
+	memory, err := r.run(result)
+	for _, token := range compiler.Declarations(result.Tree) {
+		if _, ok := r.types[token.Value]; !ok {
+			r.types[token.Value] = result.Symbols[token.Value].Type
+			r.order = append(r.order, token.Value)
+		}
+	}
+	for _, name := range r.order {
+		r.values[name] = memory[name]
+	}
+	if err != nil {
+		fmt.Fprintln(r.out, err)
+	}
+}
+
+// resultName 选择一个会话中没有的变量名保存表达式的值
+func (r *REPL) resultName() string {
+	name := "it"
+	for i := 1; ; i++ {
+		if _, ok := r.types[name]; !ok {
+			return name
+		}
+		name = fmt.Sprintf("it%d", i)
+	}
+}
+
+// evalExpr 对表达式求值并打印值与类型，先作为int表达式，失败后再作为bool表达式
+func (r *REPL) evalExpr(input string) {
+	name := r.resultName()
+	r.end = lexer.Position{Line: 1 + strings.Count(input, "\n"), Column: len(input) - strings.LastIndex(input, "\n")}
+	type attempt struct {
+		typ         string
+		result      *compiler.Result
+		diagnostics []compiler.Diagnostic
+	}
+	attempts := make([]attempt, 0, 2)
+	prefixes := make([]int, 0, 2)
+	for _, typ := range []string{"int", "bool"} {
+		op := "="
+		if typ == "bool" {
+			op = ":="
+		}
+		decl := fmt.Sprintf(" %s %s;", typ, name)
+		prefix := fmt.Sprintf("%s %s ", name, op)
+		result, diagnostics := compiler.Compile(r.program(decl, prefix+input+";"), compiler.Options{})
+		r.prefix = len(prefix)
+		if !compiler.HasErrors(diagnostics) {
+			r.last = result
+			memory, err := r.run(result)
+			if err != nil {
+				fmt.Fprintln(r.out, err)
+				return
+			}
+			fmt.Fprintf(r.out, "%s : %s\n", format(memory[name], typ), typ)
+			return
+		}
+		attempts = append(attempts, attempt{typ, result, diagnostics})
+		prefixes = append(prefixes, r.prefix)
+	}
+	//两次都失败时，报告进行得更远（到达语义分析）的那一次的错误
+	best := 0
+	if phase(attempts[0].diagnostics) != compiler.PhaseSemantic && phase(attempts[1].diagnostics) == compiler.PhaseSemantic {
+		best = 1
+	}
+	r.last, r.prefix = attempts[best].result, prefixes[best]
+	r.report(attempts[best].diagnostics)
+}
+
+// phase 返回第一条错误所在的阶段
+func phase(diagnostics []compiler.Diagnostic) compiler.Phase {
+	for _, d := range diagnostics {
+		if d.Severity == compiler.SeverityError {
+			return d.Phase
+		}
+	}
+	return ""
+}
+
+// format 按类型格式化值
+func format(v int, typ string) string {
+	if typ == "bool" {
+		return fmt.Sprint(v != 0)
+	}
+	return fmt.Sprint(v)
+}
+
+// meta 执行元命令，返回是否退出
+func (r *REPL) meta(line string) bool {
+	cmd, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch cmd {
+	case ":quit", ":q":
+		return true
+	case ":help", ":h":
+		r.help()
+	case ":reset":
+		r.Reset()
+		fmt.Fprintln(r.out, "session cleared")
+	case ":symbols":
+		r.symbols()
+	case ":tokens", ":tree", ":ir":
+		if arg != "" {
+			r.Eval(arg)
+		}
+		r.show(cmd)
+	case ":load":
+		if err := r.load(arg); err != nil {
+			fmt.Fprintln(r.out, err)
+		}
+	default:
+		fmt.Fprintf(r.out, "unknown command %s, type :help for help\n", cmd)
+	}
+	return false
+}
+
+func (r *REPL) help() {
+	fmt.Fprintln(r.out, `declarations and statements end with ; or }, anything else is evaluated as an expression
+  :tokens [input]  show the tokens of the last (or given) input
+  :tree [input]    show the syntax tree of the last (or given) input
+  :ir [input]      show the quadruples of the last (or given) input
+  :symbols         show the variables of the session
+  :reset           clear the session
+  :load file       execute a source file in the session
+  :quit            exit`)
+}
+
+// symbols 打印会话中的变量
+func (r *REPL) symbols() {
+	names := append([]string(nil), r.order...)
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(r.out, "%-8s %-4s %s\n", name, r.types[name], format(r.values[name], r.types[name]))
+	}
+}
+
+// show 显示最近一次输入的单词、语法树或四元式，只显示输入部分的单词，
+// 不包括会话中的声明与求表达式的值时添加的"it ="和;
+func (r *REPL) show(cmd string) {
+	if r.last == nil {
+		fmt.Fprintln(r.out, "nothing has been compiled yet")
+		return
+	}
+	switch cmd {
+	case ":tokens":
+		tokens := r.last.Tokens
+		end := len(tokens)
+		if end > 0 && tokens[end-1].Value == "}" {
+			end--
+		}
+		if r.prefix > 0 && end > 0 && tokens[end-1].Value == ";" {
+			end--
+		}
+		for _, token := range tokens[:end] {
+			pos, synthetic := r.inputPosition(token.Pos)
+			if !pos.IsValid() || synthetic {
+				continue
+			}
+			fmt.Fprintf(r.out, "%-8s %-10s %s\n", pos, lexer.ClassName(token.Class), token.Value)
+		}
+	case ":tree":
+		if r.last.Tree == nil {
+			fmt.Fprintln(r.out, "no syntax tree")
+			return
+		}
+		fmt.Fprint(r.out, analyzer.FormatTree(r.last.Tree))
+	case ":ir":
+		for index, q := range r.last.IR {
+			fmt.Fprintf(r.out, "%d: %s\n", index, q)
+		}
+	}
+}
+
+// load 在会话中执行源文件，完整的程序会去掉最外层的{}，使其中的声明加入会话
+func (r *REPL) load(filename string) error {
+	if filename == "" {
+		return errors.New("usage: :load file")
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	r.exec(string(unwrap(data)))
+	return nil
+}
+
+// unwrap 第一个单词{与最后一个单词}配对时将二者替换为空格，注释中的括号不受影响，行号保持不变
+func unwrap(src []byte) []byte {
+	result, diagnostics := compiler.Compile(src, compiler.Options{StopAfter: compiler.PhaseLex})
+	tokens := result.Tokens
+	if compiler.HasErrors(diagnostics) || len(tokens) < 2 || tokens[0].Value != "{" || tokens[len(tokens)-1].Value != "}" {
+		return src
+	}
+	d := 0
+	for _, token := range tokens[:len(tokens)-1] {
+		switch token.Value {
+		case "{":
+			d++
+		case "}":
+			d--
+		}
+		if d == 0 {
+			return src
+		}
+	}
+	res := append([]byte(nil), src...)
+	res[offset(src, tokens[0].Pos)] = ' '
+	res[offset(src, tokens[len(tokens)-1].Pos)] = ' '
+	return res
+}
+
+// offset 将行列位置换算为源程序中的偏移
+func offset(src []byte, pos lexer.Position) int {
+	line := 1
+	for i, b := range src {
+		if line == pos.Line {
+			return i + pos.Column - 1
+		}
+		if b == '\n' {
+			line++
+		}
+	}
+	return len(src)
+}
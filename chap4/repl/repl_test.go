@@ -0,0 +1,76 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// session 依次执行输入的每一行，返回去掉提示符的输出
+func session(t *testing.T, input string) string {
+	t.Helper()
+	var out bytes.Buffer
+	r := New(strings.NewReader(input), &out)
+	r.SetPrompt(false)
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		//表达式不完整时报告在输入的结尾，不出现添加的";"
+		{"int a;\na*\n", "1:3: error[E0202]: unexpected end of input\n"},
+		//回溯之后报告读到的最远单词，而不是添加的"it ="
+		{"int a;\na )\n", "1:3: error[E0201]: unexpected \")\"\n"},
+		{"int a;\nif\n", "1:1: error[E0201]: unexpected \"if\"\n"},
+		//列号是输入中的列号
+		{"int a; bool b;\na + b\n", "1:5: error[E0303]: b is not int type\n"},
+		{"a + 1\n", "1:1: error[E0301]: a is not declared\n"},
+	}
+	for _, test := range tests {
+		if got := session(t, test.input); got != test.want {
+			t.Errorf("input %q: output = %q, want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestTokens(t *testing.T) {
+	got := session(t, "int a;\n:tokens (a + 2) * 3\n")
+	want := "6 : int\n" +
+		"1:1      Separator  (\n" +
+		"1:2      Identifier a\n" +
+		"1:4      Operator   +\n" +
+		"1:6      IntConst   2\n" +
+		"1:7      Separator  )\n" +
+		"1:9      Operator   *\n" +
+		"1:11     IntConst   3\n"
+	if got != want {
+		t.Errorf(":tokens output = %q, want %q", got, want)
+	}
+}
+
+// TestContinuation 以then、else、do结尾或{未闭合时继续读入下一行
+func TestContinuation(t *testing.T) {
+	got := session(t, "int a; bool b;\na = 3;\nb := a > 1;\nif b then\n  write a;\nwhile b do\n{\n  a = a - 1;\n  b := a > 0;\n}\na\n")
+	if got != "3\n0 : int\n" {
+		t.Errorf("output = %q", got)
+	}
+	for input, want := range map[string]bool{
+		"if b then":             true,
+		"if b then a = 1;":      false,
+		"while b do\n":          true,
+		"if b then a = 1; else": true,
+		"{ a = 1;":              true,
+		"a + 1":                 false,
+		"":                      false,
+	} {
+		if got := incomplete(input); got != want {
+			t.Errorf("incomplete(%q) = %v, want %v", input, got, want)
+		}
+	}
+}
@@ -5,9 +5,10 @@ import (
 	"chap4/lexer"
 	"errors"
 	"fmt"
-	"log"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 // Semantic 语义分析器
@@ -21,6 +22,51 @@ type Semantic struct {
 	JoinIndex     int
 	NotIndex      int
 	RelIndex      int
+	err           error
+	current       *lexer.Token // 正在分析的单词，用于定位语义错误
+	span          lexer.Span   // 正在翻译的语句在源程序中的范围，记录在生成的四元式上
+	exprOnly      bool         // 由RunExpr只分析表达式，四元式的范围是生成它的运算符
+}
+
+var (
+	UndeclaredErr   = errors.New("undeclared identifier")
+	RedeclaredErr   = errors.New("redeclared identifier")
+	TypeMismatchErr = errors.New("type mismatch")
+	EmptyTreeErr    = errors.New("error: syntax tree is empty")
+)
+
+// Error 语义错误，Kind为UndeclaredErr等错误种类（可能为nil），Token为出错位置的单词
+type Error struct {
+	Kind  error
+	Token *lexer.Token
+	msg   string
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+func undeclaredError(id string) error {
+	return &Error{Kind: UndeclaredErr, msg: fmt.Sprintf("error: %s is not declared", id)}
+}
+
+func redeclaredError(id string) error {
+	return &Error{Kind: RedeclaredErr, msg: fmt.Sprintf("error: %s has been declared", id)}
+}
+
+func typeError(id, typ string) error {
+	return &Error{Kind: TypeMismatchErr, msg: fmt.Sprintf("error: %s is not %s type", id, typ)}
+}
+
+// at 记录正在分析的单词
+func (s *Semantic) at(node *analyzer.Node) {
+	if node != nil && node.Token != nil {
+		s.current = node.Token
+	}
 }
 
 // Label 跳转需要的标号
@@ -36,6 +82,7 @@ type Quadruple struct {
 	arg1   string // 第一个操作数
 	arg2   string // 第二个操作数
 	result string // 结果
+	span   lexer.Span
 }
 
 // 将四元式转换为字符串
@@ -43,11 +90,56 @@ func (q *Quadruple) String() string {
 	return fmt.Sprintf("(%s, %s, %s, %s)", q.op, q.arg1, q.arg2, q.result)
 }
 
+// Span 返回生成该四元式的语句在源程序中的范围，if、while只包括条件部分
+func (q *Quadruple) Span() lexer.Span {
+	return q.span
+}
+
 // UpdateResult 更新四元式的结果，一般为添加跳转地址
 func (q *Quadruple) UpdateResult(res string) {
 	q.result = res
 }
 
+// Op 返回四元式的操作符
+func (q *Quadruple) Op() string {
+	return q.op
+}
+
+// Arg1 返回四元式的第一个操作数
+func (q *Quadruple) Arg1() string {
+	return q.arg1
+}
+
+// Arg2 返回四元式的第二个操作数
+func (q *Quadruple) Arg2() string {
+	return q.arg2
+}
+
+// Result 返回四元式的结果
+func (q *Quadruple) Result() string {
+	return q.result
+}
+
+// IsJump 判断四元式是否为跳转指令，包括j、jnz以及j>、j<=等条件跳转
+func (q *Quadruple) IsJump() bool {
+	return strings.HasPrefix(q.op, "j")
+}
+
+// JumpTarget 返回跳转指令的目标地址，未回填的标号会返回错误
+func (q *Quadruple) JumpTarget() (int, error) {
+	target, err := strconv.Atoi(q.result)
+	if err != nil {
+		return 0, fmt.Errorf("error: jump target %s is not resolved", q.result)
+	}
+	return target, nil
+}
+
+// IsConst 判断操作数是否为整常数
+func IsConst(arg string) bool {
+	_, err := strconv.Atoi(arg)
+	return err == nil
+}
+
 // IsTypeInt 检查是否为int类型,用于检查赋值语句，算术表达式
 func (s *Semantic) IsTypeInt(id string) bool {
 	return s.SymbolTable[id].Type == "int"
@@ -59,9 +151,10 @@ func (s *Semantic) IsTypeBool(id string) bool {
 }
 
 // IsIdDeclared 检查标识符是否已经声明，用户检查赋值语句，算术表达式，布尔表达式
+// 词法分析时所有单词都会进入符号表，只有在声明（或生成临时变量）时才会被赋予类型
 func (s *Semantic) IsIdDeclared(id string) bool {
-	_, isDeclared := s.SymbolTable[id]
-	return isDeclared
+	symbol, isDeclared := s.SymbolTable[id]
+	return isDeclared && symbol.Type != ""
 }
 
 // IsIdTyped 检查标识符是否已经声明并且类型为int或bool
@@ -99,6 +192,28 @@ func (s *Semantic) randomVarName() string {
 	return "t" + strconv.Itoa(s.TempVarCount)
 }
 
+// QuadrupleList 返回生成的四元式列表
+func (s *Semantic) QuadrupleList() []*Quadruple {
+	return s.quadrupleList
+}
+
+// Err 返回语义分析过程中出现的错误
+func (s *Semantic) Err() error {
+	return s.err
+}
+
+// VarList 返回符号表中所有带类型的变量（包括临时变量），按名字排序
+func (s *Semantic) VarList() []string {
+	vars := make([]string, 0)
+	for name, symbol := range s.SymbolTable {
+		if symbol.Type != "" {
+			vars = append(vars, name)
+		}
+	}
+	sort.Strings(vars)
+	return vars
+}
+
 // PrintQuadrupleList 打印四元式列表
 func (s *Semantic) PrintQuadrupleList() {
 	for index, q := range s.quadrupleList {
@@ -107,28 +222,24 @@ func (s *Semantic) PrintQuadrupleList() {
 }
 
 // PrintToFile 将四元式列表打印到文件中
-func (s *Semantic) PrintToFile(filename string) {
-	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, 0666)
+func (s *Semantic) PrintToFile(filename string) error {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			log.Fatal(err)
-		}
-	}(file)
 	for index, q := range s.quadrupleList {
 		_, err := file.WriteString(fmt.Sprintf("%d: %s\n", index, q))
 		if err != nil {
-			return
+			file.Close()
+			return err
 		}
 	}
+	return file.Close()
 }
 
 // 生成一个新的四元式，并将其添加到列表中
 func (s *Semantic) generateQuadruple(op, arg1, arg2, result string) *Quadruple {
-	quadruple := &Quadruple{op, arg1, arg2, result}
+	quadruple := &Quadruple{op, arg1, arg2, result, s.span}
 	s.quadrupleList = append(s.quadrupleList, quadruple)
 	return quadruple
 }
@@ -151,13 +262,83 @@ func (s *Semantic) Run() {
 
 // traverse 遍历语法树
 func (s *Semantic) traverse() {
+	if s.root == nil {
+		s.err = &Error{Kind: EmptyTreeErr, msg: EmptyTreeErr.Error()}
+		return
+	}
 	if err := s.traversePROG(s.root); err != nil {
-		fmt.Println(err)
+		s.fail(err)
 		return
 	}
+	//quit对应程序结尾的}
+	if last := lastChild(s.root); last != nil && last.Token != nil {
+		s.span = last.Token.Span()
+	}
 	s.generateQuadruple("quit", "_", "_", "_")
 }
 
+// fail 记录语义错误，没有位置的错误定位到正在分析的单词
+func (s *Semantic) fail(err error) {
+	var semanticErr *Error
+	if !errors.As(err, &semanticErr) {
+		semanticErr = &Error{msg: err.Error()}
+	}
+	if semanticErr.Token == nil {
+		semanticErr.Token = s.current
+	}
+	s.err = semanticErr
+}
+
+// Declare 将变量声明为typ类型（int或bool），用于在没有声明语句的表达式中使用变量
+func (s *Semantic) Declare(id, typ string) {
+	if symbol, ok := s.SymbolTable[id]; ok {
+		symbol.Type = typ
+		return
+	}
+	s.SymbolTable[id] = &lexer.Symbol{Name: []byte(id), Type: typ}
+}
+
+// RunExpr 把语法树作为算术表达式<EXPR>分析并生成四元式，不生成quit，四元式的Span为生成它的运算符；
+// 返回表达式的值所在的变量、临时变量或常数，出错时返回空串，错误由Err得到
+func (s *Semantic) RunExpr() string {
+	if s.root == nil {
+		s.err = &Error{Kind: EmptyTreeErr, msg: EmptyTreeErr.Error()}
+		return ""
+	}
+	s.span = s.root.Span()
+	s.exprOnly = true
+	s.MallocAttrMap(s.root)
+	if _, err := s.traverseExpr(s.root); err != nil {
+		s.fail(err)
+		return ""
+	}
+	if s.root.Attr["isAddr"].(bool) {
+		return s.root.Attr["addr"].(string)
+	}
+	return s.root.Attr["value"].(string)
+}
+
+// operatorSpan 只分析表达式时将四元式的范围设为运算符op，以便报告除以零等运行时错误的位置
+func (s *Semantic) operatorSpan(op *analyzer.Node) {
+	if s.exprOnly && op != nil && op.Token != nil {
+		s.span = op.Token.Span()
+	}
+}
+
+// lastChild 返回结点的最后一个儿子
+func lastChild(node *analyzer.Node) *analyzer.Node {
+	child := node.LeftChild
+	for child != nil && child.RightBro != nil {
+		child = child.RightBro
+	}
+	return child
+}
+
+// header 从first到last两个单词之间的范围，用于if、while的条件部分
+func header(first, last *analyzer.Node) lexer.Span {
+	return lexer.Span{Start: first.Token.Pos, End: last.Token.Span().End}
+}
+
 // traversePROG 遍历PROG   PROG        →    {  DECLS  STMTS  }
 func (s *Semantic) traversePROG(node *analyzer.Node) error {
 	decls := node.LeftChild.RightBro
@@ -247,10 +428,11 @@ func (s *Semantic) traverseNames(node *analyzer.Node) error {
 
 // traverseName 遍历NAME   NAME        →    id
 func (s *Semantic) traverseName(node *analyzer.Node) error {
+	s.at(node.LeftChild)
 	id := node.LeftChild.Token.Value
 	// 如果id已经被声明过了，那么就报错
 	if s.IsIdTyped(id) {
-		return errors.New("Error: " + id + " has been declared")
+		return redeclaredError(id)
 	}
 	symbol := s.SymbolTable[id]
 	symbol.Type = node.Attr["type"].(string)
@@ -304,55 +486,56 @@ func (s *Semantic) traverseExpr1(node *analyzer.Node) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	//将term继承给expr1
-	s.TransferAddrOrValueAttr(term, expr1)
-	type3, err := s.traverseExpr1(expr1)
-	if err != nil {
-		return "", err
-	}
-	//处理四元式
+	//处理四元式，左结合：先计算 node继承的值 op term，结果再继承给expr1
 	varName := s.randomVarName() //生成一个随机变量名
 	operand1 := ""               //操作数1，由node提供
 	if node.Attr["isAddr"].(bool) {
 		operand1 = node.Attr["addr"].(string)
 		if !s.IsIdDeclared(operand1) {
-			return "", fmt.Errorf("error: %s is not declared", operand1)
+			return "", undeclaredError(operand1)
 		}
 		if !s.IsTypeInt(operand1) {
-			return "", fmt.Errorf("error: %s is not an int", operand1)
+			return "", typeError(operand1, "int")
 		}
 	} else {
 		operand1 = node.Attr["value"].(string)
 	}
-	operand2 := "" //操作数2，由term1提供
-	if expr1.Attr["isAddr"].(bool) {
-		operand2 = expr1.Attr["addr"].(string)
+	operand2 := "" //操作数2，由term提供
+	if term.Attr["isAddr"].(bool) {
+		operand2 = term.Attr["addr"].(string)
 		if !s.IsIdDeclared(operand2) {
-			return "", fmt.Errorf("error: %s is not declared", operand2)
+			return "", undeclaredError(operand2)
 		}
 		if !s.IsTypeInt(operand2) {
-			return "", fmt.Errorf("error: %s is not an int", operand2)
+			return "", typeError(operand2, "int")
 		}
 	} else {
-		operand2 = expr1.Attr["value"].(string)
+		operand2 = term.Attr["value"].(string)
 	}
 	//生成一条四元式
+	s.operatorSpan(addOp.LeftChild)
 	s.generateQuadruple(op, operand1, operand2, varName)
-	//进行类型检查
-	if type1 == type2 && type1 == type3 && type1 == "int" {
-		node.Attr["type"] = "int"
-	} else {
-		return "", errors.New("error: term1 is not an int term1")
-	}
 	//varName保存到symbolTable中
 	s.SymbolTable[varName] = &lexer.Symbol{
 		Name:     []byte(varName),
 		Type:     "int",
 		IsValued: false,
 	}
-	//将varName保存到node的attr中
-	node.Attr["isAddr"] = true
-	node.Attr["addr"] = varName
+	//将varName继承给expr1
+	expr1.Attr["isAddr"] = true
+	expr1.Attr["addr"] = varName
+	type3, err := s.traverseExpr1(expr1)
+	if err != nil {
+		return "", err
+	}
+	//进行类型检查
+	if type1 == type2 && type1 == type3 && type1 == "int" {
+		node.Attr["type"] = "int"
+	} else {
+		return "", errors.New("error: term1 is not an int term1")
+	}
+	//将expr1的结果综合给node，expr1推导出空时其结果即为继承的varName
+	s.TransferAddrOrValueAttr(expr1, node)
 	node.Attr["type"] = "int"
 	return "int", nil
 }
@@ -404,55 +587,56 @@ func (s *Semantic) traverseTerm1(node *analyzer.Node) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	//将nega继承给term1
-	s.TransferAddrOrValueAttr(nega, term1)
-	type3, err := s.traverseTerm1(term1)
-	if err != nil {
-		return "", err
-	}
-	//处理四元式
+	//处理四元式，左结合：先计算 node继承的值 op nega，结果再继承给term1
 	varName := s.randomVarName() //生成一个随机变量名
 	operand1 := ""               //操作数1，由node提供
 	if node.Attr["isAddr"].(bool) {
 		operand1 = node.Attr["addr"].(string)
 		if !s.IsIdDeclared(operand1) {
-			return "", fmt.Errorf("error: %s is not declared", operand1)
+			return "", undeclaredError(operand1)
 		}
 		if !s.IsTypeInt(operand1) {
-			return "", fmt.Errorf("error: %s is not an int", operand1)
+			return "", typeError(operand1, "int")
 		}
 	} else {
 		operand1 = node.Attr["value"].(string)
 	}
-	operand2 := "" //操作数2，由term1提供
-	if term1.Attr["isAddr"].(bool) {
-		operand2 = term1.Attr["addr"].(string)
+	operand2 := "" //操作数2，由nega提供
+	if nega.Attr["isAddr"].(bool) {
+		operand2 = nega.Attr["addr"].(string)
 		if !s.IsIdDeclared(operand2) {
-			return "", fmt.Errorf("error: %s is not declared", operand2)
+			return "", undeclaredError(operand2)
 		}
 		if !s.IsTypeInt(operand2) {
-			return "", fmt.Errorf("error: %s is not an int", operand2)
+			return "", typeError(operand2, "int")
 		}
 	} else {
-		operand2 = term1.Attr["value"].(string)
+		operand2 = nega.Attr["value"].(string)
 	}
 	//生成一条四元式
+	s.operatorSpan(mulOp.LeftChild)
 	s.generateQuadruple(op, operand1, operand2, varName)
-	//进行类型检查
-	if type1 == type2 && type1 == type3 && type1 == "int" {
-		node.Attr["type"] = "int"
-	} else {
-		return "", errors.New("error: term1 is not an int term1")
-	}
 	//varName保存到symbolTable中
 	s.SymbolTable[varName] = &lexer.Symbol{
 		Name:     []byte(varName),
 		Type:     "int",
 		IsValued: false,
 	}
-	//将varName保存到node的attr中
-	node.Attr["isAddr"] = true
-	node.Attr["addr"] = varName
+	//将varName继承给term1
+	term1.Attr["isAddr"] = true
+	term1.Attr["addr"] = varName
+	type3, err := s.traverseTerm1(term1)
+	if err != nil {
+		return "", err
+	}
+	//进行类型检查
+	if type1 == type2 && type1 == type3 && type1 == "int" {
+		node.Attr["type"] = "int"
+	} else {
+		return "", errors.New("error: term1 is not an int term1")
+	}
+	//将term1的结果综合给node，term1推导出空时其结果即为继承的varName
+	s.TransferAddrOrValueAttr(term1, node)
 	node.Attr["type"] = "int"
 	return "int", nil
 }
@@ -503,20 +687,21 @@ func (s *Semantic) traverseNEGA(node *analyzer.Node) (string, error) {
 
 				symbolName := F.Attr["addr"].(string) //获取变量名
 				if !s.IsIdDeclared(symbolName) {
-					return "", fmt.Errorf("error: %s is not declared", symbolName)
+					return "", undeclaredError(symbolName)
 				}
 				if !s.IsTypeInt(symbolName) {
-					return "", fmt.Errorf("error: %s is not an int", symbolName)
+					return "", typeError(symbolName, "int")
 				}
 				varName := s.randomVarName() //生成一个随机变量名
 				//生成中间代码
+				s.operatorSpan(node.LeftChild)
 				s.generateQuadruple("*", symbolName, "-1", varName) // （*,-1,id,temp）
 				//将varName保存到symbolTable中
 				s.SymbolTable[varName] = &lexer.Symbol{
 					Name: []byte(varName),
 					Type: "int",
 				}
-				node.Attr["addr"] = symbolName
+				node.Attr["addr"] = varName
 				node.Attr["isAddr"] = true
 				return "int", nil
 			} else {
@@ -537,12 +722,13 @@ func (s *Semantic) traverseNEGA(node *analyzer.Node) (string, error) {
 func (s *Semantic) traverseFactor(node *analyzer.Node) (string, error) {
 	switch node.LeftChild.Class {
 	case analyzer.Id:
+		s.at(node.LeftChild)
 		id := node.LeftChild.Token.Value
 		if !s.IsIdDeclared(id) {
-			return "", fmt.Errorf("error: %s is not declared", id)
+			return "", undeclaredError(id)
 		}
 		if !s.IsTypeInt(id) {
-			return "", fmt.Errorf("error: %s is not an int", id)
+			return "", typeError(id, "int")
 		}
 		symbol := s.SymbolTable[id]
 		if symbol.Type == "int" {
@@ -551,7 +737,7 @@ func (s *Semantic) traverseFactor(node *analyzer.Node) (string, error) {
 			node.Attr["isAddr"] = true              //该Factor是一个地址
 			return "int", nil
 		}
-		return "", fmt.Errorf("error: %s is not an int", id)
+		return "", typeError(id, "int")
 	case analyzer.Number:
 		node.Attr["type"] = "int"
 		node.Attr["value"] = node.LeftChild.Token.Value //绑定该数字的值
@@ -700,14 +886,18 @@ func (s *Semantic) createRelLabel(index int, b bool) {
 // STMT      →    write  id  ;
 // traverseSTMT 遍历STMT
 func (s *Semantic) traverseSTMT(node *analyzer.Node) error {
+	s.at(node.LeftChild)
+	s.span = node.Span()
 	if node.LeftChild.Class == analyzer.Id {
 		switch node.LeftChild.RightBro.Token.Value {
 		case "=":
+			if err := s.checkAssignTarget(node.LeftChild.Token.Value, "int"); err != nil {
+				return err
+			}
 			expr := node.LeftChild.RightBro.RightBro
 			s.MallocAttrMap(expr)
 			_, err := s.traverseExpr(expr)
 			if err != nil {
-				fmt.Println(err)
 				return err
 			}
 			//生成中间代码
@@ -717,6 +907,9 @@ func (s *Semantic) traverseSTMT(node *analyzer.Node) error {
 				s.generateQuadruple("=", expr.Attr["value"].(string), "_", node.LeftChild.Token.Value)
 			}
 		case ":=":
+			if err := s.checkAssignTarget(node.LeftChild.Token.Value, "bool"); err != nil {
+				return err
+			}
 			index := s.getBoolIndex()
 			s.createBoolLabel(index, true)
 			s.createBoolLabel(index, false)
@@ -724,7 +917,6 @@ func (s *Semantic) traverseSTMT(node *analyzer.Node) error {
 			s.MallocAttrMap(boolVar)
 			_, err := s.traverseBOOL(boolVar, index)
 			if err != nil {
-				fmt.Println(err)
 				return err
 			}
 			//生成中间代码
@@ -754,11 +946,13 @@ func (s *Semantic) traverseSTMT(node *analyzer.Node) error {
 		id := node.LeftChild.RightBro
 		stmt := id.RightBro.RightBro
 		start := len(s.quadrupleList)
+		s.span = header(node.LeftChild, id.RightBro)
+		s.at(id)
 		if !s.IsIdDeclared(id.Token.Value) {
-			return fmt.Errorf("id %s is not declared", id.Token.Value)
+			return undeclaredError(id.Token.Value)
 		}
 		if !s.IsTypeBool(id.Token.Value) {
-			return fmt.Errorf("id %s is not bool type", id.Token.Value)
+			return typeError(id.Token.Value, "bool")
 		}
 		s.generateQuadruple("jnz", id.Token.Value, "_", strconv.Itoa(start+2))
 		s.generateQuadruple("j", "_", "_", "")
@@ -770,6 +964,7 @@ func (s *Semantic) traverseSTMT(node *analyzer.Node) error {
 		if stmt.RightBro != nil {
 			s.quadrupleList[start+1].UpdateResult(strconv.Itoa(end + 1))
 			start = len(s.quadrupleList)
+			s.span = stmt.RightBro.Token.Span()
 			s.generateQuadruple("j", "_", "_", "")
 			stmt = stmt.RightBro.RightBro
 			if err := s.traverseSTMT(stmt); err != nil {
@@ -781,11 +976,14 @@ func (s *Semantic) traverseSTMT(node *analyzer.Node) error {
 	} else if node.LeftChild.Class == analyzer.While {
 		id := node.LeftChild.RightBro
 		stmt := id.RightBro.RightBro
+		span := header(node.LeftChild, id.RightBro)
+		s.span = span
+		s.at(id)
 		if !s.IsIdDeclared(id.Token.Value) {
-			return fmt.Errorf("id %s is not declared", id.Token.Value)
+			return undeclaredError(id.Token.Value)
 		}
 		if !s.IsTypeBool(id.Token.Value) {
-			return fmt.Errorf("id %s is not bool type", id.Token.Value)
+			return typeError(id.Token.Value, "bool")
 		}
 		s.MallocAttrMap(stmt)
 		start := len(s.quadrupleList)
@@ -794,12 +992,18 @@ func (s *Semantic) traverseSTMT(node *analyzer.Node) error {
 		if err := s.traverseSTMT(stmt); err != nil {
 			return err
 		}
+		//跳回循环开始的四元式属于while的条件部分
+		s.span = span
 		s.generateQuadruple("j", "_", "_", strconv.Itoa(start))
 		end := len(s.quadrupleList)
 		s.quadrupleList[start+1].UpdateResult(strconv.Itoa(end))
 	} else if node.LeftChild.Class == analyzer.Read || node.LeftChild.Class == analyzer.Write {
 		op := node.LeftChild.Token.Value
 		id := node.LeftChild.RightBro
+		s.at(id)
+		if !s.IsIdDeclared(id.Token.Value) {
+			return undeclaredError(id.Token.Value)
+		}
 		s.generateQuadruple(op, id.Token.Value, "_", "mem")
 	} else if node.LeftChild.Class == analyzer.LeftBracket {
 		stmts := node.LeftChild.RightBro
@@ -811,6 +1015,17 @@ func (s *Semantic) traverseSTMT(node *analyzer.Node) error {
 	return nil
 }
 
+// checkAssignTarget 检查赋值语句左部的变量已声明且类型正确
+func (s *Semantic) checkAssignTarget(id, typ string) error {
+	if !s.IsIdDeclared(id) {
+		return undeclaredError(id)
+	}
+	if s.SymbolTable[id].Type != typ {
+		return typeError(id, typ)
+	}
+	return nil
+}
+
 // 布尔表达式的赋值
 // BOOL    →    JOIN  ||  BOOL    |    JOIN
 // JOIN     →    NOT   &&   JOIN  |   NOT
@@ -925,7 +1140,13 @@ func (s *Semantic) traverseNOT(node *analyzer.Node, notIndex int) (string, error
 	s.createRelLabel(index, true)
 	s.createRelLabel(index, false)
 	s.MallocAttrMap(rel)
-	_, err := s.traverseREL(rel, index)
+	var err error
+	if rel.Class == analyzer.Id {
+		// NOT → ! id | id
+		_, err = s.traverseBoolId(rel, index)
+	} else {
+		_, err = s.traverseREL(rel, index)
+	}
 	if err != nil {
 		return "", err
 	}
@@ -995,6 +1216,26 @@ func (s *Semantic) traverseREL(node *analyzer.Node, relIndex int) (string, error
 	return "", errors.New("error: expr1 is not an int expr")
 }
 
+// traverseBoolId 语义分析作为布尔表达式的bool变量，为真时跳转到rel的真出口，否则跳转到假出口
+func (s *Semantic) traverseBoolId(node *analyzer.Node, relIndex int) (string, error) {
+	s.at(node)
+	id := node.Token.Value
+	if !s.IsIdDeclared(id) {
+		return "", undeclaredError(id)
+	}
+	if !s.IsTypeBool(id) {
+		return "", typeError(id, "bool")
+	}
+	node.Attr["type"] = "bool"
+	relTrueLabel := s.getRelLabel(relIndex, true)
+	relFalseLabel := s.getRelLabel(relIndex, false)
+	s.generateQuadruple("jnz", id, "_", relTrueLabel.Name)
+	relTrueLabel.BackPatch = append(relTrueLabel.BackPatch, len(s.quadrupleList)-1)
+	s.generateQuadruple("j", "_", "_", relFalseLabel.Name)
+	relFalseLabel.BackPatch = append(relFalseLabel.BackPatch, len(s.quadrupleList)-1)
+	return "bool", nil
+}
+
 // traversalROP 语义分析ROP
 func (s *Semantic) traverseROP(node *analyzer.Node) (string, error) {
 	node.Attr["type"] = "bool"
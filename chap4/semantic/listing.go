@@ -0,0 +1,23 @@
+package semantic
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Listing 将四元式与源程序对照输出，类似objdump -S：
+// 每当四元式所属的语句变化时，先以注释的形式输出该语句所在的源程序行
+func (s *Semantic) Listing(src []byte) string {
+	lines := strings.Split(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n")
+	var b strings.Builder
+	width := len(fmt.Sprint(len(lines)))
+	for index, q := range s.quadrupleList {
+		if q.span.IsValid() && (index == 0 || q.span != s.quadrupleList[index-1].span) {
+			for line := q.span.Start.Line; line <= q.span.End.Line && line <= len(lines); line++ {
+				fmt.Fprintf(&b, "// %*d | %s\n", width, line, strings.TrimRight(lines[line-1], " \t"))
+			}
+		}
+		fmt.Fprintf(&b, "%d: %s\n", index, q)
+	}
+	return b.String()
+}
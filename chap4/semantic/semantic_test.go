@@ -0,0 +1,106 @@
+package semantic_test
+
+import (
+	"bytes"
+	"chap4/compiler"
+	"chap4/interpreter"
+	"strings"
+	"testing"
+)
+
+// TestLeftAssociative + - * /是左结合的：a-b-c按(a-b)-c生成四元式，一元的-生成的临时变量作为运算数
+func TestLeftAssociative(t *testing.T) {
+	tests := []struct {
+		expression string
+		code       []string
+	}{
+		{"a - 3 - 2", []string{"(-, a, 3, t1)", "(-, t1, 2, t2)"}},
+		{"a / 2 / 5", []string{"(/, a, 2, t1)", "(/, t1, 5, t2)"}},
+		{"a - 2 * 3 + 1", []string{"(*, 2, 3, t1)", "(-, a, t1, t2)", "(+, t2, 1, t3)"}},
+		{"-a * 2", []string{"(*, a, -1, t1)", "(*, t1, 2, t2)"}},
+	}
+	for _, test := range tests {
+		result, diagnostics := compiler.CompileExpr([]byte(test.expression), []string{"a"}, compiler.Options{})
+		if compiler.HasErrors(diagnostics) {
+			t.Errorf("CompileExpr(%q): %v", test.expression, diagnostics)
+			continue
+		}
+		var code []string
+		for _, q := range result.IR {
+			code = append(code, q.String())
+		}
+		if strings.Join(code, " ") != strings.Join(test.code, " ") {
+			t.Errorf("CompileExpr(%q) = %q, want %q", test.expression, code, test.code)
+		}
+	}
+}
+
+// TestLeftAssociativeRun 执行的结果与按左结合计算的结果相同
+func TestLeftAssociativeRun(t *testing.T) {
+	src := `{
+    int a, b;
+    a = 20;
+    b = a - 5 - 3;
+    write b;
+    b = a / 2 / 5;
+    write b;
+    b = -a + 30 - -a;
+    write b;
+}`
+	if got := run(t, src); got != "12 2 30" {
+		t.Errorf("output = %q, want 12 2 30", got)
+	}
+}
+
+// run 编译并执行程序，返回输出
+func run(t *testing.T, src string) string {
+	t.Helper()
+	result, diagnostics := compiler.Compile([]byte(src), compiler.Options{})
+	if compiler.HasErrors(diagnostics) {
+		t.Fatal(diagnostics)
+	}
+	var out bytes.Buffer
+	if err := interpreter.NewInterpreter(result.Semantic, strings.NewReader(""), &out).Run(); err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(strings.Fields(out.String()), " ")
+}
+
+// TestAssignTarget 赋值、read与write的变量必须已声明，=的左部是int，:=的左部是bool；
+// 只在程序中出现过而没有声明的名字不算声明
+func TestAssignTarget(t *testing.T) {
+	tests := []struct {
+		src  string
+		code string
+	}{
+		{"{ int a; b = 1; }", compiler.CodeUndeclared},
+		{"{ int a; a = 1; write x; }", compiler.CodeUndeclared},
+		{"{ int a; read y; }", compiler.CodeUndeclared},
+		{"{ bool c; c = 1; }", compiler.CodeTypeMismatch},
+		{"{ int a; a := 1 < 2; }", compiler.CodeTypeMismatch},
+	}
+	for _, test := range tests {
+		_, diagnostics := compiler.Compile([]byte(test.src), compiler.Options{})
+		if !compiler.HasErrors(diagnostics) || diagnostics[0].Code != test.code {
+			t.Errorf("Compile(%q) = %v, want %s", test.src, diagnostics, test.code)
+		}
+	}
+}
+
+// TestBoolId bool变量可以直接作为布尔表达式，也可以作为!的运算数
+func TestBoolId(t *testing.T) {
+	src := `{
+    int r;
+    bool c, d;
+    c := 1 < 2;
+    d := ! c;
+    if d then r = 1; else r = 2;
+    write r;
+    d := c;
+    if d then r = 3; else r = 4;
+    write r;
+}`
+	if got := run(t, src); got != "2 3" {
+		t.Errorf("output = %q, want 2 3", got)
+	}
+}
@@ -0,0 +1,248 @@
+// Package service 以HTTP接口提供编译的各个阶段，请求与响应都是JSON
+//
+//	POST /api/lex    单词序列
+//	POST /api/parse  语法树
+//	POST /api/check  诊断信息与声明的变量
+//	POST /api/ir     四元式
+//	POST /api/run    程序的输出
+//
+// 所有接口都接受CompileRequest，源程序有错误时仍返回200，ok为false，错误在diagnostics中；
+// 请求本身无法解析或源程序超过限制时返回400，请求体超过限制时返回413，处理请求时panic返回500。
+package service
+
+import (
+	"chap4/analyzer"
+	"chap4/compiler"
+	"chap4/interpreter"
+	"chap4/lexer"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	SourceTooLargeErr = errors.New("source is too large")
+	OutputLimitErr    = errors.New("runtime error: output limit exceeded")
+)
+
+// Limits 服务对每个请求的限制，请求中给出的限制不能超过这里的值
+type Limits struct {
+	MaxBodySize   int           // 请求体的最大字节数，在解析JSON之前检查
+	MaxSourceSize int           // 源程序的最大字节数
+	MaxSteps      int           // 最多执行的四元式条数
+	Timeout       time.Duration // 最长执行时间
+	MaxOutput     int           // 程序输出的最大字节数
+}
+
+// DefaultLimits 默认的限制
+var DefaultLimits = Limits{
+	MaxBodySize:   1 << 20,
+	MaxSourceSize: 64 << 10,
+	MaxSteps:      1000000,
+	Timeout:       2 * time.Second,
+	MaxOutput:     64 << 10,
+}
+
+// CompileRequest 编译请求
+type CompileRequest struct {
+	Source    string `json:"source"`
+	Stdin     string `json:"stdin"`     // 程序运行时的输入，只用于/api/run
+	MaxSteps  int    `json:"maxSteps"`  // 只用于/api/run，0表示使用服务的限制
+	TimeoutMs int    `json:"timeoutMs"` // 只用于/api/run，0表示使用服务的限制
+}
+
+// Quadruple 四元式的JSON形式
+type Quadruple struct {
+	Index  int        `json:"index"`
+	Op     string     `json:"op"`
+	Arg1   string     `json:"arg1"`
+	Arg2   string     `json:"arg2"`
+	Result string     `json:"result"`
+	Span   lexer.Span `json:"span"` // 生成该四元式的语句在源程序中的范围
+}
+
+// Symbol 声明的变量
+type Symbol struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Service 编译服务
+type Service struct {
+	limits Limits
+}
+
+// NewService 创建一个编译服务
+func NewService(limits Limits) *Service {
+	return &Service{limits: limits}
+}
+
+// Router 返回注册了所有接口的gin引擎；Recovery使处理请求时的panic返回500，而不是断开连接
+func (s *Service) Router() *gin.Engine {
+	g := gin.New()
+	g.Use(gin.Recovery())
+	s.Register(g)
+	return g
+}
+
+// Register 注册所有接口
+func (s *Service) Register(g gin.IRoutes) {
+	g.POST("/api/lex", s.Lex)
+	g.POST("/api/parse", s.Parse)
+	g.POST("/api/check", s.Check)
+	g.POST("/api/ir", s.IR)
+	g.POST("/api/run", s.Run)
+}
+
+// compile 解析请求并编译到stop阶段，请求无效时已经写出了400响应，返回false
+func (s *Service) compile(c *gin.Context, stop compiler.Phase) (*CompileRequest, *compiler.Result, []compiler.Diagnostic, bool) {
+	var request CompileRequest
+	//先限制请求体的大小，否则ShouldBindJSON会把整个请求体读入内存
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(s.limits.MaxBodySize))
+	if err := c.ShouldBindJSON(&request); err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return nil, nil, nil, false
+	}
+	if len(request.Source) > s.limits.MaxSourceSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %d bytes, limit is %d", SourceTooLargeErr, len(request.Source), s.limits.MaxSourceSize)})
+		return nil, nil, nil, false
+	}
+	result, diagnostics := compiler.Compile([]byte(request.Source), compiler.Options{StopAfter: stop})
+	if diagnostics == nil {
+		diagnostics = []compiler.Diagnostic{}
+	}
+	return &request, result, diagnostics, true
+}
+
+// Lex 词法分析
+func (s *Service) Lex(c *gin.Context) {
+	_, result, diagnostics, ok := s.compile(c, compiler.PhaseLex)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"ok":          !compiler.HasErrors(diagnostics),
+		"diagnostics": diagnostics,
+		"tokens":      result.Tokens,
+	})
+}
+
+// Parse 语法分析
+func (s *Service) Parse(c *gin.Context) {
+	_, result, diagnostics, ok := s.compile(c, compiler.PhaseParse)
+	if !ok {
+		return
+	}
+	tree, err := analyzer.JSON(result.Tree)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"ok":          !compiler.HasErrors(diagnostics),
+		"diagnostics": diagnostics,
+		"tree":        json.RawMessage(tree),
+	})
+}
+
+// Check 完整编译，返回诊断信息与声明的变量
+func (s *Service) Check(c *gin.Context) {
+	_, result, diagnostics, ok := s.compile(c, compiler.PhaseSemantic)
+	if !ok {
+		return
+	}
+	symbols := make([]Symbol, 0)
+	if result.Tree != nil {
+		for _, token := range compiler.Declarations(result.Tree) {
+			symbol := Symbol{Name: token.Value}
+			if sym, ok := result.Symbols[token.Value]; ok {
+				symbol.Type = sym.Type
+			}
+			symbols = append(symbols, symbol)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"ok":          !compiler.HasErrors(diagnostics),
+		"diagnostics": diagnostics,
+		"symbols":     symbols,
+	})
+}
+
+// IR 生成四元式
+func (s *Service) IR(c *gin.Context) {
+	_, result, diagnostics, ok := s.compile(c, compiler.PhaseSemantic)
+	if !ok {
+		return
+	}
+	quadruples := make([]Quadruple, 0, len(result.IR))
+	for index, q := range result.IR {
+		quadruples = append(quadruples, Quadruple{index, q.Op(), q.Arg1(), q.Arg2(), q.Result(), q.Span()})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"ok":          !compiler.HasErrors(diagnostics),
+		"diagnostics": diagnostics,
+		"quadruples":  quadruples,
+	})
+}
+
+// Run 编译并在四元式解释器上执行，执行的步数、时间与输出都受限制
+func (s *Service) Run(c *gin.Context) {
+	request, result, diagnostics, ok := s.compile(c, compiler.PhaseSemantic)
+	if !ok {
+		return
+	}
+	if compiler.HasErrors(diagnostics) {
+		c.JSON(http.StatusOK, gin.H{
+			"ok":          false,
+			"diagnostics": diagnostics,
+			"output":      "",
+			"steps":       0,
+		})
+		return
+	}
+	maxSteps := s.limits.MaxSteps
+	if request.MaxSteps > 0 && request.MaxSteps < maxSteps {
+		maxSteps = request.MaxSteps
+	}
+	timeout := s.limits.Timeout
+	if t := time.Duration(request.TimeoutMs) * time.Millisecond; t > 0 && t < timeout {
+		timeout = t
+	}
+	out := &limitedWriter{limit: s.limits.MaxOutput}
+	in := interpreter.NewInterpreter(result.Semantic, strings.NewReader(request.Stdin), out)
+	in.SetMaxSteps(maxSteps)
+	in.SetDeadline(time.Now().Add(timeout))
+	err := in.Run()
+	response := gin.H{
+		"ok":          err == nil,
+		"diagnostics": diagnostics,
+		"output":      out.String(),
+		"steps":       in.Steps(),
+	}
+	if err != nil {
+		response["error"] = err.Error()
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// limitedWriter 超过limit字节后写入失败的输出缓冲
+type limitedWriter struct {
+	strings.Builder
+	limit int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.Len()+len(p) > w.limit {
+		return 0, OutputLimitErr
+	}
+	return w.Builder.Write(p)
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countdown 读入a，输出a-1到0
+const countdown = "{ int a; bool c; read a; c := a > 0; while c do { a = a - 1; write a; c := a > 0; } }"
+
+// forever 不会结束的循环
+const forever = "{ int a; bool c; c := 1 > 0; while c do { a = a + 1; write a; } }"
+
+// post 发送请求，返回状态码与解析后的响应
+func post(t *testing.T, router http.Handler, path, body string) (int, map[string]any) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+	var response map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("POST %s %.60s: %v in %q", path, body, err, w.Body.String())
+	}
+	return w.Code, response
+}
+
+// request 编码一个CompileRequest
+func request(r CompileRequest) string {
+	data, _ := json.Marshal(r)
+	return string(data)
+}
+
+// firstCode 返回第一条诊断信息的错误码
+func firstCode(response map[string]any) string {
+	diagnostics, _ := response["diagnostics"].([]any)
+	if len(diagnostics) == 0 {
+		return ""
+	}
+	d, _ := diagnostics[0].(map[string]any)
+	code, _ := d["code"].(string)
+	return code
+}
+
+func TestEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := NewService(DefaultLimits).Router()
+	valid := request(CompileRequest{Source: countdown, Stdin: "3"})
+	invalid := request(CompileRequest{Source: "{ int a; a = ; }"})
+	tests := []struct {
+		path  string
+		body  string
+		ok    bool
+		code  string // 第一条诊断信息的错误码
+		field string // 响应中应有的字段
+		check func(v any) bool
+	}{
+		{"/api/lex", valid, true, "", "tokens", func(v any) bool { return len(v.([]any)) == 37 }},
+		{"/api/lex", request(CompileRequest{Source: "{ int 123456789; }"}), false, "E0103", "tokens", nil},
+		{"/api/parse", valid, true, "", "tree", func(v any) bool { return v.(map[string]any)["symbol"] == "<PROG>" }},
+		{"/api/parse", invalid, false, "E0201", "tree", nil},
+		{"/api/check", valid, true, "", "symbols", func(v any) bool { return len(v.([]any)) == 2 }},
+		{"/api/check", request(CompileRequest{Source: "{ int a; b = 1; }"}), false, "E0301", "symbols", nil},
+		{"/api/ir", valid, true, "", "quadruples", func(v any) bool { return len(v.([]any)) == 18 }},
+		{"/api/ir", invalid, false, "E0201", "quadruples", nil},
+		{"/api/run", valid, true, "", "output", func(v any) bool { return v == "2\n1\n0\n" }},
+		{"/api/run", invalid, false, "E0201", "output", func(v any) bool { return v == "" }},
+	}
+	for _, test := range tests {
+		status, response := post(t, router, test.path, test.body)
+		if status != http.StatusOK {
+			t.Errorf("POST %s %s: status %d", test.path, test.body, status)
+			continue
+		}
+		if response["ok"] != test.ok || firstCode(response) != test.code {
+			t.Errorf("POST %s %s: ok = %v, code = %q, want %v, %q", test.path, test.body, response["ok"], firstCode(response), test.ok, test.code)
+		}
+		v, ok := response[test.field]
+		if !ok || (test.check != nil && !test.check(v)) {
+			t.Errorf("POST %s %s: %s = %v", test.path, test.body, test.field, v)
+		}
+	}
+}
+
+// TestRunLimits 步数、时间与输出超过限制时ok为false，error说明原因，已经产生的输出仍然返回
+func TestRunLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	//输出不受限制，分别测试步数与时间的限制
+	steps := DefaultLimits
+	steps.MaxOutput = 1 << 30
+	limits := steps
+	limits.MaxSteps = 1 << 40
+	tests := []struct {
+		limits  Limits
+		request CompileRequest
+		err     string
+	}{
+		{DefaultLimits, CompileRequest{Source: forever, MaxSteps: 100}, "step limit exceeded"},
+		{steps, CompileRequest{Source: forever}, "step limit exceeded"},
+		{limits, CompileRequest{Source: forever, TimeoutMs: 20}, "time limit exceeded"},
+		{Limits{MaxBodySize: 1 << 20, MaxSourceSize: 1 << 10, MaxSteps: 1 << 40, Timeout: 5 * time.Second, MaxOutput: 8}, CompileRequest{Source: forever}, "output limit exceeded"},
+		{DefaultLimits, CompileRequest{Source: "{ int a; read a; }"}, "cannot read an integer"},
+		{DefaultLimits, CompileRequest{Source: "{ int a; a = 1 / a; }"}, "division by zero"},
+	}
+	for _, test := range tests {
+		router := NewService(test.limits).Router()
+		status, response := post(t, router, "/api/run", request(test.request))
+		message, _ := response["error"].(string)
+		if status != http.StatusOK || response["ok"] != false || !strings.Contains(message, test.err) {
+			t.Errorf("run %+v: status %d, ok = %v, error = %q, want %q", test.request, status, response["ok"], message, test.err)
+		}
+	}
+	//请求中的限制只能比服务的限制更小
+	router := NewService(DefaultLimits).Router()
+	_, response := post(t, router, "/api/run", request(CompileRequest{Source: forever, MaxSteps: 1 << 40}))
+	if steps, _ := response["steps"].(float64); int(steps) > DefaultLimits.MaxSteps {
+		t.Errorf("maxSteps above the service limit: %v steps", response["steps"])
+	}
+	_, response = post(t, router, "/api/run", request(CompileRequest{Source: forever, MaxSteps: 100}))
+	if steps, _ := response["steps"].(float64); steps != 100 {
+		t.Errorf("maxSteps 100: %v steps", response["steps"])
+	}
+}
+
+func TestBadRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limits := DefaultLimits
+	limits.MaxSourceSize = 16
+	limits.MaxBodySize = 256
+	router := NewService(limits).Router()
+	//panic由Recovery转为500
+	router.POST("/api/panic", func(c *gin.Context) { panic("boom") })
+	tests := []struct {
+		path   string
+		body   string
+		status int
+	}{
+		{"/api/lex", `{"source":`, http.StatusBadRequest},
+		{"/api/run", `{"source":1}`, http.StatusBadRequest},
+		{"/api/parse", request(CompileRequest{Source: strings.Repeat(" ", 17)}), http.StatusBadRequest},
+		{"/api/run", request(CompileRequest{Source: "{}", Stdin: strings.Repeat("1 ", 200)}), http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		status, response := post(t, router, test.path, test.body)
+		if status != test.status || response["error"] == nil {
+			t.Errorf("POST %s %.40s: status %d, response %v, want %d", test.path, test.body, status, response, test.status)
+		}
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/panic", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("panic: status %d, want 500", w.Code)
+	}
+}
@@ -0,0 +1,14 @@
+// 用网站的runWasm运行.wasm文件：node run.mjs main.wasm < input
+// 从标准输入读入整数，每个输出占一行；运行出错时错误信息写到标准错误，退出码为1
+import { readFileSync } from "node:fs"
+import { runWasm } from "../../../chap1/arithmeticExpression/website/src/helper/wasm.js"
+
+const input = readFileSync(0, "utf8").split(/\s+/).filter(s => s !== "").map(Number)
+const print = output => process.stdout.write(output.map(v => `${v}\n`).join(""))
+try {
+    print(await runWasm(readFileSync(process.argv[2]), input))
+} catch (error) {
+    print(error.output ?? [])
+    console.error(error.message)
+    process.exitCode = 1
+}
@@ -0,0 +1,415 @@
+// Package wat 由四元式生成WebAssembly文本格式(.wat)模块
+//
+// 四元式中的j、jnz可以跳转到任意位置，而Wasm只有结构化的block、loop和br，
+// 因此先构造控制流图与支配树，再按照支配树重建结构化控制流：
+//
+//   - 回边的目标是循环头，用loop包裹，跳回循环头即br到该loop
+//   - 有两个及以上前向前驱的基本块是汇合点，在其直接支配结点内用block包裹，跳到汇合点即br出该block
+//   - 其余基本块只有一个前驱，直接内联到跳转处
+//
+// 生成的模块从env导入read、write，导出main函数，变量统一用i32表示。
+// 解释器、字节码虚拟机、汇编与C后端的int都是64位，结果超出i32范围的程序在Wasm中按32位回绕，输出会与它们不同
+package wat
+
+import (
+	"chap4/cfg"
+	"chap4/lexer"
+	"chap4/semantic"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+var (
+	EmptyProgramErr = errors.New("error: no quadruple to generate")
+	UnknownOpErr    = errors.New("error: unknown quadruple op")
+	IrreducibleErr  = errors.New("error: irreducible control flow")
+)
+
+// relationMap 条件跳转四元式对应的Wasm比较指令
+var relationMap = map[string]string{
+	"j>":  "i32.gt_s",
+	"j>=": "i32.ge_s",
+	"j<":  "i32.lt_s",
+	"j<=": "i32.le_s",
+	"j==": "i32.eq",
+	"j!=": "i32.ne",
+}
+
+// arithMap 算术四元式对应的Wasm指令，除数为零时i32.div_s会引发trap
+var arithMap = map[string]string{
+	"+": "i32.add",
+	"-": "i32.sub",
+	"*": "i32.mul",
+	"/": "i32.div_s",
+}
+
+// frameKind 结构化控制的种类
+type frameKind int
+
+const (
+	frameIf frameKind = iota
+	frameLoop
+	frameBlock
+)
+
+// frame 正在生成的结构化控制，loop对应其循环头，block对应其后的汇合点
+type frame struct {
+	kind  frameKind
+	block *cfg.Block
+}
+
+// Generator WAT生成器
+type Generator struct {
+	quadrupleList []*semantic.Quadruple
+	symbolTable   map[string]*lexer.Symbol
+	vars          []string
+	graph         *cfg.Graph
+	tree          *cfg.DominatorTree
+	loopHeaders   map[*cfg.Block]bool
+	mergeNodes    map[*cfg.Block]bool
+	lines         []string
+	indent        int
+}
+
+// NewGenerator 创建一个WAT生成器实例
+func NewGenerator(s *semantic.Semantic) *Generator {
+	return &Generator{
+		quadrupleList: s.QuadrupleList(),
+		symbolTable:   s.SymbolTable,
+		vars:          s.VarList(),
+		loopHeaders:   make(map[*cfg.Block]bool),
+		mergeNodes:    make(map[*cfg.Block]bool),
+		lines:         make([]string, 0),
+	}
+}
+
+// Generate 生成WAT模块
+func (g *Generator) Generate() (string, error) {
+	if len(g.quadrupleList) == 0 {
+		return "", EmptyProgramErr
+	}
+	graph, err := cfg.Build(g.quadrupleList)
+	if err != nil {
+		return "", err
+	}
+	g.graph = graph
+	g.tree = graph.DominatorTree()
+	if err := g.classify(); err != nil {
+		return "", err
+	}
+	g.lines = g.lines[:0]
+	g.indent = 0
+	g.emit("(module")
+	g.indent++
+	g.emit(`(import "env" "read" (func $read (result i32)))`)
+	g.emit(`(import "env" "write" (func $write (param i32)))`)
+	g.emit(`(func $main (export "main")`)
+	g.indent++
+	g.emitDeclarations()
+	if err := g.doTree(g.tree.Order[0], nil); err != nil {
+		return "", err
+	}
+	g.indent--
+	g.emit(")")
+	g.indent--
+	g.emit(")")
+	return strings.Join(g.lines, "\n") + "\n", nil
+}
+
+// PrintToFile 将WAT模块写入文件
+func (g *Generator) PrintToFile(filename string) error {
+	code, err := g.Generate()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, []byte(code), 0666)
+}
+
+// classify 找出循环头与汇合点，回边的目标必须支配其源，否则控制流不可归约
+func (g *Generator) classify() error {
+	for _, block := range g.tree.Order {
+		forward := 0
+		for _, pred := range block.Preds {
+			if _, ok := g.tree.RPO[pred]; !ok {
+				continue
+			}
+			if !g.tree.IsBackEdge(pred, block) {
+				forward++
+				continue
+			}
+			if !g.tree.Dominates(block, pred) {
+				return fmt.Errorf("%w : %s -> %s", IrreducibleErr, pred, block)
+			}
+			g.loopHeaders[block] = true
+		}
+		if forward >= 2 {
+			g.mergeNodes[block] = true
+		}
+	}
+	return nil
+}
+
+func (g *Generator) emit(format string, a ...any) {
+	g.lines = append(g.lines, strings.Repeat("  ", g.indent)+fmt.Sprintf(format, a...))
+}
+
+// emitDeclarations 声明局部变量，bool与int一样用i32表示，取值为1或0
+func (g *Generator) emitDeclarations() {
+	names := make([]string, 0, len(g.vars))
+	temps := make([]string, 0, len(g.vars))
+	for _, name := range g.vars {
+		if g.symbolTable[name].Class == 0 {
+			temps = append(temps, name)
+		} else {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		g.emit("(local $%s i32) ;; %s", name, g.symbolTable[name].Type)
+	}
+	for _, name := range temps {
+		g.emit("(local $%s i32) ;; temp", name)
+	}
+}
+
+// doTree 生成以block为根的支配子树，汇合点按逆后序从后往前依次包裹
+func (g *Generator) doTree(block *cfg.Block, context []frame) error {
+	merges := make([]*cfg.Block, 0)
+	for _, child := range g.tree.Children[block] {
+		if g.mergeNodes[child] {
+			merges = append(merges, child)
+		}
+	}
+	sort.Slice(merges, func(i, j int) bool {
+		return g.tree.RPO[merges[i]] > g.tree.RPO[merges[j]]
+	})
+	if !g.loopHeaders[block] {
+		return g.nodeWithin(block, merges, context)
+	}
+	g.emit("loop $L%d", block.Index)
+	g.indent++
+	if err := g.nodeWithin(block, merges, push(context, frame{frameLoop, block})); err != nil {
+		return err
+	}
+	g.indent--
+	g.emit("end")
+	return nil
+}
+
+// nodeWithin 生成基本块block，merges中的汇合点紧随其后
+func (g *Generator) nodeWithin(block *cfg.Block, merges []*cfg.Block, context []frame) error {
+	if len(merges) == 0 {
+		if err := g.emitBody(block); err != nil {
+			return err
+		}
+		return g.emitEnd(block, context)
+	}
+	merge := merges[0]
+	g.emit("block $M%d", merge.Index)
+	g.indent++
+	if err := g.nodeWithin(block, merges[1:], push(context, frame{frameBlock, merge})); err != nil {
+		return err
+	}
+	g.indent--
+	g.emit("end")
+	return g.doTree(merge, context)
+}
+
+// push 返回在context末尾追加f后的新切片，不影响原切片
+func push(context []frame, f frame) []frame {
+	res := make([]frame, len(context), len(context)+1)
+	copy(res, context)
+	return append(res, f)
+}
+
+// isBranch 判断从from到to的转移能否用br实现（跳回循环头或跳到汇合点），to为nil表示程序结束
+func (g *Generator) isBranch(from, to *cfg.Block) bool {
+	if to == nil {
+		return true
+	}
+	return g.tree.IsBackEdge(from, to) || g.mergeNodes[to]
+}
+
+// branchLabel 返回从from跳到to时br的标号
+func (g *Generator) branchLabel(from, to *cfg.Block, context []frame) (string, error) {
+	kind, label := frameBlock, fmt.Sprintf("$M%d", to.Index)
+	if g.tree.IsBackEdge(from, to) {
+		kind, label = frameLoop, fmt.Sprintf("$L%d", to.Index)
+	}
+	for i := len(context) - 1; i >= 0; i-- {
+		if context[i].kind == kind && context[i].block == to {
+			return label, nil
+		}
+	}
+	return "", fmt.Errorf("%w : %s -> %s", IrreducibleErr, from, to)
+}
+
+// doBranch 生成从from转移到to的代码
+func (g *Generator) doBranch(from, to *cfg.Block, context []frame) error {
+	if to == nil {
+		g.emit("return")
+		return nil
+	}
+	if g.isBranch(from, to) {
+		label, err := g.branchLabel(from, to, context)
+		if err != nil {
+			return err
+		}
+		g.emit("br %s", label)
+		return nil
+	}
+	return g.doTree(to, context)
+}
+
+// successors 返回基本块结束时的转移：条件成立时的目标、条件不成立或无条件时的目标，nil表示程序结束
+func (g *Generator) successors(block *cfg.Block) (taken, next *cfg.Block, conditional bool, err error) {
+	q := g.quadrupleList[block.Last()]
+	if block.End < len(g.quadrupleList) {
+		next = g.graph.BlockAt(block.End)
+	}
+	switch {
+	case q.Op() == "quit":
+		return nil, nil, false, nil
+	case q.IsJump():
+		target, err := q.JumpTarget()
+		if err != nil {
+			return nil, nil, false, err
+		}
+		taken = g.graph.BlockAt(target)
+		if q.Op() == "j" {
+			return nil, taken, false, nil
+		}
+		return taken, next, taken != next, nil
+	}
+	return nil, next, false, nil
+}
+
+// emitEnd 生成基本块末尾的转移
+func (g *Generator) emitEnd(block *cfg.Block, context []frame) error {
+	taken, next, conditional, err := g.successors(block)
+	if err != nil {
+		return err
+	}
+	if !conditional {
+		return g.doBranch(block, next, context)
+	}
+	if err := g.emitCondition(g.quadrupleList[block.Last()]); err != nil {
+		return err
+	}
+	switch {
+	case g.isBranch(block, taken):
+		if taken == nil {
+			g.emit("if")
+			g.indent++
+			g.emit("return")
+			g.indent--
+			g.emit("end")
+			return g.doBranch(block, next, context)
+		}
+		label, err := g.branchLabel(block, taken, context)
+		if err != nil {
+			return err
+		}
+		g.emit("br_if %s", label)
+		return g.doBranch(block, next, context)
+	case g.isBranch(block, next) && next != nil:
+		label, err := g.branchLabel(block, next, context)
+		if err != nil {
+			return err
+		}
+		g.emit("i32.eqz")
+		g.emit("br_if %s", label)
+		return g.doBranch(block, taken, context)
+	}
+	inner := push(context, frame{kind: frameIf})
+	g.emit("if")
+	g.indent++
+	if err := g.doBranch(block, taken, inner); err != nil {
+		return err
+	}
+	g.indent--
+	g.emit("else")
+	g.indent++
+	if err := g.doBranch(block, next, inner); err != nil {
+		return err
+	}
+	g.indent--
+	g.emit("end")
+	return nil
+}
+
+// emitCondition 将条件跳转的条件压栈
+func (g *Generator) emitCondition(q *semantic.Quadruple) error {
+	if q.Op() == "jnz" {
+		return g.emitOperand(q.Arg1())
+	}
+	if err := g.emitOperand(q.Arg1()); err != nil {
+		return err
+	}
+	if err := g.emitOperand(q.Arg2()); err != nil {
+		return err
+	}
+	g.emit(relationMap[q.Op()])
+	return nil
+}
+
+// emitOperand 将四元式的操作数压栈
+func (g *Generator) emitOperand(arg string) error {
+	if semantic.IsConst(arg) {
+		g.emit("i32.const %s", arg)
+		return nil
+	}
+	if _, ok := g.symbolTable[arg]; !ok {
+		return fmt.Errorf("error: %s is not declared", arg)
+	}
+	g.emit("local.get $%s", arg)
+	return nil
+}
+
+// emitBody 翻译基本块中除末尾转移之外的四元式
+func (g *Generator) emitBody(block *cfg.Block) error {
+	for index := block.Start; index < block.End; index++ {
+		q := g.quadrupleList[index]
+		if q.IsJump() || q.Op() == "quit" {
+			continue
+		}
+		if err := g.emitQuadruple(q); err != nil {
+			return fmt.Errorf("%w : %d: %s", err, index, q)
+		}
+	}
+	return nil
+}
+
+// emitQuadruple 将一条非跳转四元式翻译为Wasm指令
+func (g *Generator) emitQuadruple(q *semantic.Quadruple) error {
+	switch q.Op() {
+	case "+", "-", "*", "/":
+		if err := g.emitOperand(q.Arg1()); err != nil {
+			return err
+		}
+		if err := g.emitOperand(q.Arg2()); err != nil {
+			return err
+		}
+		g.emit(arithMap[q.Op()])
+		g.emit("local.set $%s", q.Result())
+	case "=", ":=":
+		if err := g.emitOperand(q.Arg1()); err != nil {
+			return err
+		}
+		g.emit("local.set $%s", q.Result())
+	case "read":
+		g.emit("call $read")
+		g.emit("local.set $%s", q.Arg1())
+	case "write":
+		if err := g.emitOperand(q.Arg1()); err != nil {
+			return err
+		}
+		g.emit("call $write")
+	default:
+		return UnknownOpErr
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package wat
+
+import (
+	"bytes"
+	"chap4/compiler"
+	"chap4/internal/corpus"
+	"chap4/interpreter"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// generate 编译一个样例程序并生成WAT，不能编译的程序跳过
+func generate(t *testing.T, p corpus.Program) string {
+	t.Helper()
+	result, diagnostics := compiler.CompileFile(p.Path, compiler.Options{})
+	if compiler.HasErrors(diagnostics) {
+		t.Skipf("%s does not compile: %v", p.Path, diagnostics[0])
+	}
+	code, err := NewGenerator(result.Semantic).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// checkNesting 检查函数体中的block、loop、if与end、else正确配对，
+// br与br_if只能跳到外层的block或loop，括号配对
+func checkNesting(code string) error {
+	if depth := strings.Count(code, "(") - strings.Count(code, ")"); depth != 0 {
+		return fmt.Errorf("parentheses are unbalanced by %d", depth)
+	}
+	var stack []string
+	for i, line := range strings.Split(code, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "block", "loop":
+			if len(fields) < 2 {
+				return fmt.Errorf("line %d: %s without a label", i+1, fields[0])
+			}
+			stack = append(stack, fields[0]+" "+fields[1])
+		case "if":
+			stack = append(stack, "if")
+		case "else":
+			if len(stack) == 0 || stack[len(stack)-1] != "if" {
+				return fmt.Errorf("line %d: else outside if", i+1)
+			}
+			stack[len(stack)-1] = "else"
+		case "end":
+			if len(stack) == 0 {
+				return fmt.Errorf("line %d: unmatched end", i+1)
+			}
+			stack = stack[:len(stack)-1]
+		case "br", "br_if":
+			//$L只能跳回外层的loop，$M只能跳出外层的block
+			kind := "block "
+			if strings.HasPrefix(fields[1], "$L") {
+				kind = "loop "
+			}
+			found := false
+			for _, frame := range stack {
+				found = found || frame == kind+fields[1]
+			}
+			if !found {
+				return fmt.Errorf("line %d: %s %s is not inside %s%s", i+1, fields[0], fields[1], kind, fields[1])
+			}
+		}
+	}
+	if len(stack) != 0 {
+		return fmt.Errorf("%d unclosed structured instructions: %v", len(stack), stack)
+	}
+	return nil
+}
+
+func TestCheckNesting(t *testing.T) {
+	tests := []struct {
+		code string
+		ok   bool
+	}{
+		{"(func\nloop $L1\nblock $M2\nbr_if $M2\nbr $L1\nend\nend\n)", true},
+		{"(func\nif\nreturn\nelse\nend\n)", true},
+		{"(func\nloop $L1\nend\nbr $L1\n)", false},
+		{"(func\nblock $M1\nbr $L1\nend\n)", false},
+		{"(func\nloop $L1\n)", false},
+		{"(func\nelse\nend\n)", false},
+		{"(func\nend\n)", false},
+		{"(func\n", false},
+	}
+	for _, test := range tests {
+		if err := checkNesting(test.code); (err == nil) != test.ok {
+			t.Errorf("checkNesting(%q) = %v", test.code, err)
+		}
+	}
+}
+
+// TestNesting 每个样例程序生成的WAT中结构化控制流都正确嵌套
+func TestNesting(t *testing.T) {
+	programs, err := corpus.Programs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range programs {
+		p := p
+		t.Run(p.Name, func(t *testing.T) {
+			code := generate(t, p)
+			if err := checkNesting(code); err != nil {
+				t.Errorf("%v\n%s", err, code)
+			}
+		})
+	}
+}
+
+// TestWat2wasm 用wat2wasm汇编每个样例程序生成的WAT；没有wat2wasm时跳过
+func TestWat2wasm(t *testing.T) {
+	wat2wasm, err := exec.LookPath("wat2wasm")
+	if err != nil {
+		t.Skip("wat2wasm not found")
+	}
+	programs, err := corpus.Programs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range programs {
+		p := p
+		t.Run(p.Name, func(t *testing.T) {
+			code := generate(t, p)
+			file := filepath.Join(t.TempDir(), "target.wat")
+			if err := os.WriteFile(file, []byte(code), 0666); err != nil {
+				t.Fatal(err)
+			}
+			if out, err := exec.Command(wat2wasm, "-o", os.DevNull, file).CombinedOutput(); err != nil {
+				t.Errorf("wat2wasm: %v\n%s\n%s", err, out, code)
+			}
+		})
+	}
+}
+
+// TestRun 用wat2wasm汇编每个样例程序生成的WAT，再用node通过网站的runWasm执行，
+// 输出应与四元式解释器相同；模块从env导入read、write，wasmtime等命令行运行时无法提供，
+// 所以由testdata/run.mjs作为宿主。没有wat2wasm或node时跳过
+func TestRun(t *testing.T) {
+	wat2wasm, err := exec.LookPath("wat2wasm")
+	if err != nil {
+		t.Skip("wat2wasm not found")
+	}
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not found")
+	}
+	programs, err := corpus.Programs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range programs {
+		p := p
+		t.Run(p.Name, func(t *testing.T) {
+			code := generate(t, p)
+			result, _ := compiler.CompileFile(p.Path, compiler.Options{})
+			var want bytes.Buffer
+			runErr := interpreter.NewInterpreter(result.Semantic, strings.NewReader(corpus.Input), &want).Run()
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "target.wat"), []byte(code), 0666); err != nil {
+				t.Fatal(err)
+			}
+			wasm := filepath.Join(dir, "target.wasm")
+			if out, err := exec.Command(wat2wasm, "-o", wasm, filepath.Join(dir, "target.wat")).CombinedOutput(); err != nil {
+				t.Fatalf("wat2wasm: %v\n%s", err, out)
+			}
+			run := exec.Command(node, filepath.Join("testdata", "run.mjs"), wasm)
+			run.Stdin = strings.NewReader(corpus.Input)
+			var stderr bytes.Buffer
+			run.Stderr = &stderr
+			got, err := run.Output()
+			if (err != nil) != (runErr != nil) {
+				t.Fatalf("module error = %v %s, interpreter error = %v", err, stderr.String(), runErr)
+			}
+			if string(got) != want.String() {
+				t.Errorf("module output = %q, interpreter output = %q\n%s", got, want.String(), code)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+// Package golden 各章golden文件测试共用的比较函数：输出与golden文件不同时列出不同的行，
+// go test -update改为用当前的输出重写golden文件
+package golden
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the current output")
+
+// Check 比较输出与golden文件，golden文件中的\r\n按\n比较
+func Check(t testing.TB, golden string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	want = bytes.ReplaceAll(want, []byte("\r\n"), []byte("\n"))
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s (run go test -update to accept it)\n%s", golden, Diff(string(want), string(got)))
+	}
+}
+
+// Diff 逐行比较，列出前几处不同的行
+func Diff(want, got string) string {
+	const maxLines = 10
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+	var b strings.Builder
+	count := 0
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w == g {
+			continue
+		}
+		if count == maxLines {
+			b.WriteString("...\n")
+			break
+		}
+		count++
+		fmt.Fprintf(&b, "line %d:\n  want: %s\n  got:  %s\n", i+1, w, g)
+	}
+	return b.String()
+}
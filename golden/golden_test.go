@@ -0,0 +1,21 @@
+package golden
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	got := Diff("a\nb\nc\n", "a\nx\nc\nd\n")
+	want := "line 2:\n  want: b\n  got:  x\nline 4:\n  want: \n  got:  d\n"
+	if got != want {
+		t.Errorf("Diff = %q, want %q", got, want)
+	}
+	if got := Diff("same", "same"); got != "" {
+		t.Errorf("Diff of equal text = %q", got)
+	}
+	many := strings.Repeat("x\n", 20)
+	if got := Diff(many, strings.Repeat("y\n", 20)); !strings.HasSuffix(got, "...\n") {
+		t.Errorf("Diff does not stop after 10 lines: %q", got)
+	}
+}